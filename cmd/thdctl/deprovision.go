@@ -0,0 +1,94 @@
+package thdctl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/checkpoint"
+	"github.com/eriklundjensen/thdctl/pkg/controller"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/eriklundjensen/thdctl/pkg/validation"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type deprovisionFlags struct {
+	resetTalos  bool
+	graceful    bool
+	talosconfig string
+	stateDir    string
+	yes         bool
+	hooks       string
+}
+
+var deprovisionCmdFlags deprovisionFlags
+
+var deprovisionCmd = &cobra.Command{
+	Use:   "deprovision <serverNumber>",
+	Short: "Reset a server to the rescue system and wipe all disks",
+	Args:  cobra.RangeArgs(1, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		serverNumber, err := strconv.Atoi(args[0])
+		if err != nil {
+			logrus.WithError(err).Error("Error parsing server number")
+			return err
+		}
+		if err := validation.ValidateServerNumber(serverNumber, "serverNumber").ToAggregate(); err != nil {
+			return err
+		}
+		if !deprovisionCmdFlags.yes {
+			return fmt.Errorf("deprovision wipes all disks of server %d, use --yes to confirm", serverNumber)
+		}
+		sshClient := &hetznerapi.SSHClient{}
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return deprovisionServer(ctx, RobotClient, sshClient, serverNumber, deprovisionCmdFlags)
+	},
+}
+
+func init() {
+	deprovisionCmd.Flags().BoolVar(&deprovisionCmdFlags.resetTalos, "reset-talos", false, "reset Talos through the Talos API before booting the rescue system. Requires --talosconfig.")
+	deprovisionCmd.Flags().BoolVar(&deprovisionCmdFlags.graceful, "graceful", false, "cordon and drain the node and leave etcd before the Talos reset")
+	deprovisionCmd.Flags().StringVar(&deprovisionCmdFlags.talosconfig, "talosconfig", "", "talosconfig used to access the node")
+	deprovisionCmd.Flags().StringVar(&deprovisionCmdFlags.stateDir, "state-dir", defaultStateDir(), "directory of the state files used to resume interrupted runs")
+	deprovisionCmd.Flags().StringVar(&deprovisionCmdFlags.hooks, "hooks", "", "file of the hooks run on state transitions")
+	deprovisionCmd.Flags().BoolVar(&deprovisionCmdFlags.yes, "yes", false, "confirm that all disks of the server are wiped")
+	addCommand(deprovisionCmd)
+}
+
+func deprovisionServer(ctx context.Context, client robot.ClientInterface, sshClient hetznerapi.SSHClientInterface, serverNumber int, f deprovisionFlags) error {
+	if f.resetTalos && f.talosconfig == "" {
+		return fmt.Errorf("--reset-talos requires --talosconfig")
+	}
+	if f.graceful && !f.resetTalos {
+		return fmt.Errorf("--graceful requires --reset-talos")
+	}
+
+	subscribers, stopHooks, err := startHooks(f.hooks)
+	if err != nil {
+		return err
+	}
+	defer stopHooks()
+
+	server := &v1alpha1.ServerParameters{ServerNumber: serverNumber, Talosconfig: f.talosconfig}
+	sm := controller.NewStateMachine(client, sshClient, server, 5)
+	for _, subscriber := range subscribers {
+		sm.Subscribe(subscriber)
+	}
+	sm.Deprovision(controller.DeprovisionOptions{ResetTalos: f.resetTalos, Graceful: f.graceful})
+	if f.stateDir != "" {
+		if err := sm.Resume(checkpoint.NewFileStore(f.stateDir)); err != nil {
+			return err
+		}
+	}
+	if err := sm.Run(ctx); err != nil {
+		return fmt.Errorf("failed to deprovision server %d: %v", serverNumber, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package thdctl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	clusterv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/cluster/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/api/manifest"
+	"github.com/eriklundjensen/thdctl/pkg/genconfig"
+	"github.com/eriklundjensen/thdctl/pkg/validation"
+	"github.com/spf13/cobra"
+)
+
+type genconfigFlags struct {
+	filename  string
+	outputDir string
+	talosctl  string
+}
+
+var genconfigCmdFlags genconfigFlags
+
+var genconfigCmd = &cobra.Command{
+	Use:   "genconfig",
+	Short: "Generate Talos machine configs and talosconfig for a cluster",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		generator := &genconfig.Generator{
+			Runner:    genconfig.Talosctl{Path: genconfigCmdFlags.talosctl},
+			OutputDir: genconfigCmdFlags.outputDir,
+		}
+		return generateConfig(generator, genconfigCmdFlags.filename)
+	},
+}
+
+func init() {
+	genconfigCmd.Flags().StringVarP(&genconfigCmdFlags.filename, "filename", "f", "", "filename containing cluster definition (required)")
+	genconfigCmd.Flags().StringVarP(&genconfigCmdFlags.outputDir, "output", "o", "gen", "directory of the generated configs. Existing secrets in the directory are reused.")
+	genconfigCmd.Flags().StringVar(&genconfigCmdFlags.talosctl, "talosctl", "talosctl", "path of the talosctl binary")
+	genconfigCmd.MarkFlagRequired("filename")
+	addCommand(genconfigCmd)
+}
+
+// readClusterConfig reads the cluster definition. Patches and server specifications are resolved relative to the file.
+func readClusterConfig(filename string) (*clusterv1alpha1.ClusterParameters, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+
+	documents, err := manifest.DefaultScheme.Decode(data, func(data []byte) (any, error) {
+		var parameters clusterv1alpha1.ClusterParameters
+		return &parameters, manifest.Unmarshal(data, &parameters)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filename, err)
+	}
+	if err := validation.ValidateDocuments(documents).ToAggregate(); err != nil {
+		return nil, fmt.Errorf("invalid %s:\n%v", filename, err)
+	}
+	var clusters []clusterv1alpha1.ClusterParameters
+	for _, document := range documents {
+		switch obj := document.Object.(type) {
+		case *clusterv1alpha1.Cluster:
+			clusters = append(clusters, obj.Spec.ForProvider)
+		case *clusterv1alpha1.ClusterParameters:
+			clusters = append(clusters, *obj)
+		}
+	}
+	if len(clusters) != 1 {
+		return nil, fmt.Errorf("%s must contain a single cluster, found %d", filename, len(clusters))
+	}
+	cluster := clusters[0]
+
+	dir := filepath.Dir(filename)
+	resolve := func(paths []string) {
+		for i, path := range paths {
+			if !filepath.IsAbs(path) {
+				paths[i] = filepath.Join(dir, path)
+			}
+		}
+	}
+	resolve(cluster.Patches)
+	resolve(cluster.ControlPlanePatches)
+	resolve(cluster.WorkerPatches)
+	for i := range cluster.Nodes {
+		resolve(cluster.Nodes[i].Patches)
+		if cluster.Nodes[i].ServerSpec != "" {
+			specs := []string{cluster.Nodes[i].ServerSpec}
+			resolve(specs)
+			cluster.Nodes[i].ServerSpec = specs[0]
+		}
+	}
+
+	return &cluster, nil
+}
+
+func generateConfig(generator *genconfig.Generator, filename string) error {
+	cluster, err := readClusterConfig(filename)
+	if err != nil {
+		return err
+	}
+
+	nodes := make([]genconfig.Node, 0, len(cluster.Nodes))
+	for _, node := range cluster.Nodes {
+		if node.ServerSpec == "" {
+			return fmt.Errorf("serverSpec of node %s must be set", node.Name)
+		}
+		server, err := readServerConfig(node.ServerSpec)
+		if err != nil {
+			return fmt.Errorf("error reading server specification of node %s: %v", node.Name, err)
+		}
+		nodes = append(nodes, genconfig.Node{Node: node, Server: server})
+	}
+
+	return generator.Generate(cluster, nodes)
+}
@@ -1,10 +1,15 @@
 package thdctl
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/controller"
 	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
 	"github.com/eriklundjensen/thdctl/pkg/robot"
 	"github.com/eriklundjensen/thdctl/pkg/validation"
@@ -20,6 +25,7 @@ type cmdFlags struct {
 	disk               string
 	version            string
 	image              string
+	dryRun             bool
 }
 
 var initCmdFlags cmdFlags
@@ -34,122 +40,102 @@ var initCmd = &cobra.Command{
 			logrus.WithError(err).Error("Error parsing server number")
 			return err
 		}
-		sshClient := &hetznerapi.SSHClient{}
-		err = initializeServer(RobotClient, sshClient, serverNumber, initCmdFlags)
-		return err
+		if err := validation.ValidateServerNumber(serverNumber, "serverNumber").ToAggregate(); err != nil {
+			return err
+		}
+		sm, err := newInitStateMachine(RobotClient, &hetznerapi.SSHClient{}, serverNumber, initCmdFlags)
+		if err != nil {
+			return err
+		}
+		if initCmdFlags.dryRun {
+			current, actions := sm.Plan()
+			printPlan(cmd.OutOrStdout(), serverNumber, current, actions)
+			return nil
+		}
+		// the run stops and init can be started again on interrupt
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return initializeServer(ctx, sm, serverNumber)
 	},
 }
 
-// TODO: validate disk parameter does not include special characters (prevent injection of commands in shell)
 func init() {
 	initCmd.Flags().BoolVarP(&initCmdFlags.skipReboot, "skipReboot", "n", false, "skip reboot of server to enable rescue system. HETZNER_SSH_PASSWORD must be set in environment variable when skipReet")
 	initCmd.Flags().BoolVarP(&initCmdFlags.enableRescueSystem, "enable-rescue-system", "r", false, "entering rescue system even if rescue system already enabled. This will generate a new password.")
 	initCmd.Flags().StringVarP(&initCmdFlags.disk, "disk", "d", "sda", "disk to use for installation of image.")
 	initCmd.Flags().StringVarP(&initCmdFlags.version, "version", "v", defaultTalosVersion, "Talos version.")
 	initCmd.Flags().StringVarP(&initCmdFlags.image, "image", "i", "", "Talos image URL. Don't use hcloud-amd64 image target Hetzner Cloud, use Talos 'metal' image instead.")
+	initCmd.Flags().BoolVar(&initCmdFlags.dryRun, "dry-run", false, "print the actions of init without changing the server")
 	initCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
-		return validation.ValidateDiskName(initCmdFlags.disk)
+		return validateInitFlags(initCmdFlags)
 	}
 	addCommand(initCmd)
 }
 
-func initializeServer(client robot.ClientInterface, sshClient hetznerapi.SSHClientInterface, serverNumber int, f cmdFlags) error {
-	sshPassword := ""
-	if f.skipReboot { 
-		if (f.enableRescueSystem){
-			return fmt.Errorf("can not enable rescue system and skip reboot at the same time")
+// validateInitFlags validates the disk and the image or version. The image takes precedence over the version.
+func validateInitFlags(f cmdFlags) error {
+	errs := validation.ValidateDisk(f.disk, "--disk")
+	if f.image != "" {
+		errs = append(errs, validation.ValidateImageURL(f.image, "--image")...)
+	} else if f.version != "" {
+		errs = append(errs, validation.ValidateTalosVersion(f.version, "--version")...)
+	}
+	return errs.ToAggregate()
+}
+
+// newInitStateMachine returns a state machine installing Talos like init. The run starts by enabling the rescue
+// system, by resetting the server into an active rescue system or, with --skipReboot, by connecting to it.
+// It completes when the server reboots into Talos.
+func newInitStateMachine(client robot.ClientInterface, sshClient hetznerapi.SSHClientInterface, serverNumber int, f cmdFlags) (*controller.StateMachine, error) {
+	if f.skipReboot {
+		if f.enableRescueSystem {
+			return nil, fmt.Errorf("can not enable rescue system and skip reboot at the same time")
 		}
-		sshPassword = os.Getenv("HETZNER_SSH_PASSWORD") // Set your Hetzner password in environment variable instead of initiating rescue system
-		if (sshPassword	== "") {
-			return fmt.Errorf("can not skip reboot without setting HETZNER_SSH_PASSWORD")
+		// the password is used by the state machine to connect to the rescue system
+		if os.Getenv("HETZNER_SSH_PASSWORD") == "" {
+			return nil, fmt.Errorf("can not skip reboot without setting HETZNER_SSH_PASSWORD")
 		}
 	}
 
 	rescue, err := hetznerapi.GetRescueSystemDetails(client, serverNumber)
 	if err != nil {
-		if err.StatusCode == 401 {
-			logrus.WithFields(logrus.Fields{
-				"username": client.(robot.Client).Username,
-			}).Warn("Failed to authenticate with Hetzner API. Please check your credentials.")
+		if c, ok := client.(robot.Client); ok && err.StatusCode == 401 {
+			logrus.WithField("username", c.Username).Warn("Failed to authenticate with Hetzner API. Please check your credentials.")
 		}
 		logrus.WithError(err).Error("Error getting rescue system status")
-		return err
-	}
-
-	if (!rescue.Rescue.Active && sshPassword =="") || f.enableRescueSystem {
-		rescue, err = hetznerapi.EnableRescueSystem(client, serverNumber)
-		if err != nil {
-			logrus.WithError(err).Error("Error enabling rescue system")
-			return err
-		}
-	}
-
-	if !f.skipReboot || sshPassword == ""{
-		err = hetznerapi.RebootServer(client, serverNumber)
-	}
-	if err != nil || rescue == nil {
-		logrus.WithError(err).Error("Rescue system state is not available")
-		return err
-	}
-	sshClient.SetTargetHost(rescue.Rescue.ServerIP, "22")
-
-	sshUser := "root"
-	if rescue.Rescue.Password != "" {
-		sshPassword = rescue.Rescue.Password
-	}
-	sshClient.Auth(sshUser, sshPassword)
-
-	sshClient.WaitForReboot()
-	logrus.Info("Server rebooted in rescue system mode")
-
-	output, sshErr := sshClient.VerifyDiskExists(f.disk)
-	if sshErr != nil {
-		logrus.WithFields(logrus.Fields{
-			"error":  sshErr,
-			"output": output,
-		}).Error("Disk not found")
-		listOutput, listDiskErr := sshClient.ListDisks()
-		if listDiskErr != nil {
-			logrus.WithError(listDiskErr).Error("Failed to list disks")
-		} else {
-			disks, _ := hetznerapi.ParseLSBLKOutput(listOutput)
-			logrus.Info("Available disks")
-			hetznerapi.LogAsJSON(disks)
-		}
-		return sshErr
+		return nil, err
 	}
 
-	version := defaultTalosVersion
-	if f.version != "" {
-		if f.image != "" {
+	server := &v1alpha1.ServerParameters{ServerNumber: serverNumber, Disk: f.disk, TalosVersion: f.version}
+	if f.image != "" {
+		if f.version != defaultTalosVersion {
 			logrus.Warn("Warning: Both version and image flags are set. Using image flag.")
 		}
-		version = f.version
+		server.TalosVersion = ""
+		server.TalosImage = f.image
 	}
-	imageUrl := fmt.Sprintf("https://github.com/siderolabs/talos/releases/download/%s/metal-amd64.raw.zst", version)
-	if f.image != "" {
-		imageUrl = f.image
+	if server.TalosVersion == "" && server.TalosImage == "" {
+		server.TalosVersion = defaultTalosVersion
 	}
 
-	output, sshErr = sshClient.DownloadImage(imageUrl)
-	if sshErr != nil {
-		logrus.WithFields(logrus.Fields{
-			"error":  sshErr,
-			"output": output,
-		}).Error("Failed to download image")
-		return sshErr
+	sm := controller.NewStateMachine(client, sshClient, server, 5)
+	sm.SetTargetState(controller.TalosImageInstalled)
+	switch {
+	case f.skipReboot:
+		sm.StateChange(controller.WaitForReboot)
+	case rescue.Rescue.Active && !f.enableRescueSystem:
+		sm.StateChange(controller.RequiresReboot)
+	default:
+		sm.StateChange(controller.Uninitialized)
 	}
+	return sm, nil
+}
 
-	output, sshErr = sshClient.InstallImage(f.disk)
-	if sshErr != nil {
-		logrus.WithFields(logrus.Fields{
-			"error":  sshErr,
-			"output": output,
-		}).Error("Failed to install image")
-		_, _ = sshClient.ListDisks()
-		return sshErr
+// initializeServer installs Talos in a one-shot run of the state machine used by reconcile
+func initializeServer(ctx context.Context, sm *controller.StateMachine, serverNumber int) error {
+	if err := sm.Run(ctx); err != nil {
+		return fmt.Errorf("failed to initialize server %d: %v", serverNumber, err)
 	}
-
-	hetznerapi.RebootServer(client, serverNumber)
+	logrus.Info("Talos image installed, the server is rebooting into Talos")
 	return nil
 }
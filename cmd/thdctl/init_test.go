@@ -1,11 +1,18 @@
 package thdctl
 
 import (
+	"context"
+	"errors"
 	"net/url"
 	"testing"
+	"time"
 
+	"github.com/eriklundjensen/thdctl/pkg/controller"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi/sshtest"
 	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // Mocking the robot.Client
@@ -29,88 +36,115 @@ func (m *MockClient) Post(path string, data url.Values) ([]byte, *robot.HTTPErro
 	return args.Get(0).([]byte), &robot.HTTPError{StatusCode: 0, Message: "", Err: args.Get(1).(error)}
 }
 
-// Mocking the SSHClientInterface
-type MockSSHClient struct {
-	mock.Mock
-}
-
-func (m *MockSSHClient) Auth(user, password string) error {
-	args := m.Called(user, password)
-	return args.Error(0)
-}
-
-func (m *MockSSHClient) WaitForReboot() bool {
-	args := m.Called()
-	return args.Bool(0)
-}
-
-func (m *MockSSHClient) DownloadImage(url string) (string, error) {
-	args := m.Called(url)
-	return args.String(0), args.Error(1)
+// fastTimeouts keeps the deadlines but does not wait between polls
+var fastTimeouts = controller.Timeouts{
+	PollInterval:    time.Millisecond,
+	MaxPollInterval: time.Millisecond,
+	StateDeadlines:  controller.DefaultTimeouts().StateDeadlines,
 }
 
-func (m *MockSSHClient) InstallImage(disk string) (string, error) {
-	args := m.Called(disk)
-	return args.String(0), args.Error(1)
-}
-
-func (m *MockSSHClient) ListDisks() (string, error) {
-	args := m.Called()
-	return args.String(0), args.Error(1)
-}
-
-func (m *MockSSHClient) EstablishSSHSession() error {
-	args := m.Called()
-	return args.Error(0)
-}
-
-func (m *MockSSHClient) SetTargetHost(host, port string) {
-	m.Called(host, port)
-}
-
-func (m *MockSSHClient) ExecuteCommand(cmd string) (string, error) {
-	args := m.Called(cmd)
-	return args.String(0), args.Error(1)
-}
-
-func (m *MockSSHClient) ExecuteLSCommand() (string, error) {
-	args := m.Called()
-	return args.String(0), args.Error(1)
-}
+const talosPartitionTable = `{"partitiontable": {"label": "gpt", "device": "/dev/sda", "partitions": [
+	{"node": "/dev/sda1", "name": "EFI"},
+	{"node": "/dev/sda2", "name": "BIOS"},
+	{"node": "/dev/sda3", "name": "BOOT"},
+	{"node": "/dev/sda4", "name": "META"},
+	{"node": "/dev/sda5", "name": "STATE"}
+]}}`
 
 func TestInitializeServer(t *testing.T) {
 	mockClient := new(MockClient)
 	serverNumber := 12345
 	flags := cmdFlags{
-		skipReboot:         false,
 		enableRescueSystem: true,
-		disk:               "sda1",
+		disk:               "sda",
 		version:            "v1.9.2",
-		image:              "",
 	}
 
-	// Mocking GetRescueSystemDetails
-	mockClient.On("Get", mock.Anything).Return([]byte(`{"rescue": {"active": false}}`), nil)
+	mockClient.On("Get", "boot/12345/rescue").Return([]byte(`{"rescue": {"active": true, "server_ip": "192.0.2.10"}}`), nil)
+	mockClient.On("Post", "boot/12345/rescue", url.Values{"os": {"linux"}}).Return([]byte(`{"rescue": {"active": true, "password": "testpassword"}}`), nil).Once()
+	mockClient.On("Get", "reset/12345").Return([]byte(`{"reset": {"server_number": 12345, "type": ["sw", "hw", "power", "power_long", "man"]}}`), nil)
+	// a software reset boots the rescue system, the hardware reset boots Talos
+	mockClient.On("Post", "reset/12345", url.Values{"type": {"sw"}}).Return([]byte(`{}`), nil).Once()
+	mockClient.On("Post", "reset/12345", url.Values{"type": {"hw"}}).Return([]byte(`{}`), nil).Once()
+
+	mockSSHClient := new(sshtest.MockClient)
+	mockSSHClient.On("SetTargetHost", "192.0.2.10", "22")
+	mockSSHClient.On("Auth", "root", "testpassword").Return(nil)
+	mockSSHClient.On("EstablishSSHSession").Return(nil)
+	mockSSHClient.On("VerifyDiskExists", "sda").Return("sda", nil)
+	mockSSHClient.On("DownloadImage", "https://github.com/siderolabs/talos/releases/download/v1.9.2/metal-amd64.raw.zst").Return("Downloaded", nil)
+	mockSSHClient.On("InstallImage", "sda").Return("Installed", nil)
+	mockSSHClient.On("ReadPartitionTable", "sda").Return(talosPartitionTable, nil)
+
+	sm, err := newInitStateMachine(mockClient, mockSSHClient, serverNumber, flags)
+	require.NoError(t, err)
+	sm.SetTimeouts(fastTimeouts)
+	t.Setenv("HETZNER_SSH_PASSWORD", "")
+
+	require.NoError(t, initializeServer(context.Background(), sm, serverNumber))
+
+	assert.Equal(t, "TalosImageInstalled", sm.Status().State)
+	assert.Equal(t, "v1.9.2", sm.Status().Talos.Version)
+	mockClient.AssertExpectations(t)
+	mockSSHClient.AssertExpectations(t)
+}
 
-	// Mocking EnableRescueSystem
-	mockClient.On("Post", mock.Anything, mock.Anything).Return([]byte(`{"rescue": {"active": true, "password": "testpassword"}}`), nil)
+func TestInitializeServerDiskNotFound(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("Get", "boot/12345/rescue").Return([]byte(`{"rescue": {"active": true, "server_ip": "192.0.2.10", "password": "secret"}}`), nil)
+	// the rescue system is active, the server is reset into it. The software reset is not supported.
+	mockClient.On("Get", "reset/12345").Return([]byte(`{"reset": {"server_number": 12345, "type": ["hw", "man"]}}`), nil)
+	mockClient.On("Post", "reset/12345", url.Values{"type": {"hw"}}).Return([]byte(`{}`), nil).Once()
+
+	mockSSHClient := new(sshtest.MockClient)
+	mockSSHClient.On("SetTargetHost", "192.0.2.10", "22")
+	mockSSHClient.On("Auth", "root", "secret").Return(nil)
+	mockSSHClient.On("EstablishSSHSession").Return(nil)
+	mockSSHClient.On("VerifyDiskExists", "sdb").Return("", errors.New("exit status 1"))
+	mockSSHClient.On("ListDisks").Return("NAME MAJ:MIN RM SIZE RO TYPE MOUNTPOINTS\nsda 8:0 0 1.8T 0 disk\n", nil)
+
+	sm, err := newInitStateMachine(mockClient, mockSSHClient, 12345, cmdFlags{disk: "sdb", version: "v1.9.2"})
+	require.NoError(t, err)
+	sm.SetTimeouts(fastTimeouts)
+	t.Setenv("HETZNER_SSH_PASSWORD", "")
+
+	err = initializeServer(context.Background(), sm, 12345)
+
+	assert.EqualError(t, err, "failed to initialize server 12345: failed to reach a valid state: DiskNotFound")
+	mockSSHClient.AssertNotCalled(t, "DownloadImage", mock.Anything)
+	mockSSHClient.AssertNotCalled(t, "InstallImage", mock.Anything)
+}
 
-	// Mocking RebootServer
-	mockClient.On("Post", mock.Anything, mock.Anything).Return(nil, nil)
+func TestNewInitStateMachineRejectsSkipRebootWithoutPassword(t *testing.T) {
+	t.Setenv("HETZNER_SSH_PASSWORD", "")
+	_, err := newInitStateMachine(new(MockClient), new(sshtest.MockClient), 12345, cmdFlags{skipReboot: true, disk: "sda"})
+	assert.EqualError(t, err, "can not skip reboot without setting HETZNER_SSH_PASSWORD")
+}
 
-	// Mocking SSHClientInterface
-	mockSSHClient := new(MockSSHClient)
-	mockSSHClient.On("Auth", mock.Anything, mock.Anything).Return(nil)
-	mockSSHClient.On("WaitForReboot").Return(true)
-	mockSSHClient.On("DownloadImage", mock.Anything).Return("Downloaded", nil)
-	mockSSHClient.On("InstallImage", mock.Anything).Return("Installed", nil)
-	mockSSHClient.On("ListDisks", mock.Anything).Return("Disks", nil)
-	mockSSHClient.On("SetTargetHost", mock.Anything, mock.Anything).Return(nil)
+func TestPlanInitDoesNotChangeServer(t *testing.T) {
+	mockClient := new(MockClient)
+	// the rescue system is active, init resets the server into it without enabling it again
+	mockClient.On("Get", "boot/12345/rescue").Return([]byte(`{"rescue": {"active": true, "server_ip": "192.0.2.10"}}`), nil)
+	mockSSHClient := new(sshtest.MockClient)
 
-	// Call the function
-	initializeServer(mockClient, mockSSHClient, serverNumber, flags)
+	sm, err := newInitStateMachine(mockClient, mockSSHClient, 12345, cmdFlags{disk: "sda", version: "v1.9.2"})
+	require.NoError(t, err)
+	current, actions := sm.Plan()
 
-	// Assertions
 	mockClient.AssertExpectations(t)
-	mockSSHClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "Post", mock.Anything, mock.Anything)
+	assert.Equal(t, controller.RequiresReboot, current)
+	var descriptions []string
+	for _, action := range actions {
+		descriptions = append(descriptions, action.Description)
+	}
+	assert.Equal(t, []string{
+		"POST reset/12345 type=sw: reset the server into the rescue system, escalating to hw and power while SSH does not come back",
+		"wait for SSH of the rescue system",
+		"check that /dev/sda exists",
+		"download https://github.com/siderolabs/talos/releases/download/v1.9.2/metal-amd64.raw.zst to /tmp/talos.raw.xz",
+		"write the image to /dev/sda",
+		"verify the Talos partitions of /dev/sda",
+		"POST reset/12345 type=hw: boot Talos",
+	}, descriptions)
 }
@@ -41,7 +41,7 @@ func (m *mockRobotClient) Post(path string, values url.Values) ([]byte, *robot.H
 func TestListServers(t *testing.T) {
 	var client robot.ClientInterface = &mockRobotClient{}
 	servers, err := hetznerapi.ListServers(client)
-	assert.NoError(t, err)
+	assert.Nil(t, err)
 	assert.Len(t, servers, 1)
 	assert.Equal(t, 123456, servers[0].Server.ServerNumber)
 	assert.Equal(t, "test-server", servers[0].Server.ServerName)
@@ -54,7 +54,7 @@ func TestListServers(t *testing.T) {
 func TestRebootServer(t *testing.T) {
 	var client robot.ClientInterface = &mockRobotClient{}
 	err := hetznerapi.RebootServer(client, 123456)
-	assert.NoError(t, err)
+	assert.Nil(t, err)
 }
 
 func TestRebootServerError(t *testing.T) {
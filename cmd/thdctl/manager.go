@@ -0,0 +1,130 @@
+package thdctl
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	baremetalassetv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/baremetalasset/v1alpha"
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/checkpoint"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/eriklundjensen/thdctl/pkg/metrics"
+	"github.com/eriklundjensen/thdctl/pkg/provider"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+type managerFlags struct {
+	stateDir           string
+	concurrency        int
+	robotRate          float64
+	resync             time.Duration
+	leaderElect        bool
+	metricsAddress     string
+	healthProbeAddress string
+	hooks              string
+}
+
+var managerCmdFlags managerFlags
+
+var managerCmd = &cobra.Command{
+	Use:   "manager",
+	Short: "Run the Kubernetes controller reconciling Server resources",
+	Long: `Run the Kubernetes controller reconciling Server and BareMetalAsset resources of the lund.ai/v1alpha1 API.
+The kubeconfig is read from KUBECONFIG, ~/.kube/config or the service account of the pod.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runManager(managerCmdFlags)
+	},
+}
+
+func init() {
+	managerCmd.Flags().StringVar(&managerCmdFlags.stateDir, "state-dir", defaultStateDir(), "directory of the state files used to resume interrupted runs")
+	managerCmd.Flags().IntVarP(&managerCmdFlags.concurrency, "concurrency", "c", 4, "number of servers reconciled at the same time")
+	managerCmd.Flags().Float64Var(&managerCmdFlags.robotRate, "robot-rate", 1, "Robot API requests per second shared by all servers of a Robot user")
+	managerCmd.Flags().DurationVar(&managerCmdFlags.resync, "resync", 10*time.Minute, "interval servers are reconciled at when their spec does not change")
+	managerCmd.Flags().BoolVar(&managerCmdFlags.leaderElect, "leader-elect", false, "enable leader election, only one active manager reconciles servers")
+	managerCmd.Flags().StringVar(&managerCmdFlags.metricsAddress, "metrics-bind-address", ":8080", "address of the metrics endpoint, 0 disables it")
+	managerCmd.Flags().StringVar(&managerCmdFlags.hooks, "hooks", "", "file of the hooks run on state transitions")
+	managerCmd.Flags().StringVar(&managerCmdFlags.healthProbeAddress, "health-probe-bind-address", ":8081", "address of the health and readiness probes")
+	addCommand(managerCmd)
+}
+
+func runManager(flags managerFlags) error {
+	ctrl.SetLogger(zap.New(zap.UseDevMode(logrus.IsLevelEnabled(logrus.DebugLevel))))
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return err
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return err
+	}
+	if err := baremetalassetv1alpha1.AddToScheme(scheme); err != nil {
+		return err
+	}
+
+	ctx := ctrl.SetupSignalHandler()
+	subscribers, stopHooks, err := startHooks(flags.hooks)
+	if err != nil {
+		return err
+	}
+	defer stopHooks()
+
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get kubeconfig: %w", err)
+	}
+	mgr, err := ctrl.NewManager(config, ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsserver.Options{BindAddress: flags.metricsAddress},
+		HealthProbeBindAddress: flags.healthProbeAddress,
+		LeaderElection:         flags.leaderElect,
+		LeaderElectionID:       "thdctl.lund.ai",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create manager: %w", err)
+	}
+
+	// the metrics are served together with the controller-runtime metrics
+	m := metrics.New()
+	if err := m.Register(crmetrics.Registry); err != nil {
+		return fmt.Errorf("failed to register metrics: %w", err)
+	}
+
+	reconciler := &provider.ServerReconciler{
+		Client:                  mgr.GetClient(),
+		NewRobotClient:          provider.RateLimitedClients(flags.robotRate, robotBurst, m),
+		NewSSHClient:            func() hetznerapi.SSHClientInterface { return &hetznerapi.SSHClient{Observer: m} },
+		Checkpoints:             checkpoint.NewFileStore(flags.stateDir),
+		Subscribers:             append(subscribers, m.Subscriber()),
+		Resync:                  flags.resync,
+		MaxConcurrentReconciles: flags.concurrency,
+	}
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("failed to set up server controller: %w", err)
+	}
+	assetReconciler := &provider.BareMetalAssetReconciler{
+		ServerReconciler: *reconciler,
+		ConfigDir:        filepath.Join(flags.stateDir, "configs"),
+	}
+	if err := assetReconciler.SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("failed to set up bare metal asset controller: %w", err)
+	}
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+		return err
+	}
+
+	logrus.Info("Starting manager")
+	return mgr.Start(ctx)
+}
@@ -0,0 +1,52 @@
+package thdctl
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/eriklundjensen/thdctl/pkg/controller"
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+)
+
+// printPlan prints the state of a server and the actions a run would take, mutating actions are marked with *
+func printPlan(out io.Writer, serverNumber int, current controller.ServerStatus, actions []controller.Action) {
+	fmt.Fprintf(out, "Server %d is in state %s\n", serverNumber, current)
+	if len(actions) == 0 {
+		fmt.Fprintln(out, "No actions")
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tSTATE\t\tACTION")
+	for i, action := range actions {
+		mark := ""
+		if action.Mutating {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, action.State, mark, action.Description)
+	}
+	w.Flush()
+	fmt.Fprintln(out, "* changes the server")
+}
+
+// planFromFile prints the plans of the servers of a manifest. Only read only Robot requests are sent and no command
+// is run on the servers.
+func planFromFile(client robot.ClientInterface, path string, options reconcileOptions) error {
+	servers, err := readManifests(path)
+	if err != nil {
+		return err
+	}
+	for i, document := range servers {
+		server := &document.server.Spec.ForProvider
+		sm := controller.NewStateMachine(client, options.newSSHClient(), server, 5)
+		if err := sm.Resume(options.store); err != nil {
+			return err
+		}
+		current, actions := sm.Plan()
+		if i > 0 {
+			fmt.Fprintln(options.out)
+		}
+		printPlan(options.out, server.ServerNumber, current, actions)
+	}
+	return nil
+}
@@ -1,21 +1,47 @@
 package thdctl
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
+	"github.com/eriklundjensen/thdctl/pkg/api/manifest"
 	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/checkpoint"
 	"github.com/eriklundjensen/thdctl/pkg/controller"
 	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/eriklundjensen/thdctl/pkg/hooks"
+	"github.com/eriklundjensen/thdctl/pkg/metrics"
 	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/eriklundjensen/thdctl/pkg/validation"
 	yaml "github.com/goccy/go-yaml"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+// robotBurst is the number of Robot API requests allowed at once before the rate limit applies
+const robotBurst = 5
+
 var (
-	filename string
-	state    string
+	filename    string
+	stateDir    string
+	restart     bool
+	statusFile  string
+	concurrency int
+	robotRate   float64
+	watch       bool
+	resync      time.Duration
+	hooksFile   string
+	metricsAddr string
+	dryRun      bool
 
 	reconcileCmd = &cobra.Command{
 		Use:   "reconcile",
@@ -24,52 +50,401 @@ var (
 			if filename == "" {
 				return fmt.Errorf("filename is required")
 			}
-			sshClient := &hetznerapi.SSHClient{}
-			return reconcileFromFile(RobotClient, sshClient, filename, state)
+			if dryRun {
+				if watch {
+					return fmt.Errorf("--dry-run can not be used with --watch")
+				}
+				options := reconcileOptions{
+					store:        checkpointStore(stateDir, restart),
+					newSSHClient: func() hetznerapi.SSHClientInterface { return &hetznerapi.SSHClient{} },
+					out:          cmd.OutOrStdout(),
+				}
+				return planFromFile(robot.NewRateLimitedClient(RobotClient, robotRate, robotBurst), filename, options)
+			}
+			// running state machines stop and save their progress on interrupt
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			subscribers, stopHooks, err := startHooks(hooksFile)
+			if err != nil {
+				return err
+			}
+			defer stopHooks()
+			var robotClient robot.ClientInterface = RobotClient
+			newSSHClient := func() hetznerapi.SSHClientInterface { return &hetznerapi.SSHClient{} }
+			var m *metrics.Metrics
+			if metricsAddr != "" {
+				if !watch {
+					return fmt.Errorf("--metrics-bind-address requires --watch")
+				}
+				m = metrics.New()
+				robotClient = m.InstrumentRobot(robotClient)
+				newSSHClient = func() hetznerapi.SSHClientInterface { return &hetznerapi.SSHClient{Observer: m} }
+				subscribers = append(subscribers, m.Subscriber())
+			}
+			client := robot.NewRateLimitedClient(robotClient, robotRate, robotBurst)
+			options := reconcileOptions{
+				subscribers:  subscribers,
+				statusFile:   statusFile,
+				store:        checkpointStore(stateDir, restart),
+				concurrency:  concurrency,
+				newSSHClient: newSSHClient,
+				out:          cmd.OutOrStdout(),
+			}
+			if watch {
+				if statusFile != "" {
+					return fmt.Errorf("--status-file can not be used with --watch")
+				}
+				if m != nil {
+					if err := serveMetrics(ctx, metricsAddr, m); err != nil {
+						return err
+					}
+				}
+				return newWatcher(client, filename, options, resync).run(ctx)
+			}
+			return reconcileFromFile(ctx, client, filename, options)
 		},
 	}
 )
 
 func init() {
-	reconcileCmd.Flags().StringVarP(&filename, "filename", "f", "", "filename containing server configuration (required)")
-	reconcileCmd.Flags().StringVarP(&state, "state", "s", "", "initial state of the server (optional)")
+	reconcileCmd.Flags().StringVarP(&filename, "filename", "f", "", "manifest or directory of manifests containing the server configuration (required)")
+	reconcileCmd.Flags().StringVar(&stateDir, "state-dir", defaultStateDir(), "directory of the state files used to resume interrupted runs")
+	reconcileCmd.Flags().BoolVar(&restart, "restart", false, "ignore the state file and determine the state of the server from scratch")
+	reconcileCmd.Flags().StringVar(&statusFile, "status-file", "", "write the observed status to this file instead of the status of the server document")
+	reconcileCmd.Flags().IntVarP(&concurrency, "concurrency", "c", 4, "number of servers reconciled at the same time")
+	reconcileCmd.Flags().Float64Var(&robotRate, "robot-rate", 1, "Robot API requests per second shared by all servers")
+	reconcileCmd.Flags().BoolVarP(&watch, "watch", "w", false, "keep running, reconcile servers when their spec changes and on every resync")
+	reconcileCmd.Flags().DurationVar(&resync, "resync", 10*time.Minute, "interval all servers are reconciled at in watch mode")
+	reconcileCmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the actions of the runs without changing the servers")
+	reconcileCmd.Flags().StringVar(&metricsAddr, "metrics-bind-address", "", "serve Prometheus metrics on /metrics of this address in watch mode, e.g. :8080")
+	reconcileCmd.Flags().StringVar(&hooksFile, "hooks", "", "file of the hooks run on state transitions")
 	reconcileCmd.MarkFlagRequired("filename")
 	addCommand(reconcileCmd)
 }
 
+// serverDocument is a server read from a manifest
+type serverDocument struct {
+	server   *v1alpha1.Server
+	filename string
+	// index of the document in the file, -1 if the status can not be written back into the file
+	index int
+	// item of a ServerList document, -1 for other documents
+	item int
+}
+
+// readServerConfig reads the server parameters of a manifest containing a single server
 func readServerConfig(filename string) (*v1alpha1.ServerParameters, error) {
+	servers, err := readServers(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(servers) != 1 {
+		return nil, fmt.Errorf("%s must contain a single server, found %d", filename, len(servers))
+	}
+	return &servers[0].server.Spec.ForProvider, nil
+}
+
+// readServers reads the servers of a manifest. Server and ServerList documents are accepted, other kinds are skipped.
+// Documents without apiVersion and kind are read as Server if they contain a spec, otherwise as bare server parameters.
+func readServers(filename string) ([]serverDocument, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("error reading file: %v", err)
 	}
 
-	var server v1alpha1.ServerParameters
-	if err := yaml.Unmarshal(data, &server); err != nil {
-		return nil, fmt.Errorf("error parsing yaml: %v", err)
+	documents, err := manifest.DefaultScheme.Decode(data, legacyServer)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filename, err)
+	}
+	if err := validation.ValidateDocuments(documents).ToAggregate(); err != nil {
+		return nil, fmt.Errorf("invalid %s:\n%v", filename, err)
 	}
 
-	if server.TalosImage == "" && server.TalosVersion == "" {
-		return nil, fmt.Errorf("TalosImage or TalosVersion must be set")
+	var servers []serverDocument
+	for _, document := range documents {
+		switch obj := document.Object.(type) {
+		case *v1alpha1.Server:
+			servers = append(servers, serverDocument{server: obj, filename: filename, index: document.Index, item: -1})
+		case *v1alpha1.ServerParameters:
+			servers = append(servers, serverDocument{server: &v1alpha1.Server{Spec: v1alpha1.ServerSpec{ForProvider: *obj}}, filename: filename, index: -1, item: -1})
+		case *v1alpha1.ServerList:
+			for i := range obj.Items {
+				servers = append(servers, serverDocument{server: &obj.Items[i], filename: filename, index: document.Index, item: i})
+			}
+		default:
+			logrus.WithField("kind", document.GroupVersionKind.Kind).Warn("Skipping document, kind is not reconciled")
+		}
 	}
 
-	return &server, nil
+	return servers, nil
 }
 
-func reconcileFromFile(client robot.ClientInterface, sshClient *hetznerapi.SSHClient, filename string, initialState string) error {
-	server, err := readServerConfig(filename)
+// legacyServer decodes a document without apiVersion and kind
+func legacyServer(data []byte) (any, error) {
+	var keys map[string]any
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	if _, ok := keys["spec"]; ok {
+		var server v1alpha1.Server
+		return &server, manifest.Unmarshal(data, &server)
+	}
+	var parameters v1alpha1.ServerParameters
+	return &parameters, manifest.Unmarshal(data, &parameters)
+}
+
+// defaultStateDir returns ~/.thdctl/state, or a relative directory if the home directory is unknown
+func defaultStateDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".thdctl", "state")
+	}
+	return filepath.Join(home, ".thdctl", "state")
+}
+
+// checkpointStore returns the store of the state files. With restart the previous state file of the server is discarded.
+func checkpointStore(dir string, restart bool) controller.CheckpointStore {
+	store := checkpoint.NewFileStore(dir)
+	if restart {
+		return &restartStore{FileStore: store}
+	}
+	return store
+}
+
+// startHooks runs the hooks of a file on the transitions published to the subscriber until stop is called,
+// none when filename is empty. stop waits for the queued hooks, e.g. the hooks reporting an interrupted run.
+func startHooks(filename string) (subscribers []controller.Subscriber, stop func(), err error) {
+	if filename == "" {
+		return nil, func() {}, nil
+	}
+	config, err := hooks.Load(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	runner := config.Start()
+	return []controller.Subscriber{runner.Subscriber()}, runner.Stop, nil
+}
+
+// restartStore ignores existing state files
+type restartStore struct {
+	*checkpoint.FileStore
+}
+
+func (s *restartStore) Load(serverNumber int) (*checkpoint.Checkpoint, error) {
+	return nil, nil
+}
+
+// reconcileOptions are the options of a reconcile run
+type reconcileOptions struct {
+	// statusFile receives the status instead of the server document, it requires a single server
+	statusFile  string
+	store       controller.CheckpointStore
+	concurrency int
+	// newSSHClient creates the SSH client of a server, each server needs its own client
+	newSSHClient func() hetznerapi.SSHClientInterface
+	// subscribers receive the state transitions of all servers
+	subscribers []controller.Subscriber
+	// out receives the summary table
+	out io.Writer
+}
+
+// reconcileResult is the outcome of the reconcile of a server
+type reconcileResult struct {
+	serverNumber int
+	status       v1alpha1.ServerStatus
+	duration     time.Duration
+	err          error
+}
+
+// readManifests reads the servers of a manifest, or of all manifests (*.yaml, *.yml) in a directory.
+// A server must only be defined once, two runs must never act on the same server.
+func readManifests(path string) ([]serverDocument, error) {
+	files := []string{path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	if info.IsDir() {
+		files = nil
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(path, pattern))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, matches...)
+		}
+		sort.Strings(files)
+	}
+
+	var servers []serverDocument
+	defined := map[int]string{}
+	for _, file := range files {
+		documents, err := readServers(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, document := range documents {
+			serverNumber := document.server.Spec.ForProvider.ServerNumber
+			if previous, ok := defined[serverNumber]; ok {
+				return nil, fmt.Errorf("server %d is defined in %s and %s", serverNumber, previous, file)
+			}
+			defined[serverNumber] = file
+		}
+		servers = append(servers, documents...)
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no servers found in %s", path)
+	}
+	return servers, nil
+}
+
+// reconcileFromFile runs the state machines of all servers of the manifests concurrently. A failing server
+// does not stop the others. The status is written back into Server documents, or to the status file when set.
+func reconcileFromFile(ctx context.Context, client robot.ClientInterface, path string, options reconcileOptions) error {
+	servers, err := readManifests(path)
 	if err != nil {
 		return err
 	}
+	if options.statusFile != "" && len(servers) != 1 {
+		return fmt.Errorf("--status-file requires a single server, %s contains %d", path, len(servers))
+	}
+
+	results := make([]reconcileResult, len(servers))
+	forEachConcurrently(len(servers), options.concurrency, func(i int) {
+		document := servers[i]
+		start := time.Now()
+		status, err := reconcileServer(ctx, client, options.newSSHClient(), document, options)
+		results[i] = reconcileResult{
+			serverNumber: document.server.Spec.ForProvider.ServerNumber,
+			status:       status,
+			duration:     time.Since(start),
+			err:          err,
+		}
+	})
+	printSummary(options.out, results)
+
+	var failed []int
+	for _, result := range results {
+		if result.err != nil {
+			failed = append(failed, result.serverNumber)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to reconcile servers: %v", failed)
+	}
+	return nil
+}
+
+// forEachConcurrently calls fn for 0..count-1 with at most limit calls running at the same time
+func forEachConcurrently(count, limit int, fn func(i int)) {
+	if limit < 1 {
+		limit = 1
+	}
+	semaphore := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
+
+// printSummary prints a table with the state and the result of each server
+func printSummary(out io.Writer, results []reconcileResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tSTATE\tTALOS\tDURATION\tRESULT")
+	for _, result := range results {
+		outcome := "ok"
+		if result.err != nil {
+			outcome = result.err.Error()
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", result.serverNumber, result.status.State, result.status.Talos.Version,
+			result.duration.Round(time.Second), outcome)
+	}
+	w.Flush()
+}
+
+func reconcileServer(ctx context.Context, client robot.ClientInterface, sshClient hetznerapi.SSHClientInterface, document serverDocument, options reconcileOptions) (v1alpha1.ServerStatus, error) {
+	server := &document.server.Spec.ForProvider
+	log := logrus.WithField("server", server.ServerNumber)
 
-	logrus.Infof("Read configuration for server %d", server.ServerNumber)
+	log.Info("Read configuration for server")
 
 	sm := controller.NewStateMachine(client, sshClient, server, 5)
-	if initialState != "" {
-		sm.StateChange(controller.ServerStatus(initialState))
+	for _, subscriber := range options.subscribers {
+		sm.Subscribe(subscriber)
+	}
+	if options.statusFile != "" {
+		previous, err := readStatus(options.statusFile)
+		if err != nil {
+			return v1alpha1.ServerStatus{}, err
+		}
+		sm.SetStatus(*previous)
+	} else if document.index >= 0 {
+		sm.SetStatus(document.server.Status)
 	}
-	if err := sm.Run(); err != nil {
-		return fmt.Errorf("failed to run state machine: %v", err)
+	if err := sm.Resume(options.store); err != nil {
+		return sm.Status(), err
 	}
+	err := sm.Run(ctx)
 
-	return nil
+	status := sm.Status()
+	if details, err := hetznerapi.GetServerDetails(client, server.ServerNumber); err == nil {
+		status.Details = *details
+	}
+	logServerStatus(log, status)
+	switch {
+	case options.statusFile != "":
+		if err := writeStatus(options.statusFile, 0, status); err != nil {
+			log.WithError(err).Error("Failed to write status")
+		}
+	case document.item >= 0:
+		if err := writeItemStatus(document.filename, document.index, document.item, status); err != nil {
+			log.WithError(err).Error("Failed to write status")
+		}
+	case document.index >= 0:
+		if err := writeStatus(document.filename, document.index, status); err != nil {
+			log.WithError(err).Error("Failed to write status")
+		}
+	default:
+		log.WithField("file", document.filename).Warn("The status is not written back into server parameters without kind, use a Server document or --status-file")
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to reconcile server")
+		return status, fmt.Errorf("failed to run state machine: %v", err)
+	}
+
+	return status, nil
+}
+
+func logServerStatus(log *logrus.Entry, status v1alpha1.ServerStatus) {
+	fields := logrus.Fields{
+		"ID":         status.Details.ServerNumber,
+		"Name":       status.Details.ServerName,
+		"Product":    status.Details.Product,
+		"Datacenter": status.Details.Datacenter,
+		"IPv4":       status.Details.ServerIP,
+		"State":      status.State,
+	}
+	if health := status.DiskHealth; health != nil {
+		fields["Disk"] = health.Disk
+		fields["DiskHealthPassed"] = health.Passed
+		fields["ReallocatedSectors"] = health.ReallocatedSectors
+		fields["MediaErrors"] = health.MediaErrors
+		fields["PercentageUsed"] = health.PercentageUsed
+	}
+	if status.Talos.Version != "" {
+		fields["TalosVersion"] = status.Talos.Version
+	}
+	if upgrade := status.Talos.Upgrade; upgrade != nil {
+		fields["UpgradedFrom"] = upgrade.FromVersion
+		fields["UpgradedTo"] = upgrade.ToVersion
+		fields["UpgradeCompleted"] = upgrade.Completed
+	}
+	log.WithFields(fields).Info("Server status")
 }
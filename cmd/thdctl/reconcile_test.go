@@ -0,0 +1,120 @@
+package thdctl
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi/sshtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func writeManifest(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	filename := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+	return filename
+}
+
+func TestReadManifestsDirectory(t *testing.T) {
+	dir := t.TempDir()
+	node2 := writeManifest(t, dir, "node2.yml", "serverNumber: 2\ndisk: sda\ntalosVersion: v1.9.2\n")
+	node1 := writeManifest(t, dir, "node1.yaml", "apiVersion: lund.ai/v1alpha1\nkind: ServerList\nitems:\n"+
+		"- spec:\n    forProvider:\n      serverNumber: 1\n      disk: sda\n      talosVersion: v1.9.2\n"+
+		"- spec:\n    forProvider:\n      serverNumber: 3\n      disk: sda\n      talosVersion: v1.9.2\n")
+	writeManifest(t, dir, "README.md", "not a manifest")
+
+	servers, err := readManifests(dir)
+
+	require.NoError(t, err)
+	var numbers []int
+	var files []string
+	for _, server := range servers {
+		numbers = append(numbers, server.server.Spec.ForProvider.ServerNumber)
+		files = append(files, server.filename)
+	}
+	assert.Equal(t, []int{1, 3, 2}, numbers)
+	assert.Equal(t, []string{node1, node1, node2}, files)
+}
+
+func TestReadManifestsRejectsDuplicateServers(t *testing.T) {
+	dir := t.TempDir()
+	writeManifest(t, dir, "a.yaml", "serverNumber: 1\ndisk: sda\ntalosVersion: v1.9.2\n")
+	writeManifest(t, dir, "b.yaml", "serverNumber: 1\ndisk: nvme0n1\ntalosVersion: v1.9.2\n")
+
+	_, err := readManifests(dir)
+
+	assert.ErrorContains(t, err, "server 1 is defined in")
+}
+
+func TestForEachConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	called := make([]bool, 10)
+
+	forEachConcurrently(len(called), 3, func(i int) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+		called[i] = true
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	assert.Equal(t, 3, maxRunning)
+	assert.NotContains(t, called, false)
+}
+
+func TestPrintSummary(t *testing.T) {
+	var out bytes.Buffer
+	printSummary(&out, []reconcileResult{
+		{serverNumber: 1, status: v1alpha1.ServerStatus{State: "KubernetesAvailable", Talos: v1alpha1.TalosStatus{Version: "v1.9.2"}}, duration: 90 * time.Second},
+		{serverNumber: 22, status: v1alpha1.ServerStatus{State: "ServerNotFound"}, err: errors.New("failed to reach a valid state")},
+	})
+
+	assert.Equal(t, "SERVER  STATE                TALOS   DURATION  RESULT\n"+
+		"1       KubernetesAvailable  v1.9.2  1m30s     ok\n"+
+		"22      ServerNotFound               0s        failed to reach a valid state\n", out.String())
+}
+
+func TestPlanFromFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := writeManifest(t, dir, "node1.yaml", "serverNumber: 1\ndisk: sda\ntalosVersion: v1.9.2\n")
+	client := new(MockClient)
+	client.On("Get", "boot/1/rescue").Return([]byte(`{"rescue": {"active": true, "server_ip": "192.0.2.10"}}`), nil)
+	var out bytes.Buffer
+	options := reconcileOptions{
+		store:        checkpointStore(t.TempDir(), false),
+		newSSHClient: func() hetznerapi.SSHClientInterface { return new(sshtest.MockClient) },
+		out:          &out,
+	}
+
+	require.NoError(t, planFromFile(client, filename, options))
+
+	client.AssertNotCalled(t, "Post", mock.Anything, mock.Anything)
+	assert.Equal(t, "Server 1 is in state RescueModeInitiated\n"+
+		"STEP  STATE                   ACTION\n"+
+		"1     RescueModeInitiated     GET boot/1/rescue: wait for the rescue system to be active\n"+
+		"2     RequiresReboot       *  POST reset/1 type=sw: reset the server into the rescue system, escalating to hw and power while SSH does not come back\n"+
+		"3     WaitForReboot           wait for SSH of the rescue system\n"+
+		"4     SSHAvailable            check that /dev/sda exists\n"+
+		"5     SSHAvailable            download https://github.com/siderolabs/talos/releases/download/v1.9.2/metal-amd64.raw.zst to /tmp/talos.raw.xz\n"+
+		"6     SSHAvailable         *  write the image to /dev/sda\n"+
+		"7     SSHAvailable            verify the Talos partitions of /dev/sda\n"+
+		"8     SSHAvailable         *  POST reset/1 type=hw: boot Talos\n"+
+		"9     TalosImageInstalled     wait for the Talos API on port 50000\n"+
+		"* changes the server\n", out.String())
+}
@@ -0,0 +1,94 @@
+package thdctl
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/eriklundjensen/thdctl/pkg/validation"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// resetTypeWakeOnLAN sends a Wake-on-LAN packet instead of a reset
+const resetTypeWakeOnLAN = "wol"
+
+type resetFlags struct {
+	resetType string
+	list      bool
+}
+
+var resetCmdFlags resetFlags
+
+var resetCmd = &cobra.Command{
+	Use:   "reset <serverNumber>",
+	Short: "Reset a server or send a Wake-on-LAN packet",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		serverNumber, err := strconv.Atoi(args[0])
+		if err != nil {
+			logrus.WithError(err).Error("Error parsing server number")
+			return err
+		}
+		if err := validation.ValidateServerNumber(serverNumber, "serverNumber").ToAggregate(); err != nil {
+			return err
+		}
+		if resetCmdFlags.list {
+			return listResetTypes(cmd.OutOrStdout(), RobotClient, serverNumber)
+		}
+		return resetServer(RobotClient, serverNumber, resetCmdFlags.resetType)
+	},
+}
+
+func init() {
+	resetCmd.Flags().StringVarP(&resetCmdFlags.resetType, "type", "t", hetznerapi.ResetHardware,
+		fmt.Sprintf("reset type, one of %s. %s sends a Wake-on-LAN packet", strings.Join(hetznerapi.ResetTypes, ", "), resetTypeWakeOnLAN))
+	resetCmd.Flags().BoolVar(&resetCmdFlags.list, "list", false, "list the reset types supported by the server")
+	addCommand(resetCmd)
+}
+
+// listResetTypes prints the reset types supported by the server
+func listResetTypes(out io.Writer, client robot.ClientInterface, serverNumber int) error {
+	reset, err := hetznerapi.GetResetTypes(client, serverNumber)
+	if err != nil {
+		logrus.WithError(err).Error("Error getting reset types")
+		return err
+	}
+	fmt.Fprintf(out, "Reset types of server %d: %s\n", serverNumber, strings.Join(reset.Reset.Type, ", "))
+	if reset.Reset.OperatingStatus != "" {
+		fmt.Fprintf(out, "Operating status: %s\n", reset.Reset.OperatingStatus)
+	}
+	return nil
+}
+
+// resetServer resets the server after checking the server supports the reset type
+func resetServer(client robot.ClientInterface, serverNumber int, resetType string) error {
+	if resetType == resetTypeWakeOnLAN {
+		if err := hetznerapi.WakeOnLAN(client, serverNumber); err != nil {
+			logrus.WithError(err).Error("Error sending Wake-on-LAN packet")
+			return err
+		}
+		return nil
+	}
+	if !slices.Contains(hetznerapi.ResetTypes, resetType) {
+		return fmt.Errorf("unknown reset type %q, use one of %s or %s", resetType, strings.Join(hetznerapi.ResetTypes, ", "), resetTypeWakeOnLAN)
+	}
+
+	reset, err := hetznerapi.GetResetTypes(client, serverNumber)
+	if err != nil {
+		logrus.WithError(err).Error("Error getting reset types")
+		return err
+	}
+	if !reset.Reset.Supports(resetType) {
+		return fmt.Errorf("server %d does not support reset type %q, supported types: %s", serverNumber, resetType, strings.Join(reset.Reset.Type, ", "))
+	}
+	if err := hetznerapi.ResetServer(client, serverNumber, resetType); err != nil {
+		logrus.WithError(err).Error("Error resetting server")
+		return err
+	}
+	return nil
+}
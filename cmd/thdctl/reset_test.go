@@ -0,0 +1,61 @@
+package thdctl
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const resetTypesResponse = `{"reset": {"server_ip": "192.0.2.10", "server_number": 12345, "type": ["sw", "hw", "man"], "operating_status": "not supported"}}`
+
+func TestResetServer(t *testing.T) {
+	client := new(MockClient)
+	client.On("Get", "reset/12345").Return([]byte(resetTypesResponse), nil)
+	client.On("Post", "reset/12345", url.Values{"type": {"sw"}}).Return([]byte(`{"reset": {"server_ip": "192.0.2.10", "type": "sw"}}`), nil)
+
+	require.NoError(t, resetServer(client, 12345, "sw"))
+
+	client.AssertExpectations(t)
+}
+
+func TestResetServerUnsupportedType(t *testing.T) {
+	client := new(MockClient)
+	client.On("Get", "reset/12345").Return([]byte(resetTypesResponse), nil)
+
+	err := resetServer(client, 12345, "power")
+
+	assert.EqualError(t, err, `server 12345 does not support reset type "power", supported types: sw, hw, man`)
+	client.AssertNotCalled(t, "Post", mock.Anything, mock.Anything)
+}
+
+func TestResetServerUnknownType(t *testing.T) {
+	client := new(MockClient)
+
+	err := resetServer(client, 12345, "reboot")
+
+	assert.EqualError(t, err, `unknown reset type "reboot", use one of sw, hw, power, power_long, man or wol`)
+	client.AssertNotCalled(t, "Get", mock.Anything)
+}
+
+func TestResetServerWakeOnLAN(t *testing.T) {
+	client := new(MockClient)
+	client.On("Post", "wol/12345", url.Values{}).Return([]byte(`{"wol": {"server_ip": "192.0.2.10", "server_number": 12345}}`), nil)
+
+	require.NoError(t, resetServer(client, 12345, "wol"))
+
+	client.AssertExpectations(t)
+}
+
+func TestListResetTypes(t *testing.T) {
+	client := new(MockClient)
+	client.On("Get", "reset/12345").Return([]byte(resetTypesResponse), nil)
+	var out bytes.Buffer
+
+	require.NoError(t, listResetTypes(&out, client, 12345))
+
+	assert.Equal(t, "Reset types of server 12345: sw, hw, man\nOperating status: not supported\n", out.String())
+}
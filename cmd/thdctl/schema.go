@@ -0,0 +1,90 @@
+package thdctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eriklundjensen/thdctl/pkg/api/manifest"
+	"github.com/eriklundjensen/thdctl/pkg/api/meta"
+	"github.com/eriklundjensen/thdctl/pkg/api/schema"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var schemaOutputDir string
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema [kind]",
+	Short: "Print the JSON schema of a manifest or a single kind, e.g. Server",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if schemaOutputDir != "" {
+			return writeSchemas(manifest.DefaultScheme, schemaOutputDir)
+		}
+		kind := ""
+		if len(args) == 1 {
+			kind = args[0]
+		}
+		return printSchema(cmd.OutOrStdout(), manifest.DefaultScheme, kind)
+	},
+}
+
+func init() {
+	schemaCmd.Flags().StringVarP(&schemaOutputDir, "output", "o", "", "directory the schemas of the manifest and of all kinds are written to")
+	addCommand(schemaCmd)
+}
+
+// printSchema prints the schema of a kind, or of a manifest document of any kind if kind is empty
+func printSchema(w io.Writer, scheme *manifest.Scheme, kind string) error {
+	var s *schema.Schema
+	var err error
+	if kind == "" {
+		s, err = schema.Manifest(scheme)
+	} else {
+		s, err = schema.For(scheme, meta.GroupVersionKind{Group: meta.Group, Version: manifest.Version, Kind: kind})
+	}
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// writeSchemas writes manifest.schema.json and a <kind>.schema.json file for each kind
+func writeSchemas(scheme *manifest.Scheme, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	kinds := []string{""}
+	for _, gvk := range scheme.KnownKinds() {
+		kinds = append(kinds, gvk.Kind)
+	}
+	for _, kind := range kinds {
+		name := "manifest"
+		if kind != "" {
+			name = strings.ToLower(kind)
+		}
+		filename := filepath.Join(dir, name+".schema.json")
+		file, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		err = printSchema(file, scheme, kind)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", filename, err)
+		}
+		logrus.WithField("file", filename).Info("Schema written")
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package thdctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eriklundjensen/thdctl/pkg/api/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintSchema(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, printSchema(&out, manifest.DefaultScheme, "Server"))
+
+	var s map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &s))
+	assert.Equal(t, "Server", s["title"])
+
+	assert.ErrorContains(t, printSchema(&out, manifest.DefaultScheme, "Machine"), "unknown kind")
+}
+
+func TestWriteSchemas(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, writeSchemas(manifest.DefaultScheme, dir))
+
+	for _, name := range []string{"manifest", "server", "serverlist", "cluster", "firewall"} {
+		assert.FileExists(t, filepath.Join(dir, name+".schema.json"))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.schema.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"oneOf"`)
+}
@@ -0,0 +1,202 @@
+package thdctl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/eriklundjensen/thdctl/pkg/api/manifest"
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	yaml "github.com/goccy/go-yaml"
+)
+
+// writeStatusMu serializes status writes of servers reconciled concurrently, they may share a file
+var writeStatusMu sync.Mutex
+
+// statusDocument is the status section of a server document
+type statusDocument struct {
+	Status v1alpha1.ServerStatus `json:"status"`
+}
+
+// readStatus reads the status section of a file. An empty status is returned if the file does not exist.
+func readStatus(filename string) (*v1alpha1.ServerStatus, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &v1alpha1.ServerStatus{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading status file: %v", err)
+	}
+	var document statusDocument
+	if err := manifest.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("error parsing status file: %v", err)
+	}
+	return &document.Status, nil
+}
+
+// writeStatus replaces the top level status section of a document of a YAML file, or appends it when missing.
+// The rest of the file including comments is kept as is. The file is created if it does not exist.
+func writeStatus(filename string, index int, status v1alpha1.ServerStatus) error {
+	writeStatusMu.Lock()
+	defer writeStatusMu.Unlock()
+
+	data, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	section, err := yaml.Marshal(&statusDocument{Status: status})
+	if err != nil {
+		return err
+	}
+	documents := manifest.SplitDocuments(data)
+	if index >= len(documents) {
+		return fmt.Errorf("document %d not found in %s", index+1, filename)
+	}
+	documents[index] = replaceSection(documents[index], "status", section)
+	return os.WriteFile(filename, manifest.JoinDocuments(data, documents), 0o644)
+}
+
+// replaceSection replaces the lines of a top level key with section
+func replaceSection(data []byte, key string, section []byte) []byte {
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	start := -1
+	for i, line := range lines {
+		if bytes.HasPrefix(line, []byte(key+":")) {
+			start = i
+			break
+		}
+	}
+
+	if start < 0 {
+		if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+			data = append(data, '\n')
+		}
+		return append(data, section...)
+	}
+
+	// The section ends before the next top level line. Trailing blank lines are kept.
+	end := start + 1
+	last := start + 1
+	for ; end < len(lines); end++ {
+		line := lines[end]
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			break
+		}
+		last = end + 1
+	}
+
+	var result []byte
+	for _, line := range lines[:start] {
+		result = append(result, line...)
+	}
+	result = append(result, section...)
+	for _, line := range lines[last:] {
+		result = append(result, line...)
+	}
+	return result
+}
+
+// writeItemStatus replaces the status section of an item of a list document, e.g. a ServerList, or appends it when missing.
+// The rest of the file including comments is kept as is.
+func writeItemStatus(filename string, index, item int, status v1alpha1.ServerStatus) error {
+	writeStatusMu.Lock()
+	defer writeStatusMu.Unlock()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	section, err := yaml.Marshal(&statusDocument{Status: status})
+	if err != nil {
+		return err
+	}
+	documents := manifest.SplitDocuments(data)
+	if index >= len(documents) {
+		return fmt.Errorf("document %d not found in %s", index+1, filename)
+	}
+	document, err := replaceItemSection(documents[index], "items", item, "status", section)
+	if err != nil {
+		return fmt.Errorf("document %d of %s: %v", index+1, filename, err)
+	}
+	documents[index] = document
+	return os.WriteFile(filename, manifest.JoinDocuments(data, documents), 0o644)
+}
+
+// replaceItemSection replaces the lines of a key of an item of a top level block sequence with section.
+// The item is unindented, its section is replaced by replaceSection and the item is indented again.
+func replaceItemSection(data []byte, list string, item int, key string, section []byte) ([]byte, error) {
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	start := slices.IndexFunc(lines, func(line []byte) bool { return bytes.HasPrefix(line, []byte(list+":")) })
+	if start < 0 {
+		return nil, fmt.Errorf("%s not found", list)
+	}
+
+	// The items start with a dash at the indentation of the first item. The sequence ends before a line
+	// indented less or a line at the same indentation which is not an item, e.g. the next top level key.
+	indent := -1
+	end := len(lines)
+	var items []int
+	for i := start + 1; i < len(lines); i++ {
+		trimmed := bytes.TrimLeft(lines[i], " ")
+		if len(bytes.TrimSpace(trimmed)) == 0 || trimmed[0] == '#' {
+			continue
+		}
+		n := len(lines[i]) - len(trimmed)
+		if indent < 0 {
+			indent = n
+		}
+		isItem := trimmed[0] == '-' && (len(trimmed) == 1 || trimmed[1] == ' ' || trimmed[1] == '\n')
+		if n < indent || (n == indent && !isItem) {
+			end = i
+			break
+		}
+		if n == indent {
+			items = append(items, i)
+		}
+	}
+	if item >= len(items) {
+		return nil, fmt.Errorf("item %d of %s not found", item+1, list)
+	}
+	itemEnd := end
+	if item+1 < len(items) {
+		itemEnd = items[item+1]
+	}
+
+	itemIndent := indent + 2
+	var unindented []byte
+	for i, line := range lines[items[item]:itemEnd] {
+		if i == 0 {
+			line = append(bytes.Repeat([]byte(" "), indent+1), line[indent+1:]...)
+		}
+		n := len(line) - len(bytes.TrimLeft(line, " "))
+		unindented = append(unindented, line[min(n, itemIndent):]...)
+	}
+	replaced := bytes.SplitAfter(replaceSection(unindented, key, section), []byte("\n"))
+
+	var result []byte
+	for _, line := range lines[:items[item]] {
+		result = append(result, line...)
+	}
+	for i, line := range replaced {
+		switch {
+		case i == 0:
+			result = append(result, bytes.Repeat([]byte(" "), indent)...)
+			result = append(result, "- "...)
+		case len(bytes.TrimSpace(line)) > 0:
+			result = append(result, bytes.Repeat([]byte(" "), itemIndent)...)
+		}
+		result = append(result, line...)
+	}
+	for _, line := range lines[itemEnd:] {
+		result = append(result, line...)
+	}
+	return result, nil
+}
@@ -0,0 +1,181 @@
+package thdctl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testServerDocument = `# node1 of demo-1
+spec:
+  forProvider:
+    serverNumber: 123456
+    disk: sda
+    talosVersion: v1.9.2 # pinned
+status:
+  state: Unknown
+  lastError: failed
+
+# end of document
+`
+
+func testStatus() v1alpha1.ServerStatus {
+	transition := time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC)
+	return v1alpha1.ServerStatus{
+		State:              "WaitingForBootstrap",
+		LastTransitionTime: &transition,
+		Talos:              v1alpha1.TalosStatus{Version: "v1.9.2"},
+	}
+}
+
+func TestWriteStatusInPlace(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "server.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(testServerDocument), 0o644))
+
+	require.NoError(t, writeStatus(filename, 0, testStatus()))
+
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# node1 of demo-1\nspec:\n  forProvider:\n    serverNumber: 123456\n    disk: sda\n    talosVersion: v1.9.2 # pinned\nstatus:\n")
+	assert.NotContains(t, string(data), "lastError")
+	assert.Contains(t, string(data), "\n\n# end of document\n")
+
+	servers, err := readServers(filename)
+	require.NoError(t, err)
+	assert.Equal(t, 0, servers[0].index)
+	assert.Equal(t, 123456, servers[0].server.Spec.ForProvider.ServerNumber)
+	assert.Equal(t, testStatus(), servers[0].server.Status)
+}
+
+func TestWriteStatusAppendsSection(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "server.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("spec:\n  forProvider:\n    serverNumber: 1\n    disk: sda\n    talosVersion: v1.9.2"), 0o644))
+
+	require.NoError(t, writeStatus(filename, 0, testStatus()))
+
+	servers, err := readServers(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "WaitingForBootstrap", servers[0].server.Status.State)
+}
+
+func TestWriteStatusSidecar(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "server.status.yaml")
+
+	status, err := readStatus(filename)
+	require.NoError(t, err)
+	assert.Equal(t, &v1alpha1.ServerStatus{}, status)
+
+	require.NoError(t, writeStatus(filename, 0, testStatus()))
+	status, err = readStatus(filename)
+	require.NoError(t, err)
+	assert.Equal(t, testStatus(), *status)
+}
+
+func TestReadServerParameters(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "server.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("serverNumber: 1\ndisk: sda\ntalosVersion: v1.9.2\n"), 0o644))
+
+	servers, err := readServers(filename)
+
+	require.NoError(t, err)
+	assert.Equal(t, -1, servers[0].index)
+	assert.Equal(t, "v1.9.2", servers[0].server.Spec.ForProvider.TalosVersion)
+}
+
+const serverManifest = `apiVersion: lund.ai/v1alpha1
+kind: Server
+spec:
+  forProvider:
+    serverNumber: 1
+    disk: sda
+    talosVersion: v1.9.2
+---
+apiVersion: lund.ai/v1alpha1
+kind: Server
+spec:
+  forProvider:
+    serverNumber: 2
+    disk: sda
+    talosVersion: v1.9.2
+status:
+  state: Unknown
+`
+
+func TestWriteStatusMultiDocument(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "servers.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(serverManifest), 0o644))
+
+	require.NoError(t, writeStatus(filename, 1, testStatus()))
+
+	servers, err := readServers(filename)
+	require.NoError(t, err)
+	require.Len(t, servers, 2)
+	assert.Equal(t, v1alpha1.ServerStatus{}, servers[0].server.Status)
+	assert.Equal(t, testStatus(), servers[1].server.Status)
+	assert.Equal(t, 1, servers[1].index)
+}
+
+func TestReadServersRejectsUnknownFields(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "server.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("serverNumber: 1\ntalosVersion: v1.9.2\ntalsoImage: some\n"), 0o644))
+
+	_, err := readServers(filename)
+
+	assert.ErrorContains(t, err, "talsoImage")
+}
+
+const serverListManifest = `apiVersion: lund.ai/v1alpha1
+kind: ServerList
+items:
+# the first server
+- spec:
+    forProvider:
+      serverNumber: 1
+      disk: sda
+      talosVersion: v1.9.2
+  status:
+    state: Unknown
+
+- apiVersion: lund.ai/v1alpha1
+  kind: Server
+  spec:
+    forProvider:
+      serverNumber: 2
+      disk: sda
+      talosVersion: v1.9.2
+`
+
+func TestWriteItemStatus(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "servers.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(serverListManifest), 0o644))
+
+	require.NoError(t, writeItemStatus(filename, 0, 1, testStatus()))
+	require.NoError(t, writeItemStatus(filename, 0, 0, testStatus()))
+
+	servers, err := readServers(filename)
+	require.NoError(t, err)
+	require.Len(t, servers, 2)
+	for i, server := range servers {
+		assert.Equal(t, testStatus(), server.server.Status)
+		assert.Equal(t, 0, server.index)
+		assert.Equal(t, i, server.item)
+	}
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# the first server\n- spec:\n")
+	assert.Contains(t, string(data), "\n\n- apiVersion: lund.ai/v1alpha1\n  kind: Server\n")
+}
+
+func TestWriteItemStatusItemNotFound(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "servers.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(serverListManifest), 0o644))
+
+	err := writeItemStatus(filename, 0, 2, testStatus())
+
+	assert.ErrorContains(t, err, "item 3 of items not found")
+}
@@ -0,0 +1,62 @@
+package thdctl
+
+import (
+	"fmt"
+	"os"
+
+	clusterv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/cluster/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/api/manifest"
+	"github.com/eriklundjensen/thdctl/pkg/validation"
+	yaml "github.com/goccy/go-yaml"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var validateFilename string
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate a manifest without accessing any server",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return validateManifest(validateFilename)
+	},
+}
+
+func init() {
+	validateCmd.Flags().StringVarP(&validateFilename, "filename", "f", "", "filename of the manifest (required)")
+	validateCmd.MarkFlagRequired("filename")
+	addCommand(validateCmd)
+}
+
+// validateManifest validates all documents of a manifest and reports all errors at once
+func validateManifest(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("error reading file: %v", err)
+	}
+	documents, err := manifest.DefaultScheme.Decode(data, legacyDocument)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %v", filename, err)
+	}
+	if err := validation.ValidateDocuments(documents).ToAggregate(); err != nil {
+		return fmt.Errorf("invalid %s:\n%v", filename, err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"file":      filename,
+		"documents": len(documents),
+	}).Info("Manifest is valid")
+	return nil
+}
+
+// legacyDocument decodes a document without apiVersion and kind as cluster definition or server
+func legacyDocument(data []byte) (any, error) {
+	var keys map[string]any
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	if _, ok := keys["clusterName"]; ok {
+		var parameters clusterv1alpha1.ClusterParameters
+		return &parameters, manifest.Unmarshal(data, &parameters)
+	}
+	return legacyServer(data)
+}
@@ -0,0 +1,32 @@
+package thdctl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateManifestSamples(t *testing.T) {
+	assert.NoError(t, validateManifest("../../talos/serverSpec.yaml"))
+	assert.NoError(t, validateManifest("../../talos/clusterSpec.yaml"))
+}
+
+func TestValidateManifestReportsAllErrors(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "servers.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(`serverNumber: 1
+disk: "sda; reboot"
+talosVersion: v1.9.2
+---
+clusterName: demo-1
+endpoint: https://192.0.2.10:6443
+nodes: []
+`), 0o644))
+
+	err := validateManifest(filename)
+
+	assert.ErrorContains(t, err, `document 1: disk: invalid value "sda; reboot"`)
+	assert.ErrorContains(t, err, "document 2: nodes: required")
+}
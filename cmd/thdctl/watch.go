@@ -0,0 +1,250 @@
+package thdctl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// watchDebounce is the time to wait for more changes after a manifest changed, editors often write a file several times
+const watchDebounce = time.Second
+
+// watcher keeps reconciling the servers of the manifests. A server is reconciled when its spec changes
+// and on every resync. Each server is driven by its own worker, at most concurrency servers run at the same time.
+type watcher struct {
+	client  robot.ClientInterface
+	path    string
+	options reconcileOptions
+	resync  time.Duration
+	// reconcile runs the state machine of a server until it completes or ctx is cancelled
+	reconcile func(ctx context.Context, document serverDocument)
+
+	semaphore chan struct{}
+	wg        sync.WaitGroup
+	workers   map[int]*serverWorker
+}
+
+// serverWorker runs the state machine of a server when it is triggered
+type serverWorker struct {
+	trigger chan struct{}
+	// ctx is cancelled when the server is removed from the manifests
+	ctx  context.Context
+	stop context.CancelFunc
+
+	mu       sync.Mutex
+	document serverDocument
+	// cancelRun stops the running reconcile, nil while the server is not reconciled
+	cancelRun context.CancelFunc
+}
+
+func newWatcher(client robot.ClientInterface, path string, options reconcileOptions, resync time.Duration) *watcher {
+	concurrency := options.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	w := &watcher{
+		client:    client,
+		path:      path,
+		options:   options,
+		resync:    resync,
+		semaphore: make(chan struct{}, concurrency),
+		workers:   map[int]*serverWorker{},
+	}
+	w.reconcile = func(ctx context.Context, document serverDocument) {
+		reconcileServer(ctx, w.client, w.options.newSSHClient(), document, w.options)
+	}
+	return w
+}
+
+// run reconciles all servers and watches the manifests until ctx is cancelled.
+// Running reconciles are stopped and have saved their progress when run returns.
+func (w *watcher) run(ctx context.Context) error {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsWatcher.Close()
+	if err := fsWatcher.Add(w.watchDir()); err != nil {
+		return fmt.Errorf("failed to watch %s: %v", w.path, err)
+	}
+
+	if err := w.load(ctx); err != nil {
+		return err
+	}
+	logrus.WithFields(logrus.Fields{
+		"path":   w.path,
+		"resync": w.resync,
+	}).Info("Watching server manifests")
+
+	resync := time.NewTicker(w.resync)
+	defer resync.Stop()
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logrus.Info("Stopping, waiting for running reconciles to complete")
+			w.wg.Wait()
+			return nil
+		case event := <-fsWatcher.Events:
+			if w.relevant(event) {
+				debounce.Reset(watchDebounce)
+			}
+		case err := <-fsWatcher.Errors:
+			logrus.WithError(err).Warn("Error watching server manifests")
+		case <-debounce.C:
+			if err := w.load(ctx); err != nil {
+				logrus.WithError(err).Error("Failed to read server manifests, keeping the previous specs")
+			}
+		case <-resync.C:
+			logrus.Info("Resync of all servers")
+			for _, worker := range w.workers {
+				worker.notify()
+			}
+		}
+	}
+}
+
+// watchDir returns the watched directory. Files are watched through their directory, editors often replace files.
+func (w *watcher) watchDir() string {
+	if info, err := os.Stat(w.path); err == nil && info.IsDir() {
+		return w.path
+	}
+	return filepath.Dir(w.path)
+}
+
+// relevant reports whether an event changes one of the manifests
+func (w *watcher) relevant(event fsnotify.Event) bool {
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Remove) && !event.Has(fsnotify.Rename) {
+		return false
+	}
+	if w.watchDir() != w.path {
+		return filepath.Clean(event.Name) == filepath.Clean(w.path)
+	}
+	ext := filepath.Ext(event.Name)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// load reads the manifests and triggers the servers with a new or changed spec.
+// Status write backs do not change the spec and therefore do not trigger a reconcile.
+func (w *watcher) load(ctx context.Context) error {
+	servers, err := readManifests(w.path)
+	if err != nil {
+		return err
+	}
+
+	seen := map[int]bool{}
+	for _, document := range servers {
+		serverNumber := document.server.Spec.ForProvider.ServerNumber
+		seen[serverNumber] = true
+		worker, ok := w.workers[serverNumber]
+		if !ok {
+			worker = w.startWorker(ctx, document)
+			w.workers[serverNumber] = worker
+			worker.notify()
+			continue
+		}
+		if worker.update(document) {
+			logrus.WithField("server", serverNumber).Info("Server spec changed")
+			// the running reconcile saves its progress, the next one continues with the new spec
+			worker.interrupt()
+			worker.notify()
+		}
+	}
+	for serverNumber, worker := range w.workers {
+		if !seen[serverNumber] {
+			logrus.WithField("server", serverNumber).Info("Server removed from manifests, no longer reconciled")
+			worker.stop()
+			delete(w.workers, serverNumber)
+		}
+	}
+	return nil
+}
+
+func (w *watcher) startWorker(ctx context.Context, document serverDocument) *serverWorker {
+	worker := &serverWorker{
+		trigger:  make(chan struct{}, 1),
+		document: document,
+	}
+	worker.ctx, worker.stop = context.WithCancel(ctx)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer worker.stop()
+		for {
+			select {
+			case <-worker.ctx.Done():
+				return
+			case <-worker.trigger:
+			}
+
+			select {
+			case <-worker.ctx.Done():
+				return
+			case w.semaphore <- struct{}{}:
+			}
+			runCtx := worker.startRun()
+			w.reconcile(runCtx, worker.current())
+			worker.endRun()
+			<-w.semaphore
+		}
+	}()
+	return worker
+}
+
+// startRun returns the context of a reconcile, it is cancelled by interrupt and when the server is removed
+func (s *serverWorker) startRun() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.cancelRun = cancel
+	return ctx
+}
+
+func (s *serverWorker) endRun() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancelRun()
+	s.cancelRun = nil
+}
+
+// interrupt stops the running reconcile, if any
+func (s *serverWorker) interrupt() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancelRun != nil {
+		s.cancelRun()
+	}
+}
+
+// notify triggers a reconcile. Triggers received while the server is reconciled result in a single reconcile.
+func (s *serverWorker) notify() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// update replaces the document of the server and reports whether the spec changed
+func (s *serverWorker) update(document serverDocument) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := !reflect.DeepEqual(s.document.server.Spec, document.server.Spec)
+	s.document = document
+	return changed
+}
+
+func (s *serverWorker) current() serverDocument {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.document
+}
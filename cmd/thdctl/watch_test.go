@@ -0,0 +1,136 @@
+package thdctl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const watchedServers = `apiVersion: lund.ai/v1alpha1
+kind: Server
+spec:
+  forProvider:
+    serverNumber: 1
+    disk: sda
+    talosVersion: v1.9.2
+---
+apiVersion: lund.ai/v1alpha1
+kind: Server
+spec:
+  forProvider:
+    serverNumber: 2
+    disk: sda
+    talosVersion: v1.9.2
+`
+
+func newTestWatcher(t *testing.T, path string) (*watcher, chan int) {
+	t.Helper()
+	w := newWatcher(nil, path, reconcileOptions{concurrency: 2}, time.Hour)
+	reconciled := make(chan int, 10)
+	w.reconcile = func(ctx context.Context, document serverDocument) {
+		reconciled <- document.server.Spec.ForProvider.ServerNumber
+	}
+	return w, reconciled
+}
+
+// received returns the servers reconciled within the timeout
+func received(reconciled chan int, timeout time.Duration) []int {
+	var servers []int
+	deadline := time.After(timeout)
+	for {
+		select {
+		case serverNumber := <-reconciled:
+			servers = append(servers, serverNumber)
+		case <-deadline:
+			return servers
+		}
+	}
+}
+
+func TestWatcherReconcilesChangedServers(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "servers.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(watchedServers), 0o644))
+	w, reconciled := newTestWatcher(t, filename)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, w.load(ctx))
+	assert.ElementsMatch(t, []int{1, 2}, received(reconciled, 100*time.Millisecond))
+
+	// a status write back does not change the spec
+	require.NoError(t, writeStatus(filename, 0, v1alpha1.ServerStatus{State: "WaitingForBootstrap"}))
+	require.NoError(t, w.load(ctx))
+	assert.Empty(t, received(reconciled, 100*time.Millisecond))
+
+	changed := strings.Replace(watchedServers, "serverNumber: 2\n    disk: sda", "serverNumber: 2\n    disk: nvme0n1", 1)
+	require.NoError(t, os.WriteFile(filename, []byte(changed), 0o644))
+	require.NoError(t, w.load(ctx))
+	assert.Equal(t, []int{2}, received(reconciled, 100*time.Millisecond))
+
+	removed := strings.SplitN(changed, "---\n", 2)[1]
+	require.NoError(t, os.WriteFile(filename, []byte(removed), 0o644))
+	require.NoError(t, w.load(ctx))
+	assert.Len(t, w.workers, 1)
+	assert.Contains(t, w.workers, 2)
+}
+
+func TestWatcherRun(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "servers.yaml"), []byte(watchedServers), 0o644))
+	w, reconciled := newTestWatcher(t, dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.run(ctx) }()
+
+	assert.ElementsMatch(t, []int{1, 2}, received(reconciled, 200*time.Millisecond))
+
+	node3 := "serverNumber: 3\ndisk: sda\ntalosVersion: v1.9.2\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "node3.yaml"), []byte(node3), 0o644))
+	assert.Equal(t, []int{3}, received(reconciled, watchDebounce+500*time.Millisecond))
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestWatcherStopsRunningReconciles(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "servers.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(watchedServers), 0o644))
+	w := newWatcher(nil, filename, reconcileOptions{concurrency: 2}, time.Hour)
+	started := make(chan string, 10)
+	stopped := make(chan int, 10)
+	// reconciles run until they are cancelled
+	w.reconcile = func(ctx context.Context, document serverDocument) {
+		started <- document.server.Spec.ForProvider.Disk
+		<-ctx.Done()
+		stopped <- document.server.Spec.ForProvider.ServerNumber
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, w.load(ctx))
+	assert.Equal(t, []string{"sda", "sda"}, []string{<-started, <-started})
+
+	// a spec change stops the running reconcile, the next one uses the new spec
+	changed := strings.Replace(watchedServers, "serverNumber: 2\n    disk: sda", "serverNumber: 2\n    disk: nvme0n1", 1)
+	require.NoError(t, os.WriteFile(filename, []byte(changed), 0o644))
+	require.NoError(t, w.load(ctx))
+	assert.Equal(t, 2, <-stopped)
+	assert.Equal(t, "nvme0n1", <-started)
+
+	// removing a server stops its reconcile
+	removed := strings.SplitN(changed, "---\n", 2)[1]
+	require.NoError(t, os.WriteFile(filename, []byte(removed), 0o644))
+	require.NoError(t, w.load(ctx))
+	assert.Equal(t, 1, <-stopped)
+
+	cancel()
+	assert.Equal(t, 2, <-stopped)
+	w.wg.Wait()
+}
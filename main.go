@@ -1,33 +1,56 @@
 package main
 
 import (
+	"context"
 	"os"
+	"time"
 
 	"github.com/eriklundjensen/thdctl/cmd/thdctl"
+	"github.com/eriklundjensen/thdctl/pkg/tracing"
+	"github.com/eriklundjensen/thdctl/pkg/validation"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var (
-	debug     bool
-	logFormat string
+	debug          bool
+	logFormat      string
+	tracingOptions tracing.Options
 )
 
 func main() {
+	var shutdownTracing func(context.Context) error
 	rootCmd := &cobra.Command{
 		Use:   "thdctl",
 		Short: "Talos Hetzner Dedicate Servers CLI",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			shutdown, err := tracing.Setup(cmd.Context(), tracingOptions)
+			shutdownTracing = shutdown
+			return err
+		},
 	}
 
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "enable debug logging")
 	rootCmd.PersistentFlags().StringVar(&logFormat, "log", "txt", "set log format (txt|json)")
+	rootCmd.PersistentFlags().StringVar(&tracingOptions.OTLPEndpoint, "trace-otlp-endpoint", "", "export traces to this OTLP/HTTP endpoint, e.g. http://localhost:4318")
+	rootCmd.PersistentFlags().StringVar(&tracingOptions.File, "trace-file", "", "append traces as JSON to this file")
+	rootCmd.PersistentFlags().StringSliceVar(&validation.AllowedImageHosts, "allowed-image-hosts", validation.AllowedImageHosts, "hosts Talos images may be downloaded from, *.example.com allows all subdomains")
 
 	for _, cmd := range thdctl.Commands {
 		rootCmd.AddCommand(cmd)
 	}
 
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	if shutdownTracing != nil {
+		// flush the spans of the run
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := shutdownTracing(ctx); err != nil {
+			logrus.WithError(err).Warn("Failed to export traces")
+		}
+		cancel()
+	}
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,131 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	clusterv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/cluster/v1alpha"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BMCScheme is the scheme of the BMC address of a Hetzner dedicated server, e.g. hetzner://123456
+const BMCScheme = "hetzner"
+
+// BMCDetails locates the server and the credentials used to manage it.
+type BMCDetails struct {
+	// Address is the server number in the Hetzner Robot as hetzner://<server number>
+	// +kubebuilder:validation:Pattern=`^hetzner://[1-9][0-9]*$`
+	Address string `json:"address"`
+	// CredentialsName is the name of the Secret with the Robot webservice username and password
+	CredentialsName string `json:"credentialsName"`
+}
+
+// ServerNumber returns the server number of the BMC address
+func (b BMCDetails) ServerNumber() (int, error) {
+	address, err := url.Parse(b.Address)
+	if err != nil {
+		return 0, err
+	}
+	if address.Scheme != BMCScheme {
+		return 0, fmt.Errorf("scheme must be %s, %s is not supported", BMCScheme, address.Scheme)
+	}
+	serverNumber, err := strconv.Atoi(address.Host)
+	if err != nil || address.Path != "" {
+		return 0, fmt.Errorf("address must be %s://<server number>", BMCScheme)
+	}
+	return serverNumber, nil
+}
+
+// RootDeviceHints select the disk Talos is installed on.
+type RootDeviceHints struct {
+	// DeviceName is the device name of the disk, e.g. sda or nvme0n1
+	// +kubebuilder:validation:Pattern=`^(sd[a-z]+|nvme\d+n\d+|mmcblk\d+)$`
+	DeviceName string `json:"deviceName"`
+}
+
+// ConfigReference references a Secret with a Talos network configuration in the key network.yaml.
+type ConfigReference struct {
+	ConfigRef string `json:"configRef"`
+}
+
+// SecretReference references a Secret with Talos machine configs in the keys controlplane.yaml and worker.yaml,
+// and optionally a talosconfig in the key talosconfig.
+type SecretReference struct {
+	SecretRef string `json:"secretRef"`
+}
+
+// BareMetalAssetSpec defines a server of the asset inventory.
+type BareMetalAssetSpec struct {
+	BMC BMCDetails `json:"bmc"`
+	// BootMACAddress is the MAC address of the boot interface, it is informational
+	// +optional
+	BootMACAddress string `json:"bootMACAddress,omitempty"`
+	// HardwareProfile is informational
+	// +optional
+	HardwareProfile string `json:"hardwareProfile,omitempty"`
+	// RootDeviceHints select the disk Talos is installed on
+	// +kubebuilder:validation:Required
+	RootDeviceHints *RootDeviceHints `json:"rootDeviceHints,omitempty"`
+	// Role selects the machine config of the talosConfig Secrets
+	// +optional
+	Role clusterv1alpha1.NodeRole `json:"role,omitempty"`
+	// ClusterName is the name of the cluster the server joins
+	// +optional
+	ClusterName string `json:"clusterName,omitempty"`
+	// Image is the URL of the Talos disk image. The server is not provisioned before the image is set.
+	// +kubebuilder:validation:Format=uri
+	// +optional
+	Image string `json:"image,omitempty"`
+	// TalosNetwork references the network configuration written to the installed disk before the first boot
+	// +optional
+	TalosNetwork []ConfigReference `json:"talosNetwork,omitempty"`
+	// TalosConfig references the machine configs, the machine config of the role is applied to the server
+	// +optional
+	TalosConfig []SecretReference `json:"talosConfig,omitempty"`
+}
+
+// BareMetalAssetStatus is the observed state of an asset.
+type BareMetalAssetStatus struct {
+	// Provisioned is true when Talos was installed and the machine config applied
+	Provisioned bool `json:"provisioned,omitempty"`
+	// State is the state of the server when the last run ended
+	State string `json:"state,omitempty"`
+	// LastError is the error of the last run, empty when the run succeeded
+	LastError string `json:"lastError,omitempty"`
+	// Conditions are the Ready and Synced conditions set by the Kubernetes controller
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// A BareMetalAsset is a server of an asset inventory installed with Talos.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+type BareMetalAsset struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              BareMetalAssetSpec   `json:"spec"`
+	Status            BareMetalAssetStatus `json:"status,omitempty"`
+}
+
+// BareMetalAssetList contains a list of assets
+// +kubebuilder:object:root=true
+type BareMetalAssetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BareMetalAsset `json:"items"`
+}
@@ -0,0 +1,106 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies the receiver into out
+func (in *BareMetalAsset) DeepCopyInto(out *BareMetalAsset) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy returns a deep copy of the asset
+func (in *BareMetalAsset) DeepCopy() *BareMetalAsset {
+	if in == nil {
+		return nil
+	}
+	out := new(BareMetalAsset)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *BareMetalAsset) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *BareMetalAssetList) DeepCopyInto(out *BareMetalAssetList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]BareMetalAsset, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy of the list
+func (in *BareMetalAssetList) DeepCopy() *BareMetalAssetList {
+	if in == nil {
+		return nil
+	}
+	out := new(BareMetalAssetList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *BareMetalAssetList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *BareMetalAssetSpec) DeepCopyInto(out *BareMetalAssetSpec) {
+	*out = *in
+	if in.RootDeviceHints != nil {
+		out.RootDeviceHints = new(RootDeviceHints)
+		*out.RootDeviceHints = *in.RootDeviceHints
+	}
+	if in.TalosNetwork != nil {
+		out.TalosNetwork = make([]ConfigReference, len(in.TalosNetwork))
+		copy(out.TalosNetwork, in.TalosNetwork)
+	}
+	if in.TalosConfig != nil {
+		out.TalosConfig = make([]SecretReference, len(in.TalosConfig))
+		copy(out.TalosConfig, in.TalosConfig)
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *BareMetalAssetStatus) DeepCopyInto(out *BareMetalAssetStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+}
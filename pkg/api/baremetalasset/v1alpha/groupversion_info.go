@@ -0,0 +1,38 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1alpha1 contains the BareMetalAsset kind of the lund.ai API group.
+// +groupName=lund.ai
+package v1alpha1
+
+import (
+	"github.com/eriklundjensen/thdctl/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is the group and version of the Kubernetes resources
+	GroupVersion = schema.GroupVersion{Group: meta.Group, Version: "v1alpha1"}
+
+	// SchemeBuilder registers the BareMetalAsset kinds in a Kubernetes scheme
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the BareMetalAsset kinds to a Kubernetes scheme
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+func init() {
+	SchemeBuilder.Register(&BareMetalAsset{}, &BareMetalAssetList{})
+}
@@ -0,0 +1,72 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import "github.com/eriklundjensen/thdctl/pkg/api/meta"
+
+// NodeRole is the Talos machine type of a node.
+// +kubebuilder:validation:Enum=controlplane;worker
+type NodeRole string
+
+const (
+	// ControlPlane nodes run etcd and the Kubernetes control plane
+	ControlPlane NodeRole = "controlplane"
+	// Worker nodes run workloads only
+	Worker NodeRole = "worker"
+)
+
+// ClusterParameters are the configurable fields of a Talos cluster.
+type ClusterParameters struct {
+	ClusterName string `json:"clusterName"`
+	// Endpoint is the URL of the Kubernetes API, e.g. https://192.0.2.10:6443
+	// +kubebuilder:validation:Format=uri
+	Endpoint          string `json:"endpoint"`
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// TalosVersion is the Talos version the machine configs are generated for
+	// +kubebuilder:validation:Pattern=`^v\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?$`
+	TalosVersion string `json:"talosVersion,omitempty"`
+	// ClusterDiscovery enables the Talos cluster discovery service
+	ClusterDiscovery bool `json:"clusterDiscovery,omitempty"`
+	// Patches are machine config patches applied to all nodes
+	Patches []string `json:"patches,omitempty"`
+	// ControlPlanePatches are machine config patches applied to control plane nodes
+	ControlPlanePatches []string `json:"controlPlanePatches,omitempty"`
+	// WorkerPatches are machine config patches applied to worker nodes
+	WorkerPatches []string `json:"workerPatches,omitempty"`
+	Nodes         []Node   `json:"nodes"`
+}
+
+// Node is a member of the cluster installed from a server specification.
+type Node struct {
+	Name string   `json:"name"`
+	Role NodeRole `json:"role"`
+	// ServerSpec references the server specification used to install the node
+	ServerSpec string `json:"serverSpec"`
+	// Address is the IP address of the node used as Talos endpoint
+	Address string `json:"address,omitempty"`
+	// Patches are machine config patches applied to this node only
+	Patches []string `json:"patches,omitempty"`
+}
+
+// A ClusterSpec defines the desired state of a cluster.
+type ClusterSpec struct {
+	ForProvider ClusterParameters `json:"forProvider"`
+}
+
+// A Cluster is a Talos cluster of servers.
+type Cluster struct {
+	meta.TypeMeta `json:",inline"`
+	Spec          ClusterSpec `json:"spec"`
+}
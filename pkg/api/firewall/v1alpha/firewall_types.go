@@ -0,0 +1,52 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import "github.com/eriklundjensen/thdctl/pkg/api/meta"
+
+// FirewallRule is an incoming rule of the Hetzner Robot firewall.
+type FirewallRule struct {
+	Name  string `json:"name,omitempty"`
+	SrcIP string `json:"srcIP,omitempty"`
+	DstIP string `json:"dstIP,omitempty"`
+	// Protocol is the IP protocol matched by the rule, all protocols match when it is unset
+	// +kubebuilder:validation:Enum=tcp;udp;gre;icmp;ipip;ah;esp
+	Protocol string `json:"protocol,omitempty"`
+	SrcPort  string `json:"srcPort,omitempty"`
+	DstPort  string `json:"dstPort,omitempty"`
+	TCPFlags string `json:"tcpFlags,omitempty"`
+	// Action is accept or discard
+	// +kubebuilder:validation:Enum=accept;discard
+	Action string `json:"action"`
+}
+
+// FirewallParameters are the configurable fields of the firewall of a server.
+type FirewallParameters struct {
+	ServerNumber             int            `json:"serverNumber"`
+	FilterIPv6               bool           `json:"filterIPv6,omitempty"`
+	WhitelistHetznerServices bool           `json:"whitelistHetznerServices,omitempty"`
+	Rules                    []FirewallRule `json:"rules,omitempty"`
+}
+
+// A FirewallSpec defines the desired state of a firewall.
+type FirewallSpec struct {
+	ForProvider FirewallParameters `json:"forProvider"`
+}
+
+// A Firewall is the Hetzner Robot firewall of a server.
+type Firewall struct {
+	meta.TypeMeta `json:",inline"`
+	Spec          FirewallSpec `json:"spec"`
+}
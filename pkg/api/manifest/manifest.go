@@ -0,0 +1,227 @@
+// Package manifest decodes multi-document YAML manifests of typed thdctl kinds.
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	baremetalassetv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/baremetalasset/v1alpha"
+	clusterv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/cluster/v1alpha"
+	firewallv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/firewall/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/api/meta"
+	serverv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	yaml "github.com/goccy/go-yaml"
+)
+
+// Version is the current version of the thdctl kinds
+const Version = "v1alpha1"
+
+// ConversionFunc converts an object decoded from an older version to the current version
+type ConversionFunc func(in any) (any, error)
+
+// Scheme maps versions and kinds to Go types
+type Scheme struct {
+	mu          sync.RWMutex
+	types       map[meta.GroupVersionKind]reflect.Type
+	conversions map[meta.GroupVersionKind]ConversionFunc
+}
+
+// NewScheme creates an empty scheme
+func NewScheme() *Scheme {
+	return &Scheme{
+		types:       map[meta.GroupVersionKind]reflect.Type{},
+		conversions: map[meta.GroupVersionKind]ConversionFunc{},
+	}
+}
+
+// AddKnownType registers the type of a kind. obj is a pointer to a zero value of the type.
+func (s *Scheme) AddKnownType(gvk meta.GroupVersionKind, obj any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.types[gvk] = reflect.TypeOf(obj).Elem()
+}
+
+// AddConversion registers a conversion hook applied after decoding a kind of an older version
+func (s *Scheme) AddConversion(from meta.GroupVersionKind, convert ConversionFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conversions[from] = convert
+}
+
+// New returns a pointer to a new object of a kind
+func (s *Scheme) New(gvk meta.GroupVersionKind) (any, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.types[gvk]
+	if !ok {
+		return nil, fmt.Errorf("unknown kind %s", gvk)
+	}
+	return reflect.New(t).Interface(), nil
+}
+
+// KnownKinds returns the registered kinds sorted by version and kind
+func (s *Scheme) KnownKinds() []meta.GroupVersionKind {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	kinds := make([]meta.GroupVersionKind, 0, len(s.types))
+	for gvk := range s.types {
+		kinds = append(kinds, gvk)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		return kinds[i].String() < kinds[j].String()
+	})
+	return kinds
+}
+
+func (s *Scheme) conversion(gvk meta.GroupVersionKind) ConversionFunc {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.conversions[gvk]
+}
+
+// DefaultScheme contains the current version of all thdctl kinds
+var DefaultScheme = NewScheme()
+
+func init() {
+	gvk := func(kind string) meta.GroupVersionKind {
+		return meta.GroupVersionKind{Group: meta.Group, Version: Version, Kind: kind}
+	}
+	DefaultScheme.AddKnownType(gvk("Server"), &serverv1alpha1.Server{})
+	DefaultScheme.AddKnownType(gvk("ServerList"), &serverv1alpha1.ServerList{})
+	DefaultScheme.AddKnownType(gvk("Cluster"), &clusterv1alpha1.Cluster{})
+	DefaultScheme.AddKnownType(gvk("Firewall"), &firewallv1alpha1.Firewall{})
+	DefaultScheme.AddKnownType(gvk("BareMetalAsset"), &baremetalassetv1alpha1.BareMetalAsset{})
+}
+
+// Document is a decoded document of a manifest
+type Document struct {
+	// Index is the position of the document in the file
+	Index int
+	// GroupVersionKind of the document as written in the file
+	GroupVersionKind meta.GroupVersionKind
+	// Object is a pointer to the decoded object of the current version
+	Object any
+}
+
+// LegacyFunc decodes a document without apiVersion and kind
+type LegacyFunc func(data []byte) (any, error)
+
+// Decode strictly decodes all documents of a manifest. Unknown fields are rejected.
+// Documents without apiVersion and kind are decoded by legacy, they are rejected if legacy is nil.
+func (s *Scheme) Decode(data []byte, legacy LegacyFunc) ([]Document, error) {
+	var documents []Document
+	for index, document := range SplitDocuments(data) {
+		if isEmpty(document) {
+			continue
+		}
+		decoded, err := s.decodeDocument(document, legacy)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", index+1, err)
+		}
+		decoded.Index = index
+		documents = append(documents, *decoded)
+	}
+	return documents, nil
+}
+
+func (s *Scheme) decodeDocument(data []byte, legacy LegacyFunc) (*Document, error) {
+	var typeMeta meta.TypeMeta
+	if err := yaml.Unmarshal(data, &typeMeta); err != nil {
+		return nil, err
+	}
+
+	if typeMeta.APIVersion == "" && typeMeta.Kind == "" {
+		if legacy == nil {
+			return nil, fmt.Errorf("apiVersion and kind are required")
+		}
+		obj, err := legacy(data)
+		if err != nil {
+			return nil, err
+		}
+		return &Document{Object: obj}, nil
+	}
+
+	gvk := typeMeta.GroupVersionKind()
+	obj, err := s.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	if err := Unmarshal(data, obj); err != nil {
+		return nil, err
+	}
+	if convert := s.conversion(gvk); convert != nil {
+		if obj, err = convert(obj); err != nil {
+			return nil, fmt.Errorf("failed to convert %s: %w", gvk, err)
+		}
+	}
+	return &Document{GroupVersionKind: gvk, Object: obj}, nil
+}
+
+// Unmarshal strictly decodes a single document, unknown fields are rejected
+func Unmarshal(data []byte, obj any) error {
+	if err := yaml.UnmarshalWithOptions(data, obj, yaml.Strict()); err != nil {
+		return fmt.Errorf("%s", yaml.FormatError(err, false, true))
+	}
+	return nil
+}
+
+// SplitDocuments splits a multi-document YAML file at the --- separator lines.
+// The separators are not part of the documents.
+func SplitDocuments(data []byte) [][]byte {
+	documents, _ := splitDocuments(data)
+	return documents
+}
+
+// JoinDocuments replaces the documents of a file, keeping the separators of the original data
+func JoinDocuments(original []byte, documents [][]byte) []byte {
+	_, separators := splitDocuments(original)
+	var result []byte
+	for i, document := range documents {
+		if i > 0 {
+			if i-1 < len(separators) {
+				result = append(result, separators[i-1]...)
+			} else {
+				result = append(result, []byte("---\n")...)
+			}
+		}
+		result = append(result, document...)
+	}
+	return result
+}
+
+func splitDocuments(data []byte) ([][]byte, [][]byte) {
+	var documents, separators [][]byte
+	var current []byte
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if isSeparator(line) {
+			documents = append(documents, current)
+			separators = append(separators, line)
+			current = nil
+			continue
+		}
+		current = append(current, line...)
+	}
+	return append(documents, current), separators
+}
+
+func isSeparator(line []byte) bool {
+	if !bytes.HasPrefix(line, []byte("---")) {
+		return false
+	}
+	rest := bytes.TrimSpace(line[3:])
+	return len(rest) == 0 || rest[0] == '#'
+}
+
+// isEmpty reports whether a document only contains comments and blank lines
+func isEmpty(document []byte) bool {
+	for _, line := range bytes.Split(document, []byte("\n")) {
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) > 0 && trimmed[0] != '#' {
+			return false
+		}
+	}
+	return true
+}
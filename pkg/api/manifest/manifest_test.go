@@ -0,0 +1,134 @@
+package manifest
+
+import (
+	"testing"
+
+	clusterv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/cluster/v1alpha"
+	firewallv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/firewall/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/api/meta"
+	serverv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const manifest = `# servers of demo-1
+apiVersion: lund.ai/v1alpha1
+kind: Server
+metadata:
+  name: node-1
+  labels:
+    cluster: demo-1
+spec:
+  forProvider:
+    serverNumber: 1
+    talosVersion: v1.9.2
+---
+apiVersion: lund.ai/v1alpha1
+kind: ServerList
+items:
+- spec:
+    forProvider:
+      serverNumber: 2
+      talosVersion: v1.9.2
+--- # firewall
+apiVersion: lund.ai/v1alpha1
+kind: Firewall
+spec:
+  forProvider:
+    serverNumber: 1
+    rules:
+    - name: kubernetes api
+      dstPort: "6443"
+      action: accept
+---
+apiVersion: lund.ai/v1alpha1
+kind: Cluster
+spec:
+  forProvider:
+    clusterName: demo-1
+`
+
+func TestDecode(t *testing.T) {
+	documents, err := DefaultScheme.Decode([]byte(manifest), nil)
+
+	require.NoError(t, err)
+	require.Len(t, documents, 4)
+	server := documents[0].Object.(*serverv1alpha1.Server)
+	assert.Equal(t, "Server", server.Kind)
+	assert.Equal(t, "node-1", server.Name)
+	assert.Equal(t, map[string]string{"cluster": "demo-1"}, server.Labels)
+	assert.Equal(t, 1, server.Spec.ForProvider.ServerNumber)
+	list := documents[1].Object.(*serverv1alpha1.ServerList)
+	assert.Equal(t, 2, list.Items[0].Spec.ForProvider.ServerNumber)
+	firewall := documents[2].Object.(*firewallv1alpha1.Firewall)
+	assert.Equal(t, "6443", firewall.Spec.ForProvider.Rules[0].DstPort)
+	cluster := documents[3].Object.(*clusterv1alpha1.Cluster)
+	assert.Equal(t, "demo-1", cluster.Spec.ForProvider.ClusterName)
+	assert.Equal(t, 3, documents[3].Index)
+}
+
+func TestDecodeRejectsUnknownFields(t *testing.T) {
+	_, err := DefaultScheme.Decode([]byte(`apiVersion: lund.ai/v1alpha1
+kind: Server
+spec:
+  forProvider:
+    serverNumber: 1
+    talsoImage: https://example.com/talos.raw.zst
+`), nil)
+
+	assert.ErrorContains(t, err, "talsoImage")
+}
+
+func TestDecodeRejectsUnknownKind(t *testing.T) {
+	_, err := DefaultScheme.Decode([]byte("apiVersion: lund.ai/v1alpha1\nkind: Machine\n"), nil)
+	assert.ErrorContains(t, err, "unknown kind lund.ai/v1alpha1, Kind=Machine")
+
+	_, err = DefaultScheme.Decode([]byte("serverNumber: 1\n"), nil)
+	assert.ErrorContains(t, err, "apiVersion and kind are required")
+}
+
+func TestDecodeLegacy(t *testing.T) {
+	legacy := func(data []byte) (any, error) {
+		var parameters serverv1alpha1.ServerParameters
+		return &parameters, Unmarshal(data, &parameters)
+	}
+
+	documents, err := DefaultScheme.Decode([]byte("---\nserverNumber: 1\ntalosVersion: v1.9.2\n"), legacy)
+
+	require.NoError(t, err)
+	require.Len(t, documents, 1)
+	assert.Equal(t, 1, documents[0].Index)
+	assert.Equal(t, 1, documents[0].Object.(*serverv1alpha1.ServerParameters).ServerNumber)
+}
+
+// serverV1alpha0 is an example of an older version with a renamed field
+type serverV1alpha0 struct {
+	meta.TypeMeta `json:",inline"`
+	Number        int `json:"number"`
+}
+
+func TestDecodeConversion(t *testing.T) {
+	old := meta.GroupVersionKind{Group: meta.Group, Version: "v1alpha0", Kind: "Server"}
+	scheme := NewScheme()
+	scheme.AddKnownType(old, &serverV1alpha0{})
+	scheme.AddConversion(old, func(in any) (any, error) {
+		server := &serverv1alpha1.Server{}
+		server.APIVersion = meta.Group + "/" + Version
+		server.Kind = "Server"
+		server.Spec.ForProvider.ServerNumber = in.(*serverV1alpha0).Number
+		return server, nil
+	})
+
+	documents, err := scheme.Decode([]byte("apiVersion: lund.ai/v1alpha0\nkind: Server\nnumber: 7\n"), nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, old, documents[0].GroupVersionKind)
+	assert.Equal(t, 7, documents[0].Object.(*serverv1alpha1.Server).Spec.ForProvider.ServerNumber)
+}
+
+func TestSplitAndJoinDocuments(t *testing.T) {
+	documents := SplitDocuments([]byte(manifest))
+	require.Len(t, documents, 4)
+
+	assert.Equal(t, manifest, string(JoinDocuments([]byte(manifest), documents)))
+}
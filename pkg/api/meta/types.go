@@ -0,0 +1,57 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package meta contains the type information shared by all thdctl manifests.
+package meta
+
+import "strings"
+
+// Group is the API group of the thdctl kinds
+const Group = "lund.ai"
+
+// TypeMeta describes the version and kind of a manifest document.
+type TypeMeta struct {
+	// APIVersion is the group and version of the kind, e.g. lund.ai/v1alpha1
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Kind is the kind of the document, e.g. Server
+	Kind string `json:"kind,omitempty"`
+}
+
+// GroupVersionKind identifies a kind in a version of an API group.
+type GroupVersionKind struct {
+	Group   string
+	Version string
+	Kind    string
+}
+
+// GroupVersionKind returns the group, version and kind of the document
+func (t TypeMeta) GroupVersionKind() GroupVersionKind {
+	group, version, found := strings.Cut(t.APIVersion, "/")
+	if !found {
+		return GroupVersionKind{Version: group, Kind: t.Kind}
+	}
+	return GroupVersionKind{Group: group, Version: version, Kind: t.Kind}
+}
+
+// APIVersion returns the apiVersion of the group and version, e.g. lund.ai/v1alpha1
+func (gvk GroupVersionKind) APIVersion() string {
+	if gvk.Group == "" {
+		return gvk.Version
+	}
+	return gvk.Group + "/" + gvk.Version
+}
+
+func (gvk GroupVersionKind) String() string {
+	return gvk.APIVersion() + ", Kind=" + gvk.Kind
+}
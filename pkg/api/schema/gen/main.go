@@ -0,0 +1,20 @@
+// gen writes the doc comments and markers of the API types to zz_generated.docs.go.
+// Run it with go generate ./pkg/api/schema after changing an API type.
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/eriklundjensen/thdctl/pkg/api/schema/internal/docgen"
+)
+
+func main() {
+	source, err := docgen.Generate("schema", docgen.Packages)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("zz_generated.docs.go", source, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,156 @@
+// Package docgen extracts the doc comments and markers of the API types from their Go source.
+package docgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Packages are the packages of the types used by the thdctl kinds
+var Packages = []string{
+	"github.com/eriklundjensen/thdctl/pkg/api/meta",
+	"github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha",
+	"github.com/eriklundjensen/thdctl/pkg/api/cluster/v1alpha",
+	"github.com/eriklundjensen/thdctl/pkg/api/firewall/v1alpha",
+	"github.com/eriklundjensen/thdctl/pkg/api/baremetalasset/v1alpha",
+}
+
+// Doc is the description and the markers of a type or field.
+// Markers are the comment lines starting with +, e.g. +kubebuilder:validation:Enum=a;b
+type Doc struct {
+	Description string
+	Markers     map[string]string
+	Fields      map[string]Doc
+}
+
+// Generate returns the Go source of the docs variable of package pkg with the docs of all types of the packages
+func Generate(pkg string, packages []string) ([]byte, error) {
+	docs := map[string]Doc{}
+	for _, importPath := range packages {
+		if err := parsePackage(importPath, docs); err != nil {
+			return nil, err
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by gen. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	b.WriteString("var docs = map[string]doc{\n")
+	for _, name := range sortedKeys(docs) {
+		fmt.Fprintf(&b, "%q: ", name)
+		writeDoc(&b, docs[name])
+		b.WriteString(",\n")
+	}
+	b.WriteString("}\n")
+	return format.Source(b.Bytes())
+}
+
+func parsePackage(importPath string, docs map[string]Doc) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	p, err := build.Import(importPath, wd, 0)
+	if err != nil {
+		return fmt.Errorf("failed to find package %s: %w", importPath, err)
+	}
+
+	fset := token.NewFileSet()
+	for _, name := range p.GoFiles {
+		file, err := parser.ParseFile(fset, filepath.Join(p.Dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				comment := typeSpec.Doc
+				if comment == nil && len(gen.Specs) == 1 {
+					comment = gen.Doc
+				}
+				doc := parseComment(comment)
+				if structType, ok := typeSpec.Type.(*ast.StructType); ok {
+					doc.Fields = map[string]Doc{}
+					for _, field := range structType.Fields.List {
+						fieldDoc := parseComment(field.Doc)
+						if fieldDoc.Description == "" && len(fieldDoc.Markers) == 0 {
+							continue
+						}
+						for _, ident := range field.Names {
+							doc.Fields[ident.Name] = fieldDoc
+						}
+					}
+				}
+				docs[importPath+"."+typeSpec.Name.Name] = doc
+			}
+		}
+	}
+	return nil
+}
+
+// parseComment splits a doc comment into the description and the markers
+func parseComment(comment *ast.CommentGroup) Doc {
+	doc := Doc{Markers: map[string]string{}}
+	if comment == nil {
+		return doc
+	}
+	var description []string
+	for _, line := range strings.Split(comment.Text(), "\n") {
+		line = strings.TrimSpace(line)
+		if marker, ok := strings.CutPrefix(line, "+"); ok {
+			name, value, _ := strings.Cut(marker, "=")
+			doc.Markers[name] = strings.Trim(value, "`")
+			continue
+		}
+		if line != "" {
+			description = append(description, line)
+		}
+	}
+	doc.Description = strings.Join(description, " ")
+	return doc
+}
+
+func writeDoc(b *bytes.Buffer, doc Doc) {
+	b.WriteString("{")
+	if doc.Description != "" {
+		fmt.Fprintf(b, "Description: %q, ", doc.Description)
+	}
+	if len(doc.Markers) > 0 {
+		b.WriteString("Markers: map[string]string{")
+		for _, name := range sortedKeys(doc.Markers) {
+			fmt.Fprintf(b, "%q: %q, ", name, doc.Markers[name])
+		}
+		b.WriteString("}, ")
+	}
+	if len(doc.Fields) > 0 {
+		b.WriteString("Fields: map[string]doc{\n")
+		for _, name := range sortedKeys(doc.Fields) {
+			fmt.Fprintf(b, "%q: ", name)
+			writeDoc(b, doc.Fields[name])
+			b.WriteString(",\n")
+		}
+		b.WriteString("}")
+	}
+	b.WriteString("}")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,249 @@
+// Package schema generates JSON schemas of the thdctl kinds.
+// Descriptions and validation markers are taken from the doc comments of the API types.
+package schema
+
+//go:generate go run ./gen
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eriklundjensen/thdctl/pkg/api/manifest"
+	"github.com/eriklundjensen/thdctl/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Draft is the JSON schema version of the generated schemas
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// Markers supported on types and fields, they use the names of the Kubebuilder CRD validation markers
+const (
+	markerEnum     = "kubebuilder:validation:Enum"
+	markerPattern  = "kubebuilder:validation:Pattern"
+	markerFormat   = "kubebuilder:validation:Format"
+	markerMinimum  = "kubebuilder:validation:Minimum"
+	markerMaximum  = "kubebuilder:validation:Maximum"
+	markerRequired = "kubebuilder:validation:Required"
+	markerOptional = "optional"
+)
+
+// Schema is a JSON schema
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Const                string             `json:"const,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// doc is the description and the markers of a type or field, see zz_generated.docs.go
+type doc struct {
+	Description string
+	Markers     map[string]string
+	Fields      map[string]doc
+}
+
+// For returns the schema of a kind of the scheme
+func For(scheme *manifest.Scheme, gvk meta.GroupVersionKind) (*Schema, error) {
+	s, err := kindSchema(scheme, gvk)
+	if err != nil {
+		return nil, err
+	}
+	s.Schema = Draft
+	return s, nil
+}
+
+// Manifest returns the schema of a manifest document of any kind of the scheme
+func Manifest(scheme *manifest.Scheme) (*Schema, error) {
+	s := &Schema{
+		Schema:      Draft,
+		Title:       "thdctl manifest",
+		Description: "A document of a thdctl manifest",
+	}
+	for _, gvk := range scheme.KnownKinds() {
+		kind, err := kindSchema(scheme, gvk)
+		if err != nil {
+			return nil, err
+		}
+		s.OneOf = append(s.OneOf, kind)
+	}
+	return s, nil
+}
+
+func kindSchema(scheme *manifest.Scheme, gvk meta.GroupVersionKind) (*Schema, error) {
+	obj, err := scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	s := typeSchema(reflect.TypeOf(obj).Elem())
+	s.Title = gvk.Kind
+	for name, value := range map[string]string{"apiVersion": gvk.APIVersion(), "kind": gvk.Kind} {
+		property, ok := s.Properties[name]
+		if !ok {
+			return nil, fmt.Errorf("%s has no %s field", gvk, name)
+		}
+		property.Const = value
+		if property.Description == "" {
+			// kinds of the Kubernetes controller embed metav1.TypeMeta
+			property.Description = docs[typeName(reflect.TypeOf(meta.TypeMeta{}))].Fields[fieldNames[name]].Description
+		}
+	}
+	s.Required = append([]string{"apiVersion", "kind"}, s.Required...)
+	return s, nil
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	metaTimeType   = reflect.TypeOf(metav1.Time{})
+	objectMetaType = reflect.TypeOf(metav1.ObjectMeta{})
+)
+
+// fieldNames are the Go field names of the properties of meta.TypeMeta
+var fieldNames = map[string]string{"apiVersion": "APIVersion", "kind": "Kind"}
+
+// objectMetaSchema is the schema of the metadata of a manifest. Only the fields set by users are accepted.
+func objectMetaSchema() *Schema {
+	return &Schema{
+		Type:        "object",
+		Description: "Metadata of the Kubernetes resource",
+		Properties: map[string]*Schema{
+			"name":        {Type: "string"},
+			"namespace":   {Type: "string"},
+			"labels":      {Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+			"annotations": {Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+		},
+	}
+}
+
+// typeSchema returns the schema of a Go type using the json field names
+func typeSchema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var s *Schema
+	switch {
+	case t == timeType || t == metaTimeType:
+		s = &Schema{Type: "string", Format: "date-time"}
+	case t == objectMetaType:
+		s = objectMetaSchema()
+	case t.Kind() == reflect.Struct:
+		s = structSchema(t)
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		s = &Schema{Type: "array", Items: typeSchema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		s = &Schema{Type: "object", AdditionalProperties: typeSchema(t.Elem())}
+	case t.Kind() == reflect.String:
+		s = &Schema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		s = &Schema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		s = &Schema{Type: "integer"}
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uintptr:
+		s = &Schema{Type: "integer", Minimum: float(0)}
+		if t.Kind() == reflect.Uint8 {
+			s.Maximum = float(255)
+		}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		s = &Schema{Type: "number"}
+	default:
+		// interfaces accept any value
+		s = &Schema{}
+	}
+
+	if d, ok := docs[typeName(t)]; ok {
+		applyMarkers(s, d.Markers)
+	}
+	return s
+}
+
+func structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+	d := docs[typeName(t)]
+	s.Description = d.Description
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			// embedded structs like meta.TypeMeta are inlined
+			embedded := structSchema(field.Type)
+			for property, schema := range embedded.Properties {
+				s.Properties[property] = schema
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := typeSchema(field.Type)
+		fieldDoc := d.Fields[field.Name]
+		if fieldDoc.Description != "" {
+			property.Description = fieldDoc.Description
+		} else if property.Description == "" {
+			property.Description = docs[typeName(field.Type)].Description
+		}
+		applyMarkers(property, fieldDoc.Markers)
+		s.Properties[name] = property
+
+		_, optional := fieldDoc.Markers[markerOptional]
+		_, required := fieldDoc.Markers[markerRequired]
+		if required || (!optional && !strings.Contains(options, "omitempty")) {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+func applyMarkers(s *Schema, markers map[string]string) {
+	for name, value := range markers {
+		switch name {
+		case markerEnum:
+			s.Enum = strings.Split(value, ";")
+		case markerPattern:
+			s.Pattern = value
+		case markerFormat:
+			s.Format = value
+		case markerMinimum:
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				s.Minimum = &f
+			}
+		case markerMaximum:
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				s.Maximum = &f
+			}
+		}
+	}
+}
+
+// typeName returns the key of a type in docs
+func typeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+func float(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"os"
+	"testing"
+
+	"github.com/eriklundjensen/thdctl/pkg/api/manifest"
+	"github.com/eriklundjensen/thdctl/pkg/api/meta"
+	"github.com/eriklundjensen/thdctl/pkg/api/schema/internal/docgen"
+	"github.com/eriklundjensen/thdctl/pkg/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var serverKind = meta.GroupVersionKind{Group: meta.Group, Version: manifest.Version, Kind: "Server"}
+
+func TestGeneratedDocsUpToDate(t *testing.T) {
+	expected, err := docgen.Generate("schema", docgen.Packages)
+	require.NoError(t, err)
+	actual, err := os.ReadFile("zz_generated.docs.go")
+	require.NoError(t, err)
+
+	assert.Equal(t, string(expected), string(actual), "run go generate ./pkg/api/schema")
+}
+
+func TestServerSchema(t *testing.T) {
+	s, err := For(manifest.DefaultScheme, serverKind)
+	require.NoError(t, err)
+
+	assert.Equal(t, Draft, s.Schema)
+	assert.Equal(t, "Server", s.Title)
+	assert.Equal(t, []string{"apiVersion", "kind", "spec"}, s.Required)
+	assert.Equal(t, "lund.ai/v1alpha1", s.Properties["apiVersion"].Const)
+	assert.Equal(t, "Server", s.Properties["kind"].Const)
+	assert.Equal(t, false, s.AdditionalProperties)
+
+	params := s.Properties["spec"].Properties["forProvider"]
+	assert.Equal(t, "ServerParameters are the configurable fields of a server.", params.Description)
+	assert.Equal(t, []string{"serverNumber", "disk"}, params.Required)
+	assert.Equal(t, 1.0, *params.Properties["serverNumber"].Minimum)
+	assert.Equal(t, validation.DiskNamePattern, params.Properties["disk"].Pattern)
+	assert.Equal(t, "uri", params.Properties["talosImage"].Format)
+	assert.Equal(t, validation.TalosVersionPattern, params.Properties["talosVersion"].Pattern)
+	assert.Equal(t, []string{"Enforce", "Warn"}, params.Properties["diskHealth"].Properties["action"].Enum)
+	metaKey := params.Properties["firstBoot"].Properties["meta"].Items.Properties["key"]
+	assert.Equal(t, 255.0, *metaKey.Maximum)
+
+	status := s.Properties["status"]
+	assert.Equal(t, "date-time", status.Properties["lastTransitionTime"].Format)
+	assert.Equal(t, "string", status.Properties["details"].Properties["server_ip"].Type)
+}
+
+func TestSchemaOfUnknownKind(t *testing.T) {
+	_, err := For(manifest.DefaultScheme, meta.GroupVersionKind{Group: meta.Group, Version: manifest.Version, Kind: "Machine"})
+	assert.Error(t, err)
+}
+
+func TestManifestSchema(t *testing.T) {
+	s, err := Manifest(manifest.DefaultScheme)
+	require.NoError(t, err)
+
+	var kinds []string
+	for _, kind := range s.OneOf {
+		kinds = append(kinds, kind.Properties["kind"].Const)
+		assert.Empty(t, kind.Schema)
+	}
+	assert.Equal(t, []string{"BareMetalAsset", "Cluster", "Firewall", "Server", "ServerList"}, kinds)
+}
@@ -0,0 +1,174 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// The deep copy functions are written by hand, controller-gen cannot copy the
+// interface value of hetznerapi.ServerDetails.
+
+// DeepCopyInto copies the receiver into out
+func (in *Server) DeepCopyInto(out *Server) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy returns a deep copy of the server
+func (in *Server) DeepCopy() *Server {
+	if in == nil {
+		return nil
+	}
+	out := new(Server)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *Server) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *ServerList) DeepCopyInto(out *ServerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]Server, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy of the list
+func (in *ServerList) DeepCopy() *ServerList {
+	if in == nil {
+		return nil
+	}
+	out := new(ServerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *ServerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *ServerSpec) DeepCopyInto(out *ServerSpec) {
+	*out = *in
+	in.ForProvider.DeepCopyInto(&out.ForProvider)
+	if in.CredentialsSecretRef != nil {
+		out.CredentialsSecretRef = new(SecretReference)
+		*out.CredentialsSecretRef = *in.CredentialsSecretRef
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *ServerParameters) DeepCopyInto(out *ServerParameters) {
+	*out = *in
+	if in.DiskHealth != nil {
+		out.DiskHealth = new(DiskHealthPolicy)
+		in.DiskHealth.DeepCopyInto(out.DiskHealth)
+	}
+	if in.FirstBoot != nil {
+		out.FirstBoot = new(FirstBootConfig)
+		*out.FirstBoot = *in.FirstBoot
+		if in.FirstBoot.Meta != nil {
+			out.FirstBoot.Meta = make([]MetaValue, len(in.FirstBoot.Meta))
+			copy(out.FirstBoot.Meta, in.FirstBoot.Meta)
+		}
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *DiskHealthPolicy) DeepCopyInto(out *DiskHealthPolicy) {
+	*out = *in
+	copyInt64 := func(in *int64) *int64 {
+		if in == nil {
+			return nil
+		}
+		out := *in
+		return &out
+	}
+	out.MaxReallocatedSectors = copyInt64(in.MaxReallocatedSectors)
+	out.MaxMediaErrors = copyInt64(in.MaxMediaErrors)
+	out.MaxPercentageUsed = copyInt64(in.MaxPercentageUsed)
+}
+
+// DeepCopyInto copies the receiver into out.
+// The linked storage box of the details is decoded JSON and is shared with out.
+func (in *ServerStatus) DeepCopyInto(out *ServerStatus) {
+	*out = *in
+	if in.LastTransitionTime != nil {
+		t := *in.LastTransitionTime
+		out.LastTransitionTime = &t
+	}
+	out.Details = copyServerDetails(in.Details)
+	if in.Talos.Upgrade != nil {
+		out.Talos.Upgrade = new(TalosUpgrade)
+		*out.Talos.Upgrade = *in.Talos.Upgrade
+	}
+	if in.DiskHealth != nil {
+		out.DiskHealth = new(hetznerapi.DiskHealth)
+		*out.DiskHealth = *in.DiskHealth
+	}
+	if in.Deprovision != nil {
+		out.Deprovision = new(DeprovisionStatus)
+		*out.Deprovision = *in.Deprovision
+		out.Deprovision.StoppedArrays = copyStrings(in.Deprovision.StoppedArrays)
+		out.Deprovision.WipedDevices = copyStrings(in.Deprovision.WipedDevices)
+	}
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+}
+
+func copyServerDetails(in hetznerapi.ServerDetails) hetznerapi.ServerDetails {
+	out := in
+	out.IP = copyStrings(in.IP)
+	if in.Subnet != nil {
+		out.Subnet = make([]hetznerapi.Subnet, len(in.Subnet))
+		copy(out.Subnet, in.Subnet)
+	}
+	return out
+}
+
+func copyStrings(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	out := make([]string, len(in))
+	copy(out, in)
+	return out
+}
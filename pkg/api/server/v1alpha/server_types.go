@@ -17,15 +17,81 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"time"
+
 	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // ServerParameters are the configurable fields of a server.
 type ServerParameters struct {
-	ServerNumber int    `json:"serverNumber"`
-	Disk         string `json:"disk,omitempty"`
+	// ServerNumber is the number of the server in the Hetzner Robot
+	// +kubebuilder:validation:Minimum=1
+	ServerNumber int `json:"serverNumber"`
+	// Disk is the device name of the disk Talos is installed on, e.g. sda or nvme0n1
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^(sd[a-z]+|nvme\d+n\d+|mmcblk\d+)$`
+	Disk string `json:"disk,omitempty"`
+	// TalosVersion is the Talos release installed on the server, e.g. v1.9.2
+	// +kubebuilder:validation:Pattern=`^v\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?$`
 	TalosVersion string `json:"talosVersion,omitempty"`
-	TalosImage   string `json:"talosImage,omitempty"`
+	// TalosImage is the URL of the disk image installed on the server. It takes precedence over TalosVersion.
+	// +kubebuilder:validation:Format=uri
+	TalosImage string `json:"talosImage,omitempty"`
+	// WipeRaid stops the software RAID created by Hetzner installimage and wipes all member disks before installation
+	WipeRaid bool `json:"wipeRaid,omitempty"`
+	// VerifyImageDigest compares the digest of the written disk prefix with the image before rebooting
+	VerifyImageDigest bool `json:"verifyImageDigest,omitempty"`
+	// DiskHealth enables a SMART health check of the target disk before installation
+	DiskHealth *DiskHealthPolicy `json:"diskHealth,omitempty"`
+	// FirstBoot defines configuration written to the installed disk before the first boot
+	FirstBoot *FirstBootConfig `json:"firstBoot,omitempty"`
+	// MachineConfig references a machine config applied to the maintenance mode API when Talos is available
+	MachineConfig string `json:"machineConfig,omitempty"`
+	// Talosconfig references the talosconfig used to access the node after the machine config has been applied
+	Talosconfig string `json:"talosconfig,omitempty"`
+	// Bootstrap bootstraps etcd on the node once the machine config is active. Set it on a single control plane node of a cluster.
+	Bootstrap bool `json:"bootstrap,omitempty"`
+	// Kubeconfig is the file the admin kubeconfig is written to when the Kubernetes API is ready
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+}
+
+// FirstBootConfig defines configuration written to the installed disk from the rescue system.
+// Relative file names are resolved from the current working directory.
+type FirstBootConfig struct {
+	// NetworkConfigFile references a network platform configuration written to the META key 0x0a
+	NetworkConfigFile string `json:"networkConfigFile,omitempty"`
+	// MachineConfigFile references a machine config written to the STATE partition
+	MachineConfigFile string `json:"machineConfigFile,omitempty"`
+	// Meta defines additional META keys
+	Meta []MetaValue `json:"meta,omitempty"`
+}
+
+// MetaValue is a value of a Talos META key.
+type MetaValue struct {
+	// Key is the META key, e.g. 10 (0x0a) for the network configuration
+	Key   uint8  `json:"key"`
+	Value string `json:"value"`
+}
+
+// DiskHealthAction defines what happens when the disk health check fails.
+// +kubebuilder:validation:Enum=Enforce;Warn
+type DiskHealthAction string
+
+const (
+	// DiskHealthEnforce refuses to install on an unhealthy disk
+	DiskHealthEnforce DiskHealthAction = "Enforce"
+	// DiskHealthWarn logs a warning and continues the installation
+	DiskHealthWarn DiskHealthAction = "Warn"
+)
+
+// DiskHealthPolicy defines the SMART thresholds of the target disk.
+// Unset thresholds use the defaults from the controller.
+type DiskHealthPolicy struct {
+	Action                DiskHealthAction `json:"action,omitempty"`
+	MaxReallocatedSectors *int64           `json:"maxReallocatedSectors,omitempty"`
+	MaxMediaErrors        *int64           `json:"maxMediaErrors,omitempty"`
+	MaxPercentageUsed     *int64           `json:"maxPercentageUsed,omitempty"`
 }
 
 // ServerObservation are the observable fields of a server.
@@ -33,27 +99,81 @@ type ServerObservation struct {
 	ObservableField string `json:"observableField,omitempty"`
 }
 
+// TalosStatus is the observed state of Talos on a server.
 type TalosStatus struct {
-	Status string `json:"status"`
+	Status string `json:"status,omitempty"`
+	// Version is the Talos version running on the node
+	Version string `json:"version,omitempty"`
+	// Upgrade is the last in-place upgrade of Talos
+	Upgrade *TalosUpgrade `json:"upgrade,omitempty"`
+}
+
+// TalosUpgrade describes an in-place upgrade of Talos.
+type TalosUpgrade struct {
+	FromVersion string `json:"fromVersion"`
+	ToVersion   string `json:"toVersion"`
+	Image       string `json:"image"`
+	Completed   bool   `json:"completed"`
 }
 
 // A ServerStatus represents the observed state of a server.
 type ServerStatus struct {
-	Details hetznerapi.ServerDetails `json:"details,omitempty"`
-	Talos   TalosStatus              `json:"talos,omitempty"`
+	// State is the state of the server when the last run ended
+	State string `json:"state,omitempty"`
+	// LastTransitionTime is the time the server entered the state
+	LastTransitionTime *time.Time `json:"lastTransitionTime,omitempty"`
+	// LastError is the error of the last run, empty when the run succeeded
+	LastError  string                   `json:"lastError,omitempty"`
+	Details    hetznerapi.ServerDetails `json:"details,omitempty"`
+	Talos      TalosStatus              `json:"talos,omitempty"`
+	DiskHealth *hetznerapi.DiskHealth   `json:"diskHealth,omitempty"`
+	// Deprovision reports the last deprovisioning of the server
+	Deprovision *DeprovisionStatus `json:"deprovision,omitempty"`
+	// Conditions are the Ready and Synced conditions set by the Kubernetes controller
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// DeprovisionStatus describes the deprovisioning of a server back to the rescue system.
+type DeprovisionStatus struct {
+	// TalosReset is true when the Talos installation was reset through the Talos API
+	TalosReset    bool     `json:"talosReset"`
+	StoppedArrays []string `json:"stoppedArrays,omitempty"`
+	WipedDevices  []string `json:"wipedDevices,omitempty"`
+	Completed     bool     `json:"completed"`
 }
 
 // A ServerSpec defines the desired state of a server.
 type ServerSpec struct {
 	ForProvider ServerParameters `json:"forProvider"`
+	// CredentialsSecretRef references the Secret holding the Robot webservice username and password.
+	// It is used by the Kubernetes controller, the command line uses HETZNER_USERNAME and HETZNER_PASSWORD.
+	// +optional
+	CredentialsSecretRef *SecretReference `json:"credentialsSecretRef,omitempty"`
+}
+
+// SecretReference references a Secret with the keys username and password.
+type SecretReference struct {
+	Name string `json:"name"`
+	// Namespace of the Secret, the namespace of the Server when empty
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
 }
 
+// A Server is a Hetzner dedicated server installed with Talos.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 type Server struct {
-	Spec   ServerSpec   `json:"spec"`
-	Status ServerStatus `json:"status,omitempty"`
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ServerSpec   `json:"spec"`
+	Status            ServerStatus `json:"status,omitempty"`
 }
 
 // ServerList contains a list of server
+// +kubebuilder:object:root=true
 type ServerList struct {
-	Items []Server `json:"items"`
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Server `json:"items"`
 }
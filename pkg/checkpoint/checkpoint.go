@@ -0,0 +1,263 @@
+// Package checkpoint persists the progress of the server state machine to local files,
+// so an interrupted reconcile can resume where it stopped.
+package checkpoint
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnv is the environment variable holding the passphrase used to encrypt credentials.
+// A random key stored in the state directory is used when it is not set.
+const PassphraseEnv = "THDCTL_STATE_PASSPHRASE"
+
+const keyFile = "state.key"
+
+// Checkpoint is the persisted state of the state machine of a server
+type Checkpoint struct {
+	ServerNumber int `json:"serverNumber"`
+	// Operation is the operation in progress, e.g. reconcile or deprovision
+	Operation string `json:"operation"`
+	State     string `json:"state"`
+	Retries   int    `json:"retries"`
+	// Resets counts the resets into the rescue system since SSH was available, later resets escalate the reset type
+	Resets int `json:"resets,omitempty"`
+	// Completed is set when the run reached its desired state, the next run starts over
+	Completed      bool      `json:"completed,omitempty"`
+	StateEnteredAt time.Time `json:"stateEnteredAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+	// SSHPassword is the one-time password of the rescue system. It is stored encrypted.
+	SSHPassword string `json:"-"`
+
+	EncryptedSSHPassword *Sealed `json:"sshPassword,omitempty"`
+}
+
+// Sealed is a value encrypted with AES-GCM
+type Sealed struct {
+	// Salt is set when the key is derived from a passphrase using scrypt
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// FileStore stores a JSON checkpoint file per server in a directory
+type FileStore struct {
+	Dir string
+	// Passphrase encrypts the credentials. The key file of the directory is used when empty.
+	Passphrase string
+
+	// mu prevents concurrent saves from creating different key files or salts
+	mu sync.Mutex
+	// salt is used by all saves of the store, so scrypt derives the key of a passphrase once per run
+	salt []byte
+	// keys are the keys derived from the passphrase by salt
+	keys map[string][]byte
+}
+
+// NewFileStore creates a store in dir using the passphrase from the environment
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{Dir: dir, Passphrase: os.Getenv(PassphraseEnv)}
+}
+
+func (s *FileStore) path(serverNumber int) string {
+	return filepath.Join(s.Dir, strconv.Itoa(serverNumber)+".json")
+}
+
+// Load returns the checkpoint of a server, nil if there is none
+func (s *FileStore) Load(serverNumber int) (*Checkpoint, error) {
+	data, err := os.ReadFile(s.path(serverNumber))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", s.path(serverNumber), err)
+	}
+	if checkpoint.EncryptedSSHPassword != nil {
+		password, err := s.open(checkpoint.EncryptedSSHPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt SSH password of server %d: %w", serverNumber, err)
+		}
+		checkpoint.SSHPassword = string(password)
+	}
+	return &checkpoint, nil
+}
+
+// Save writes the checkpoint of a server, replacing the previous checkpoint
+func (s *FileStore) Save(checkpoint *Checkpoint) error {
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	stored := *checkpoint
+	stored.EncryptedSSHPassword = nil
+	if checkpoint.SSHPassword != "" {
+		sealed, err := s.seal([]byte(checkpoint.SSHPassword))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt SSH password: %w", err)
+		}
+		stored.EncryptedSSHPassword = sealed
+	}
+
+	data, err := json.MarshalIndent(&stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path(checkpoint.ServerNumber), data)
+}
+
+// Delete removes the checkpoint of a server
+func (s *FileStore) Delete(serverNumber int) error {
+	err := os.Remove(s.path(serverNumber))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *FileStore) seal(plaintext []byte) (*Sealed, error) {
+	var salt []byte
+	if s.Passphrase != "" {
+		var err error
+		if salt, err = s.saveSalt(); err != nil {
+			return nil, err
+		}
+	}
+	gcm, err := s.cipher(salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return &Sealed{Salt: salt, Nonce: nonce, Ciphertext: gcm.Seal(nil, nonce, plaintext, nil)}, nil
+}
+
+func (s *FileStore) open(sealed *Sealed) ([]byte, error) {
+	if sealed.Salt != nil && s.Passphrase == "" {
+		return nil, fmt.Errorf("encrypted with a passphrase, set %s", PassphraseEnv)
+	}
+	gcm, err := s.cipher(sealed.Salt)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, sealed.Nonce, sealed.Ciphertext, nil)
+}
+
+// cipher returns AES-GCM using a key derived from the passphrase and salt, or the key file without salt
+func (s *FileStore) cipher(salt []byte) (cipher.AEAD, error) {
+	var key []byte
+	var err error
+	if salt != nil {
+		key, err = s.passphraseKey(salt)
+	} else {
+		key, err = s.fileKey()
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// saveSalt returns the salt of the saves of the store, it is created by the first save
+func (s *FileStore) saveSalt() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.salt == nil {
+		salt := make([]byte, 16)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, err
+		}
+		s.salt = salt
+	}
+	return s.salt, nil
+}
+
+// passphraseKey derives the key of the passphrase and salt using scrypt, the key is cached by salt
+func (s *FileStore) passphraseKey(salt []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[string(salt)]; ok {
+		return key, nil
+	}
+	key, err := scrypt.Key([]byte(s.Passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	if s.keys == nil {
+		s.keys = map[string][]byte{}
+	}
+	s.keys[string(salt)] = key
+	return key, nil
+}
+
+// fileKey reads the key file of the state directory, creating it if it does not exist
+func (s *FileStore) fileKey() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := filepath.Join(s.Dir, keyFile)
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid key file %s", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, key, 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// writeFileAtomic writes the file through a temporary file, so a crash never leaves a partial checkpoint
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
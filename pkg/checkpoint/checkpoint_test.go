@@ -0,0 +1,96 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCheckpoint() *Checkpoint {
+	now := time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC)
+	return &Checkpoint{
+		ServerNumber:   123456,
+		Operation:      "reconcile",
+		State:          "WaitForReboot",
+		Retries:        2,
+		StateEnteredAt: now,
+		UpdatedAt:      now.Add(10 * time.Second),
+		SSHPassword:    "one-time-secret",
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	for name, passphrase := range map[string]string{"key file": "", "passphrase": "correct horse"} {
+		t.Run(name, func(t *testing.T) {
+			store := &FileStore{Dir: t.TempDir(), Passphrase: passphrase}
+			checkpoint := testCheckpoint()
+
+			require.NoError(t, store.Save(checkpoint))
+			loaded, err := store.Load(123456)
+
+			require.NoError(t, err)
+			loaded.EncryptedSSHPassword = nil
+			assert.Equal(t, checkpoint, loaded)
+		})
+	}
+}
+
+func TestPasswordIsNotStoredInPlaintext(t *testing.T) {
+	store := &FileStore{Dir: t.TempDir()}
+	require.NoError(t, store.Save(testCheckpoint()))
+
+	data, err := os.ReadFile(filepath.Join(store.Dir, "123456.json"))
+
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "one-time-secret")
+	info, err := os.Stat(filepath.Join(store.Dir, keyFile))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestLoadWithWrongPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, (&FileStore{Dir: dir, Passphrase: "correct horse"}).Save(testCheckpoint()))
+
+	_, err := (&FileStore{Dir: dir, Passphrase: "battery staple"}).Load(123456)
+	assert.Error(t, err)
+
+	_, err = (&FileStore{Dir: dir}).Load(123456)
+	assert.ErrorContains(t, err, PassphraseEnv)
+}
+
+func TestPassphraseKeyIsDerivedOnce(t *testing.T) {
+	store := &FileStore{Dir: t.TempDir(), Passphrase: "correct horse"}
+	first := testCheckpoint()
+	second := testCheckpoint()
+	second.ServerNumber = 654321
+
+	require.NoError(t, store.Save(first))
+	require.NoError(t, store.Save(first))
+	require.NoError(t, store.Save(second))
+
+	// the saves share the salt, the key is derived once
+	loaded, err := store.Load(654321)
+	require.NoError(t, err)
+	assert.Equal(t, store.salt, loaded.EncryptedSSHPassword.Salt)
+	assert.Len(t, store.keys, 1)
+
+	// a new run derives the key of the salt again
+	loaded, err = (&FileStore{Dir: store.Dir, Passphrase: "correct horse"}).Load(123456)
+	require.NoError(t, err)
+	assert.Equal(t, "one-time-secret", loaded.SSHPassword)
+}
+
+func TestLoadMissingCheckpoint(t *testing.T) {
+	store := &FileStore{Dir: t.TempDir()}
+
+	checkpoint, err := store.Load(1)
+
+	assert.NoError(t, err)
+	assert.Nil(t, checkpoint)
+	assert.NoError(t, store.Delete(1))
+}
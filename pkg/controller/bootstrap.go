@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"os"
+
+	"github.com/eriklundjensen/thdctl/pkg/kubeconfig"
+	"github.com/eriklundjensen/thdctl/pkg/talos"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// etcdService is the id of the etcd service on Talos control plane nodes
+const etcdService = "etcd"
+
+// secureTalosClient connects to the Talos API of the server using the talosconfig
+func (sm *StateMachine) secureTalosClient() (talos.Client, ServerStatus, bool) {
+	host, err := sm.serverIP()
+	if err != nil {
+		sm.log.WithError(err).Error("Error getting server IP")
+		return nil, RobotAPIUnavailable, false
+	}
+	client, err := sm.talosConnector.Secure(host)
+	if err != nil {
+		sm.log.WithError(err).Error("Failed to connect to Talos API")
+		return nil, sm.state, false
+	}
+	return client, sm.state, true
+}
+
+// etcdState returns the etcd service of the node, nil if the node does not run etcd
+func etcdState(ctx context.Context, client talos.Client) (*talos.Service, error) {
+	services, err := client.ServiceList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range services {
+		if services[i].ID == etcdService {
+			return &services[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// bootstrap bootstraps etcd on the node. A node where etcd is already running, or which reports
+// that etcd has been bootstrapped, is never bootstrapped again.
+func (sm *StateMachine) bootstrap() ServerStatus {
+	client, state, ok := sm.secureTalosClient()
+	if !ok {
+		return state
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(sm.spanCtx, talosAPITimeout)
+	defer cancel()
+
+	etcd, err := etcdState(ctx, client)
+	if err != nil {
+		sm.log.WithError(err).Error("Failed to list Talos services")
+		return sm.state
+	}
+	if etcd == nil {
+		sm.log.Error("etcd service not found, bootstrap requires a control plane node")
+		return sm.state
+	}
+	if etcd.State == "Running" {
+		sm.log.Info("etcd is already running, skipping bootstrap")
+		sm.retries = 0
+		return Bootstrapped
+	}
+
+	if err := client.Bootstrap(ctx); err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			sm.log.Info("etcd has already been bootstrapped")
+			sm.retries = 0
+			return Bootstrapped
+		}
+		sm.log.WithError(err).Error("Failed to bootstrap etcd")
+		return sm.state
+	}
+
+	sm.log.Info("etcd bootstrapped")
+	sm.retries = 0
+	return Bootstrapped
+}
+
+// checkEtcd waits for the etcd service to report healthy
+func (sm *StateMachine) checkEtcd() ServerStatus {
+	client, state, ok := sm.secureTalosClient()
+	if !ok {
+		return state
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(sm.spanCtx, talosAPITimeout)
+	defer cancel()
+
+	etcd, err := etcdState(ctx, client)
+	if err != nil {
+		sm.log.WithError(err).Warn("Failed to list Talos services")
+		return sm.state
+	}
+	if etcd == nil || !etcd.Healthy {
+		sm.log.Info("Waiting for etcd to become healthy")
+		return sm.state
+	}
+
+	sm.log.Info("etcd is healthy")
+	sm.retries = 0
+	return EtcdHealthy
+}
+
+// checkKubernetes waits for the Kubernetes API to become ready and writes the admin kubeconfig
+func (sm *StateMachine) checkKubernetes() ServerStatus {
+	client, state, ok := sm.secureTalosClient()
+	if !ok {
+		return state
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(sm.spanCtx, talosAPITimeout)
+	defer cancel()
+
+	config, err := client.Kubeconfig(ctx)
+	if err != nil {
+		sm.log.WithError(err).Warn("Failed to fetch kubeconfig")
+		return sm.state
+	}
+	if err := kubeconfig.Ready(ctx, config); err != nil {
+		sm.log.WithError(err).Info("Waiting for the Kubernetes API")
+		return sm.state
+	}
+
+	if sm.server.Kubeconfig != "" {
+		if err := os.WriteFile(sm.server.Kubeconfig, config, 0o600); err != nil {
+			sm.log.WithError(err).Error("Failed to write kubeconfig")
+			return sm.state
+		}
+		sm.log.WithField("kubeconfig", sm.server.Kubeconfig).Info("Kubeconfig written")
+	}
+	sm.retries = 0
+	return KubernetesAvailable
+}
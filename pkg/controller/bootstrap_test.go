@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/talos"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newBootstrapTestStateMachine(t *testing.T, secure talos.Client) *StateMachine {
+	t.Helper()
+	server := &v1alpha1.ServerParameters{ServerNumber: 1, Talosconfig: "talosconfig", Bootstrap: true}
+	sm := newTalosTestStateMachine(t, server, &fakeConnector{secure: secure})
+	sm.state = WaitingForBootstrap
+	return sm
+}
+
+func TestBootstrap(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("ServiceList").Return([]talos.Service{{ID: "etcd", State: "Preparing"}}, nil)
+	secure.On("Bootstrap").Return(nil).Once()
+	sm := newBootstrapTestStateMachine(t, secure)
+
+	assert.Equal(t, Bootstrapped, sm.bootstrap())
+	secure.AssertExpectations(t)
+}
+
+func TestBootstrapSkippedWhenEtcdRunning(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("ServiceList").Return([]talos.Service{{ID: "etcd", State: "Running", Healthy: true}}, nil)
+	sm := newBootstrapTestStateMachine(t, secure)
+
+	assert.Equal(t, Bootstrapped, sm.bootstrap())
+	secure.AssertNotCalled(t, "Bootstrap")
+}
+
+func TestBootstrapAlreadyExists(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("ServiceList").Return([]talos.Service{{ID: "etcd", State: "Preparing"}}, nil)
+	secure.On("Bootstrap").Return(status.Error(codes.AlreadyExists, "etcd data directory is not empty"))
+	sm := newBootstrapTestStateMachine(t, secure)
+
+	assert.Equal(t, Bootstrapped, sm.bootstrap())
+}
+
+func TestBootstrapRequiresEtcd(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("ServiceList").Return([]talos.Service{{ID: "kubelet", State: "Running"}}, nil)
+	sm := newBootstrapTestStateMachine(t, secure)
+
+	assert.Equal(t, WaitingForBootstrap, sm.bootstrap())
+	secure.AssertNotCalled(t, "Bootstrap")
+}
+
+func TestCheckEtcd(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("ServiceList").Return([]talos.Service{{ID: "etcd", State: "Running"}}, nil).Once()
+	secure.On("ServiceList").Return([]talos.Service{{ID: "etcd", State: "Running", Healthy: true}}, nil)
+	sm := newBootstrapTestStateMachine(t, secure)
+	sm.state = Bootstrapped
+
+	assert.Equal(t, Bootstrapped, sm.checkEtcd())
+	assert.Equal(t, EtcdHealthy, sm.checkEtcd())
+}
+
+func TestCheckKubernetesKeepsStateUntilReady(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("Kubeconfig").Return(nil, errors.New("kubeconfig not available")).Once()
+	secure.On("Kubeconfig").Return([]byte("current-context: admin@test\n"), nil)
+	sm := newBootstrapTestStateMachine(t, secure)
+	sm.state = EtcdHealthy
+
+	assert.Equal(t, EtcdHealthy, sm.checkKubernetes())
+	assert.Equal(t, EtcdHealthy, sm.checkKubernetes())
+}
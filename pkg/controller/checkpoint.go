@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"github.com/eriklundjensen/thdctl/pkg/checkpoint"
+	"github.com/sirupsen/logrus"
+)
+
+// CheckpointStore persists the progress of the state machine between runs
+type CheckpointStore interface {
+	Load(serverNumber int) (*checkpoint.Checkpoint, error)
+	Save(checkpoint *checkpoint.Checkpoint) error
+}
+
+const (
+	operationReconcile   = "reconcile"
+	operationDeprovision = "deprovision"
+)
+
+func (sm *StateMachine) operation() string {
+	if sm.deprovision != nil {
+		return operationDeprovision
+	}
+	return operationReconcile
+}
+
+// resumable reports whether a run can continue from a state. Completed and failed runs start over,
+// runs completing in other states, e.g. at a target state, are marked completed in the checkpoint.
+func resumable(state ServerStatus) bool {
+	switch state {
+	case Unknown, WaitingForBootstrap, KubernetesAvailable, Deprovisioned,
+		ServerNotFound, MissingServerNumber, RobotAPIUnavailable, DiskUnhealthy, DiskNotFound:
+		return false
+	}
+	return true
+}
+
+// Resume loads the checkpoint of the server and continues an interrupted run of the same operation.
+// The rescue system password of the checkpoint is always restored. Progress is saved to the store from now on.
+func (sm *StateMachine) Resume(store CheckpointStore) error {
+	sm.checkpoints = store
+	saved, err := store.Load(sm.server.ServerNumber)
+	if err != nil || saved == nil {
+		return err
+	}
+
+	if saved.SSHPassword != "" {
+		sm.lastSSHPassword = saved.SSHPassword
+	}
+	state := ServerStatus(saved.State)
+	if saved.Completed || saved.Operation != sm.operation() || !resumable(state) {
+		return nil
+	}
+	if deadline, ok := sm.timeouts.StateDeadlines[state]; ok && sm.clock.Now().Sub(saved.StateEnteredAt) >= deadline {
+		sm.log.WithFields(logrus.Fields{
+			"state": state,
+			"since": saved.StateEnteredAt,
+		}).Info("Deadline of the checkpoint state exceeded, starting over")
+		return nil
+	}
+
+	sm.log.WithFields(logrus.Fields{
+		"state":   state,
+		"since":   saved.StateEnteredAt,
+		"retries": saved.Retries,
+	}).Info("Resuming from checkpoint")
+	sm.state = state
+	sm.retries = saved.Retries
+	sm.resets = saved.Resets
+	sm.stateEnteredAt = saved.StateEnteredAt
+	return nil
+}
+
+func (sm *StateMachine) saveCheckpoint() {
+	if sm.checkpoints == nil {
+		return
+	}
+	err := sm.checkpoints.Save(&checkpoint.Checkpoint{
+		ServerNumber:   sm.server.ServerNumber,
+		Operation:      sm.operation(),
+		State:          sm.state.String(),
+		Retries:        sm.retries,
+		Resets:         sm.resets,
+		Completed:      sm.completed,
+		StateEnteredAt: sm.stateEnteredAt,
+		UpdatedAt:      sm.clock.Now(),
+		SSHPassword:    sm.lastSSHPassword,
+	})
+	if err != nil {
+		sm.log.WithError(err).Warn("Failed to save checkpoint")
+	}
+}
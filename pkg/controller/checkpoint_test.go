@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/checkpoint"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi/sshtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCheckpointTestStateMachine() *StateMachine {
+	return NewStateMachine(new(mockRobotClient), new(sshtest.MockClient), &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+}
+
+func TestResumeFromCheckpoint(t *testing.T) {
+	store := &checkpoint.FileStore{Dir: t.TempDir()}
+	entered := time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, store.Save(&checkpoint.Checkpoint{
+		ServerNumber:   1,
+		Operation:      operationReconcile,
+		State:          WaitForReboot.String(),
+		Retries:        3,
+		StateEnteredAt: entered,
+		SSHPassword:    "secret",
+	}))
+	sm := newCheckpointTestStateMachine()
+	sm.SetClock(newFakeClock(entered.Add(5 * time.Minute)))
+
+	require.NoError(t, sm.Resume(store))
+
+	assert.Equal(t, WaitForReboot, sm.state)
+	assert.Equal(t, 3, sm.retries)
+	assert.Equal(t, entered, sm.stateEnteredAt)
+	assert.Equal(t, "secret", sm.lastSSHPassword)
+}
+
+func TestResumeStartsOverAfterStateDeadline(t *testing.T) {
+	store := &checkpoint.FileStore{Dir: t.TempDir()}
+	entered := time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, store.Save(&checkpoint.Checkpoint{
+		ServerNumber:   1,
+		Operation:      operationReconcile,
+		State:          WaitForReboot.String(),
+		StateEnteredAt: entered,
+		SSHPassword:    "secret",
+	}))
+	sm := newCheckpointTestStateMachine()
+	sm.SetClock(newFakeClock(entered.Add(time.Hour)))
+
+	require.NoError(t, sm.Resume(store))
+
+	assert.Equal(t, Unknown, sm.state)
+	assert.Equal(t, "secret", sm.lastSSHPassword)
+}
+
+func TestResumeStartsOverAfterCompletedRun(t *testing.T) {
+	store := &checkpoint.FileStore{Dir: t.TempDir()}
+	require.NoError(t, store.Save(&checkpoint.Checkpoint{
+		ServerNumber: 1,
+		Operation:    operationReconcile,
+		State:        WaitingForBootstrap.String(),
+		SSHPassword:  "secret",
+	}))
+	sm := newCheckpointTestStateMachine()
+
+	require.NoError(t, sm.Resume(store))
+
+	assert.Equal(t, Unknown, sm.state)
+	assert.Equal(t, "secret", sm.lastSSHPassword)
+}
+
+func TestResumeStartsOverAfterRunCompletedInOtherState(t *testing.T) {
+	store := &checkpoint.FileStore{Dir: t.TempDir()}
+	// the server is configured outside of thdctl, the run completes when the Talos API is available
+	sm := newCheckpointTestStateMachine()
+	require.NoError(t, sm.Resume(store))
+	sm.StateChange(TalosAPIAvailable)
+	require.NoError(t, sm.Run(context.Background()))
+
+	saved, err := store.Load(1)
+	require.NoError(t, err)
+	assert.True(t, saved.Completed)
+
+	resumed := newCheckpointTestStateMachine()
+	require.NoError(t, resumed.Resume(store))
+
+	assert.Equal(t, Unknown, resumed.state)
+}
+
+func TestResumeAfterInterruptedRun(t *testing.T) {
+	store := &checkpoint.FileStore{Dir: t.TempDir()}
+	sm := newCheckpointTestStateMachine()
+	require.NoError(t, sm.Resume(store))
+	sm.StateChange(TalosAPIAvailable)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Error(t, sm.Run(ctx))
+
+	resumed := newCheckpointTestStateMachine()
+	require.NoError(t, resumed.Resume(store))
+
+	assert.Equal(t, TalosAPIAvailable, resumed.state)
+}
+
+func TestResumeIgnoresOtherOperation(t *testing.T) {
+	store := &checkpoint.FileStore{Dir: t.TempDir()}
+	require.NoError(t, store.Save(&checkpoint.Checkpoint{
+		ServerNumber: 1,
+		Operation:    operationDeprovision,
+		State:        SSHAvailable.String(),
+	}))
+	sm := newCheckpointTestStateMachine()
+
+	require.NoError(t, sm.Resume(store))
+
+	assert.Equal(t, Unknown, sm.state)
+}
+
+func TestSaveCheckpoint(t *testing.T) {
+	store := &checkpoint.FileStore{Dir: t.TempDir()}
+	sm := newCheckpointTestStateMachine()
+	require.NoError(t, sm.Resume(store))
+	sm.lastSSHPassword = "secret"
+	sm.StateChange(RequiresReboot)
+
+	sm.saveCheckpoint()
+
+	saved, err := store.Load(1)
+	require.NoError(t, err)
+	assert.Equal(t, RequiresReboot.String(), saved.State)
+	assert.Equal(t, operationReconcile, saved.Operation)
+	assert.Equal(t, "secret", saved.SSHPassword)
+	assert.False(t, saved.StateEnteredAt.IsZero())
+}
@@ -0,0 +1,56 @@
+package controller
+
+import "time"
+
+// Clock provides the time to the state machine. Tests use a fake clock to run the transitions instantly.
+type Clock interface {
+	Now() time.Time
+	// After sends the current time on the returned channel after the duration elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Timeouts define how often the state machine polls a state and how long it may stay in it
+type Timeouts struct {
+	// PollInterval is the delay after a state has been entered
+	PollInterval time.Duration
+	// MaxPollInterval limits the delay, it doubles with every poll that does not change the state
+	MaxPollInterval time.Duration
+	// StateDeadlines is the maximum time spent in a state. States without a deadline fail after max retries.
+	StateDeadlines map[ServerStatus]time.Duration
+}
+
+// DefaultTimeouts returns the timeouts of a server, states waiting for a reboot or installation get a deadline
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		PollInterval:    5 * time.Second,
+		MaxPollInterval: 30 * time.Second,
+		StateDeadlines: map[ServerStatus]time.Duration{
+			// the server is initialized again when its state can not be determined
+			Unknown:             5 * time.Minute,
+			WaitForReboot:       15 * time.Minute,
+			TalosImageInstalled: 10 * time.Minute,
+			ConfigApplied:       10 * time.Minute,
+			TalosUpgrading:      15 * time.Minute,
+			Bootstrapped:        10 * time.Minute,
+			EtcdHealthy:         15 * time.Minute,
+		},
+	}
+}
+
+// pollInterval returns the delay after the given number of polls in the same state
+func (t Timeouts) pollInterval(polls int) time.Duration {
+	interval := t.PollInterval
+	for i := 1; i < polls && interval < t.MaxPollInterval; i++ {
+		interval *= 2
+	}
+	if t.MaxPollInterval > 0 && interval > t.MaxPollInterval {
+		return t.MaxPollInterval
+	}
+	return interval
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/sirupsen/logrus"
+)
+
+// DeprovisionOptions configures the deprovisioning of a server
+type DeprovisionOptions struct {
+	// ResetTalos resets the Talos installation through the Talos API before the rescue system is booted
+	ResetTalos bool
+	// Graceful cordons and drains the node and leaves etcd before the reset
+	Graceful bool
+}
+
+// Deprovision makes the next Run reset the server, boot the rescue system and wipe all disks
+func (sm *StateMachine) Deprovision(options DeprovisionOptions) {
+	sm.deprovision = &options
+	sm.status.Deprovision = &v1alpha1.DeprovisionStatus{}
+	sm.StateChange(Deprovisioning)
+}
+
+// startDeprovision enables the rescue system and reboots the server into it,
+// either by resetting Talos or by the reset escalation, see resetEscalation.
+func (sm *StateMachine) startDeprovision() ServerStatus {
+	if sm.server.ServerNumber == 0 {
+		return MissingServerNumber
+	}
+	rescue, err := hetznerapi.EnableRescueSystem(sm.client, sm.server.ServerNumber)
+	if err != nil || rescue == nil {
+		sm.log.WithError(err).Error("Failed to enable rescue system")
+		return sm.state
+	}
+	sm.lastSSHPassword = rescue.Rescue.Password
+	sm.saveCheckpoint()
+
+	if sm.deprovision.ResetTalos {
+		err := sm.resetTalos()
+		if err == nil {
+			sm.status.Deprovision.TalosReset = true
+			sm.retries = 0
+			return WaitForReboot
+		}
+		sm.log.WithError(err).Warn("Talos reset failed, resetting the server")
+	}
+
+	sm.retries = 0
+	return RequiresReboot
+}
+
+// resetTalos resets the Talos installation and reboots the node
+func (sm *StateMachine) resetTalos() error {
+	host, err := sm.serverIP()
+	if err != nil {
+		return err
+	}
+	client, err := sm.talosConnector.Secure(host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(sm.spanCtx, talosAPITimeout)
+	defer cancel()
+	if err := client.Reset(ctx, sm.deprovision.Graceful, true); err != nil {
+		return err
+	}
+	sm.log.WithField("graceful", sm.deprovision.Graceful).Info("Talos reset initiated")
+	return nil
+}
+
+// wipeDisks tears down software RAID and wipes the signatures of all disks in the rescue system
+func (sm *StateMachine) wipeDisks() ServerStatus {
+	output, err := sm.sshClient.ListDisks()
+	if err != nil {
+		sm.log.WithError(err).Error("Failed to list disks")
+		return SSHAvailable
+	}
+	disks, err := hetznerapi.ParseLSBLKOutput(output)
+	if err != nil {
+		sm.log.WithError(err).Error("Failed to parse disks")
+		return SSHAvailable
+	}
+
+	var names []string
+	for _, disk := range disks {
+		if disk.Type == "disk" {
+			names = append(names, disk.Name)
+		}
+	}
+	if len(names) == 0 {
+		sm.log.Error("No disks found in rescue system")
+		return SSHAvailable
+	}
+
+	report, err := teardownRaid(sm.sshClient, names[0])
+	if err != nil {
+		sm.log.WithError(err).Error("Failed to tear down software RAID")
+		return SSHAvailable
+	}
+	for _, name := range names {
+		if slices.Contains(report.WipedDevices, name) {
+			continue
+		}
+		if output, err := sm.sshClient.WipeDisk(name); err != nil {
+			sm.log.WithError(fmt.Errorf("%w (%s)", err, output)).Errorf("Failed to wipe %s", name)
+			return SSHAvailable
+		}
+		report.WipedDevices = append(report.WipedDevices, name)
+	}
+
+	sm.status.Deprovision.StoppedArrays = report.StoppedArrays
+	sm.status.Deprovision.WipedDevices = report.WipedDevices
+	sm.status.Deprovision.Completed = true
+	sm.retries = 0
+	return Deprovisioned
+}
+
+// logDeprovisionReport writes the final report of the deprovisioning
+func (sm *StateMachine) logDeprovisionReport() {
+	report := sm.status.Deprovision
+	sm.log.WithFields(logrus.Fields{
+		"serverNumber":  sm.server.ServerNumber,
+		"talosReset":    report.TalosReset,
+		"stoppedArrays": report.StoppedArrays,
+		"wipedDevices":  report.WipedDevices,
+	}).Info("Server deprovisioned, rescue system is running")
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi/sshtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const rescueEnabled = `{"rescue": {"server_ip": "192.0.2.10", "server_number": 1, "active": true, "password": "secret"}}`
+
+const lsblkTwoDisks = `NAME        MAJ:MIN RM   SIZE RO TYPE MOUNTPOINTS
+loop0         7:0    0   3.1G  1 loop
+sda           8:0    0 476.9G  0 disk
+├─sda1        8:1    0    32G  0 part
+└─md0         9:0    0    32G  0 raid1
+sdb           8:16   0 476.9G  0 disk
+├─sdb1        8:17   0    32G  0 part
+└─md0         9:0    0    32G  0 raid1
+`
+
+func newDeprovisionTestStateMachine(t *testing.T, secure *mockTalosClient, options DeprovisionOptions) *StateMachine {
+	t.Helper()
+	client := new(mockRobotClient)
+	client.On("Get", "boot/1/rescue").Return(rescueInactive, nil)
+	client.On("Post", "boot/1/rescue", mock.Anything).Return(rescueEnabled, nil)
+	server := &v1alpha1.ServerParameters{ServerNumber: 1, Talosconfig: "talosconfig"}
+	sm := NewStateMachine(client, new(sshtest.MockClient), server, 5)
+	connector := &fakeConnector{}
+	if secure != nil {
+		connector.secure = secure
+	}
+	sm.talosConnector = connector
+	sm.Deprovision(options)
+	return sm
+}
+
+func TestStartDeprovisionResetsTalos(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("Reset", true, true).Return(nil)
+	sm := newDeprovisionTestStateMachine(t, secure, DeprovisionOptions{ResetTalos: true, Graceful: true})
+
+	assert.Equal(t, WaitForReboot, sm.startDeprovision())
+	assert.Equal(t, "secret", sm.lastSSHPassword)
+	assert.True(t, sm.Status().Deprovision.TalosReset)
+	secure.AssertExpectations(t)
+}
+
+func TestStartDeprovisionFallsBackToHardwareReset(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("Reset", false, true).Return(errors.New("connection refused"))
+	sm := newDeprovisionTestStateMachine(t, secure, DeprovisionOptions{ResetTalos: true})
+
+	assert.Equal(t, RequiresReboot, sm.startDeprovision())
+	assert.False(t, sm.Status().Deprovision.TalosReset)
+}
+
+func TestStartDeprovisionWithoutReset(t *testing.T) {
+	sm := newDeprovisionTestStateMachine(t, nil, DeprovisionOptions{})
+
+	assert.Equal(t, RequiresReboot, sm.startDeprovision())
+}
+
+func TestWipeDisks(t *testing.T) {
+	sm := newDeprovisionTestStateMachine(t, nil, DeprovisionOptions{})
+	sshClient := sm.sshClient.(*sshtest.MockClient)
+	sshClient.On("ListDisks").Return(lsblkTwoDisks, nil)
+	sshClient.On("ReadMDStat").Return("md0 : active raid1 sda1[0] sdb1[1]\n", nil)
+	sshClient.On("StopRaidArray", "md0").Return("", nil)
+	sshClient.On("ZeroRaidSuperblock", mock.Anything).Return("", nil)
+	sshClient.On("WipeDisk", mock.Anything).Return("", nil)
+
+	assert.Equal(t, Deprovisioned, sm.wipeDisks())
+	assert.Equal(t, &v1alpha1.DeprovisionStatus{
+		StoppedArrays: []string{"md0"},
+		WipedDevices:  []string{"sda1", "sdb1", "sda", "sdb"},
+		Completed:     true,
+	}, sm.Status().Deprovision)
+}
+
+func TestWipeDisksWithoutRaid(t *testing.T) {
+	sm := newDeprovisionTestStateMachine(t, nil, DeprovisionOptions{})
+	sshClient := sm.sshClient.(*sshtest.MockClient)
+	sshClient.On("ListDisks").Return(lsblkTwoDisks, nil)
+	sshClient.On("ReadMDStat").Return("Personalities : \nunused devices: <none>\n", nil)
+	sshClient.On("WipeDisk", "sda").Return("", nil).Once()
+	sshClient.On("WipeDisk", "sdb").Return("", nil).Once()
+
+	assert.Equal(t, Deprovisioned, sm.wipeDisks())
+	assert.Equal(t, []string{"sda", "sdb"}, sm.Status().Deprovision.WipedDevices)
+	sshClient.AssertExpectations(t)
+}
+
+func TestWipeDisksFailureKeepsSSHAvailable(t *testing.T) {
+	sm := newDeprovisionTestStateMachine(t, nil, DeprovisionOptions{})
+	sshClient := sm.sshClient.(*sshtest.MockClient)
+	sshClient.On("ListDisks").Return("", errors.New("session closed"))
+
+	assert.Equal(t, SSHAvailable, sm.wipeDisks())
+	assert.False(t, sm.Status().Deprovision.Completed)
+}
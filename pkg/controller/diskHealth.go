@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+)
+
+// Default SMART thresholds used when the policy does not define them
+const (
+	DefaultMaxReallocatedSectors int64 = 10
+	DefaultMaxMediaErrors        int64 = 0
+	DefaultMaxPercentageUsed     int64 = 90
+)
+
+// readDiskHealth reads the SMART health of the disk in the rescue system
+func readDiskHealth(sshClient hetznerapi.SSHClientInterface, disk string) (*hetznerapi.DiskHealth, error) {
+	if strings.HasPrefix(disk, "nvme") {
+		output, err := sshClient.NVMeSmartLog(disk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read nvme smart-log of %s: %w", disk, err)
+		}
+		return hetznerapi.ParseNVMeSmartLog(disk, output)
+	}
+
+	output, err := sshClient.SmartHealth(disk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SMART health of %s: %w", disk, err)
+	}
+	return hetznerapi.ParseSmartctlOutput(disk, output)
+}
+
+// diskHealthViolations returns the thresholds of the policy exceeded by the disk
+func diskHealthViolations(health *hetznerapi.DiskHealth, policy *v1alpha1.DiskHealthPolicy) []string {
+	var violations []string
+	if !health.Passed {
+		violations = append(violations, "overall SMART health assessment failed")
+	}
+	if max := threshold(policy.MaxReallocatedSectors, DefaultMaxReallocatedSectors); health.ReallocatedSectors > max {
+		violations = append(violations, fmt.Sprintf("reallocated sectors %d exceeds %d", health.ReallocatedSectors, max))
+	}
+	if max := threshold(policy.MaxMediaErrors, DefaultMaxMediaErrors); health.MediaErrors > max {
+		violations = append(violations, fmt.Sprintf("media errors %d exceeds %d", health.MediaErrors, max))
+	}
+	if max := threshold(policy.MaxPercentageUsed, DefaultMaxPercentageUsed); health.PercentageUsed > max {
+		violations = append(violations, fmt.Sprintf("wear level %d%% exceeds %d%%", health.PercentageUsed, max))
+	}
+	return violations
+}
+
+func threshold(value *int64, defaultValue int64) int64 {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi/sshtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskHealthViolations(t *testing.T) {
+	maxReallocated := int64(100)
+	tests := []struct {
+		name       string
+		health     hetznerapi.DiskHealth
+		policy     v1alpha1.DiskHealthPolicy
+		violations int
+	}{
+		{"healthy", hetznerapi.DiskHealth{Passed: true, ReallocatedSectors: 2, PercentageUsed: 20}, v1alpha1.DiskHealthPolicy{}, 0},
+		{"failed assessment", hetznerapi.DiskHealth{Passed: false}, v1alpha1.DiskHealthPolicy{}, 1},
+		{"default thresholds", hetznerapi.DiskHealth{Passed: true, ReallocatedSectors: 11, MediaErrors: 1, PercentageUsed: 91}, v1alpha1.DiskHealthPolicy{}, 3},
+		{"custom threshold", hetznerapi.DiskHealth{Passed: true, ReallocatedSectors: 50}, v1alpha1.DiskHealthPolicy{MaxReallocatedSectors: &maxReallocated}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Len(t, diskHealthViolations(&tt.health, &tt.policy), tt.violations)
+		})
+	}
+}
+
+func TestReadDiskHealthUsesNVMeSmartLog(t *testing.T) {
+	sshClient := new(sshtest.MockClient)
+	sshClient.On("NVMeSmartLog", "nvme0n1").Return(`{"critical_warning": 0, "percent_used": 5, "media_errors": 0}`, nil)
+
+	health, err := readDiskHealth(sshClient, "nvme0n1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), health.PercentageUsed)
+	sshClient.AssertExpectations(t)
+}
+
+func TestReadDiskHealthError(t *testing.T) {
+	sshClient := new(sshtest.MockClient)
+	sshClient.On("SmartHealth", "sda").Return("", errors.New("command not found"))
+
+	_, err := readDiskHealth(sshClient, "sda")
+
+	assert.Error(t, err)
+}
+
+func TestCheckDiskHealthPolicy(t *testing.T) {
+	unhealthy := `{"smart_status": {"passed": true}, "ata_smart_attributes": {"table": [{"id": 5, "value": 90, "raw": {"value": 400}}]}}`
+	tests := []struct {
+		action  v1alpha1.DiskHealthAction
+		state   ServerStatus
+		proceed bool
+	}{
+		{v1alpha1.DiskHealthEnforce, DiskUnhealthy, false},
+		{v1alpha1.DiskHealthWarn, SSHAvailable, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.action), func(t *testing.T) {
+			sshClient := new(sshtest.MockClient)
+			sshClient.On("SmartHealth", "sda").Return(unhealthy, nil)
+			server := &v1alpha1.ServerParameters{ServerNumber: 1, Disk: "sda", DiskHealth: &v1alpha1.DiskHealthPolicy{Action: tt.action}}
+			sm := NewStateMachine(nil, sshClient, server, 5)
+
+			state, proceed := sm.checkDiskHealth()
+
+			assert.Equal(t, tt.state, state)
+			assert.Equal(t, tt.proceed, proceed)
+			assert.Equal(t, int64(400), sm.Status().DiskHealth.ReallocatedSectors)
+		})
+	}
+}
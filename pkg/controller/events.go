@@ -0,0 +1,49 @@
+package controller
+
+import "time"
+
+// Failed is the target state of the transition published when a run fails, e.g. when max retries are reached.
+// The state machine stays in the state it failed in.
+const Failed ServerStatus = "Failed"
+
+// Reasons of the transitions
+const (
+	ReasonMaxRetries       = "MaxRetriesReached"
+	ReasonDeadlineExceeded = "DeadlineExceeded"
+	ReasonStopped          = "Stopped"
+	ReasonInvalidState     = "InvalidState"
+)
+
+// Transition is a state change of a server
+type Transition struct {
+	ServerNumber int          `json:"serverNumber"`
+	From         ServerStatus `json:"from"`
+	To           ServerStatus `json:"to"`
+	Time         time.Time    `json:"time"`
+	// Reason explains transitions not caused by a handler, e.g. DeadlineExceeded
+	Reason string `json:"reason,omitempty"`
+	// Error is the error of a failed run
+	Error string `json:"error,omitempty"`
+}
+
+// Subscriber receives the transitions of a state machine. It is called synchronously, slow subscribers delay the run.
+type Subscriber func(transition Transition)
+
+// Subscribe registers a subscriber receiving all following transitions
+func (sm *StateMachine) Subscribe(subscriber Subscriber) {
+	sm.subscribers = append(sm.subscribers, subscriber)
+}
+
+func (sm *StateMachine) publish(transition Transition) {
+	transition.ServerNumber = sm.server.ServerNumber
+	transition.Time = sm.clock.Now().UTC()
+	for _, subscriber := range sm.subscribers {
+		subscriber(transition)
+	}
+}
+
+// fail records the reason of a failed run, the failure is published by Run
+func (sm *StateMachine) fail(reason string, err error) error {
+	sm.failureReason = reason
+	return err
+}
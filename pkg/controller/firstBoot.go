@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/eriklundjensen/thdctl/pkg/talos/meta"
+	"github.com/sirupsen/logrus"
+)
+
+// validPartitionNode matches partition device nodes reported by sfdisk, e.g. /dev/sda4 or /dev/nvme0n1p4
+var validPartitionNode = regexp.MustCompile(`^/dev/[a-z0-9]+$`)
+
+// metaValues collects the META values of the first boot configuration
+func metaValues(cfg *v1alpha1.FirstBootConfig) (map[uint8][]byte, error) {
+	values := map[uint8][]byte{}
+	for _, value := range cfg.Meta {
+		values[value.Key] = []byte(value.Value)
+	}
+	if cfg.NetworkConfigFile != "" {
+		data, err := os.ReadFile(cfg.NetworkConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading network config: %w", err)
+		}
+		values[meta.MetalNetworkPlatformConfig] = data
+	}
+	return values, nil
+}
+
+// writeFirstBootConfig writes the META values and the machine config to the partitions of the installed disk
+func writeFirstBootConfig(log *logrus.Entry, sshClient hetznerapi.SSHClientInterface, partitions *hetznerapi.PartitionTable, cfg *v1alpha1.FirstBootConfig) error {
+	values, err := metaValues(cfg)
+	if err != nil {
+		return err
+	}
+	if len(values) > 0 {
+		data, err := meta.Encode(values)
+		if err != nil {
+			return err
+		}
+		partition, err := findPartition(partitions, "META", int64(len(data)))
+		if err != nil {
+			return err
+		}
+		if output, err := sshClient.UploadFile(hetznerapi.MetaImagePath, data); err != nil {
+			return fmt.Errorf("failed to upload META image: %w (%s)", err, output)
+		}
+		if output, err := sshClient.WriteMetaPartition(partition.Node); err != nil {
+			return fmt.Errorf("failed to write META partition %s: %w (%s)", partition.Node, err, output)
+		}
+		log.WithField("keys", len(values)).Info("Talos META values written")
+	}
+
+	if cfg.MachineConfigFile != "" {
+		data, err := os.ReadFile(cfg.MachineConfigFile)
+		if err != nil {
+			return fmt.Errorf("error reading machine config: %w", err)
+		}
+		partition, err := findPartition(partitions, "STATE", 0)
+		if err != nil {
+			return err
+		}
+		if output, err := sshClient.UploadFile(hetznerapi.MachineConfigPath, data); err != nil {
+			return fmt.Errorf("failed to upload machine config: %w (%s)", err, output)
+		}
+		if output, err := sshClient.WriteMachineConfig(partition.Node); err != nil {
+			return fmt.Errorf("failed to write machine config to %s: %w (%s)", partition.Node, err, output)
+		}
+		log.Info("Machine config written to STATE partition")
+	}
+	return nil
+}
+
+// findPartition returns the named partition if it has a valid device node and at least minSize bytes
+func findPartition(partitions *hetznerapi.PartitionTable, name string, minSize int64) (*hetznerapi.Partition, error) {
+	partition := partitions.PartitionByName(name)
+	if partition == nil || !validPartitionNode.MatchString(partition.Node) {
+		return nil, fmt.Errorf("%s partition not found", name)
+	}
+	if size := partitions.SizeInBytes(partition); size < minSize {
+		return nil, fmt.Errorf("%s partition %s has %d bytes, %d bytes required", name, partition.Node, size, minSize)
+	}
+	return partition, nil
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi/sshtest"
+	"github.com/eriklundjensen/thdctl/pkg/talos/meta"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func testPartitionTable() *hetznerapi.PartitionTable {
+	return &hetznerapi.PartitionTable{
+		Label:      "gpt",
+		SectorSize: 512,
+		Partitions: []hetznerapi.Partition{
+			{Node: "/dev/nvme0n1p4", Name: "META", Size: 2048},
+			{Node: "/dev/nvme0n1p5", Name: "STATE", Size: 204800},
+		},
+	}
+}
+
+func TestWriteFirstBootConfig(t *testing.T) {
+	dir := t.TempDir()
+	networkConfig := filepath.Join(dir, "network.yaml")
+	machineConfig := filepath.Join(dir, "controlplane.yaml")
+	assert.NoError(t, os.WriteFile(networkConfig, []byte("links: []\n"), 0o600))
+	assert.NoError(t, os.WriteFile(machineConfig, []byte("version: v1alpha1\n"), 0o600))
+
+	var metaImage []byte
+	sshClient := new(sshtest.MockClient)
+	sshClient.On("UploadFile", hetznerapi.MetaImagePath, mock.Anything).Run(func(args mock.Arguments) {
+		metaImage = args.Get(1).([]byte)
+	}).Return("", nil)
+	sshClient.On("WriteMetaPartition", "/dev/nvme0n1p4").Return("", nil)
+	sshClient.On("UploadFile", hetznerapi.MachineConfigPath, []byte("version: v1alpha1\n")).Return("", nil)
+	sshClient.On("WriteMachineConfig", "/dev/nvme0n1p5").Return("", nil)
+
+	err := writeFirstBootConfig(logrus.NewEntry(logrus.StandardLogger()), sshClient, testPartitionTable(), &v1alpha1.FirstBootConfig{
+		NetworkConfigFile: networkConfig,
+		MachineConfigFile: machineConfig,
+		Meta:              []v1alpha1.MetaValue{{Key: meta.UserReserved1, Value: "rack-7"}},
+	})
+
+	assert.NoError(t, err)
+	sshClient.AssertExpectations(t)
+	values, err := meta.Decode(metaImage)
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint8][]byte{
+		meta.MetalNetworkPlatformConfig: []byte("links: []\n"),
+		meta.UserReserved1:              []byte("rack-7"),
+	}, values)
+}
+
+func TestWriteFirstBootConfigMetaPartitionTooSmall(t *testing.T) {
+	partitions := testPartitionTable()
+	partitions.Partitions[0].Size = 100
+	sshClient := new(sshtest.MockClient)
+
+	err := writeFirstBootConfig(logrus.NewEntry(logrus.StandardLogger()), sshClient, partitions, &v1alpha1.FirstBootConfig{
+		Meta: []v1alpha1.MetaValue{{Key: meta.UserReserved1, Value: "rack-7"}},
+	})
+
+	assert.ErrorContains(t, err, "META partition")
+	sshClient.AssertNotCalled(t, "UploadFile", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/eriklundjensen/thdctl/pkg/talos"
+)
+
+// Action is a step of a run
+type Action struct {
+	State       ServerStatus `json:"state"`
+	Description string       `json:"description"`
+	// Mutating actions change the server, e.g. a Robot POST, a reset or a write to a disk
+	Mutating bool `json:"mutating"`
+}
+
+// Plan returns the actions a run would take without running them. The state of the server is determined with
+// read only Robot requests and connection checks when it is not known, e.g. from a checkpoint.
+// The plan assumes every action succeeds, waits and retries are not repeated.
+func (sm *StateMachine) Plan() (ServerStatus, []Action) {
+	current := sm.state
+	if current == Unknown {
+		current = DetermineServerStatus(readOnlyClient{sm.client}, sm.sshClient, sm.server)
+	}
+
+	var actions []Action
+	add := func(state ServerStatus, mutating bool, format string, args ...any) {
+		actions = append(actions, Action{State: state, Description: fmt.Sprintf(format, args...), Mutating: mutating})
+	}
+	number := sm.server.ServerNumber
+	disk := "/dev/" + sm.server.Disk
+	// a state is only planned once, the upgrade returns to WaitingForBootstrap
+	planned := map[ServerStatus]bool{}
+
+	for state := current; state != "" && state != sm.target && !planned[state]; {
+		planned[state] = true
+		next := ServerStatus("")
+		switch state {
+		case Unknown:
+			add(state, false, "determine the state of the server, initialize it when it does not settle")
+			next = Uninitialized
+		case Uninitialized:
+			add(state, true, "POST boot/%d/rescue os=linux: enable the rescue system", number)
+			next = RequiresReboot
+		case RescueModeInitiated:
+			add(state, false, "GET boot/%d/rescue: wait for the rescue system to be active", number)
+			next = RequiresReboot
+		case RequiresReboot:
+			add(state, true, "%s", describeResetEscalation(number))
+			next = WaitForReboot
+		case WaitForReboot:
+			add(state, false, "wait for SSH of the rescue system")
+			next = SSHAvailable
+		case SSHAvailable:
+			if sm.deprovision != nil {
+				add(state, true, "stop software RAID arrays and wipe the signatures of all disks")
+				next = Deprovisioned
+				break
+			}
+			add(state, false, "check that %s exists", disk)
+			if sm.server.DiskHealth != nil {
+				add(state, false, "check the SMART health of %s (%s)", disk, sm.server.DiskHealth.Action)
+			}
+			if sm.server.WipeRaid {
+				add(state, true, "stop software RAID arrays and wipe %s and the sibling disks of the arrays", disk)
+			}
+			add(state, false, "download %s to %s", hetznerapi.SanitizeCommand(sm.imageURL()), "/tmp/talos.raw.xz")
+			add(state, true, "write the image to %s", disk)
+			verify := "verify the Talos partitions of " + disk
+			if sm.server.VerifyImageDigest {
+				verify += " and the digest of the written image"
+			}
+			add(state, false, "%s", verify)
+			if sm.server.FirstBoot != nil {
+				add(state, true, "write the first boot configuration to the META and STATE partitions of %s", disk)
+			}
+			add(state, true, "POST reset/%d type=hw: boot Talos", number)
+			next = TalosImageInstalled
+		case TalosImageInstalled:
+			add(state, false, "wait for the Talos API on port 50000")
+			next = TalosAPIAvailable
+		case TalosAPIAvailable:
+			if sm.server.MachineConfig != "" {
+				add(state, true, "apply the machine config %s to the maintenance mode API", sm.server.MachineConfig)
+				next = ConfigApplied
+			} else if desired := desiredTalosVersion(sm.server); desired != "" && sm.server.Talosconfig != "" {
+				add(state, false, "compare the running Talos version with %s, upgrade on a difference", desired)
+			}
+		case ConfigApplied:
+			if sm.server.Talosconfig != "" {
+				add(state, false, "wait for the node to accept the talosconfig %s", sm.server.Talosconfig)
+				next = WaitingForBootstrap
+			}
+		case WaitingForBootstrap:
+			if desired := desiredTalosVersion(sm.server); desired != "" && sm.server.Talosconfig != "" && !planned[TalosVersionDrift] {
+				add(state, false, "compare the running Talos version with %s, upgrade on a difference", desired)
+			}
+			if sm.server.Bootstrap {
+				add(state, true, "bootstrap etcd")
+				next = Bootstrapped
+			}
+		case TalosVersionDrift:
+			desired := desiredTalosVersion(sm.server)
+			add(state, true, "upgrade Talos to %s using %s", desired, talos.InstallerImage(desired, sm.server.TalosImage))
+			next = TalosUpgrading
+		case TalosUpgrading:
+			add(state, false, "wait for the node to come back with the desired version")
+			next = WaitingForBootstrap
+		case Bootstrapped:
+			add(state, false, "wait for etcd to become healthy")
+			next = EtcdHealthy
+		case EtcdHealthy:
+			description := "wait for the Kubernetes API"
+			if sm.server.Kubeconfig != "" {
+				description += ", write the kubeconfig to " + sm.server.Kubeconfig
+			}
+			add(state, false, "%s", description)
+			next = KubernetesAvailable
+		case Deprovisioning:
+			add(state, true, "POST boot/%d/rescue os=linux: enable the rescue system", number)
+			if sm.deprovision != nil && sm.deprovision.ResetTalos {
+				if sm.deprovision.Graceful {
+					add(state, true, "cordon and drain the node and leave etcd")
+				}
+				add(state, true, "reset Talos through the Talos API")
+				next = WaitForReboot
+			} else {
+				next = RequiresReboot
+			}
+		case Deprovisioned, KubernetesAvailable:
+		default:
+			add(state, false, "fail, %s is not a valid state", state)
+		}
+		state = next
+	}
+	return current, actions
+}
+
+// readOnlyClient refuses mutating Robot requests
+type readOnlyClient struct {
+	client robot.ClientInterface
+}
+
+func (c readOnlyClient) Get(path string) ([]byte, *robot.HTTPError) {
+	return c.client.Get(path)
+}
+
+func (c readOnlyClient) Post(path string, values url.Values) ([]byte, *robot.HTTPError) {
+	return nil, &robot.HTTPError{Message: fmt.Sprintf("POST %s is not allowed in a dry run", path)}
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"net/url"
+	"testing"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi/sshtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func descriptions(actions []Action) []string {
+	var result []string
+	for _, action := range actions {
+		mark := ""
+		if action.Mutating {
+			mark = "* "
+		}
+		result = append(result, mark+string(action.State)+": "+action.Description)
+	}
+	return result
+}
+
+func TestPlanInstallation(t *testing.T) {
+	// no Robot request or SSH command is expected, the mocks fail on any call
+	sm := NewStateMachine(new(mockRobotClient), new(sshtest.MockClient), &v1alpha1.ServerParameters{
+		ServerNumber:      1,
+		Disk:              "nvme0n1",
+		TalosImage:        "https://factory.talos.dev/image/abc/v1.9.2/metal-amd64.raw.zst?token=secret",
+		TalosVersion:      "v1.9.2",
+		WipeRaid:          true,
+		VerifyImageDigest: true,
+		MachineConfig:     "gen/node1.yaml",
+		Talosconfig:       "gen/talosconfig",
+		Bootstrap:         true,
+		Kubeconfig:        "gen/kubeconfig",
+	}, 5)
+	sm.StateChange(Uninitialized)
+
+	current, actions := sm.Plan()
+
+	assert.Equal(t, Uninitialized, current)
+	assert.Equal(t, []string{
+		"* Uninitialized: POST boot/1/rescue os=linux: enable the rescue system",
+		"* RequiresReboot: POST reset/1 type=sw: reset the server into the rescue system, escalating to hw and power while SSH does not come back",
+		"WaitForReboot: wait for SSH of the rescue system",
+		"SSHAvailable: check that /dev/nvme0n1 exists",
+		"* SSHAvailable: stop software RAID arrays and wipe /dev/nvme0n1 and the sibling disks of the arrays",
+		"SSHAvailable: download https://factory.talos.dev/image/abc/v1.9.2/metal-amd64.raw.zst to /tmp/talos.raw.xz",
+		"* SSHAvailable: write the image to /dev/nvme0n1",
+		"SSHAvailable: verify the Talos partitions of /dev/nvme0n1 and the digest of the written image",
+		"* SSHAvailable: POST reset/1 type=hw: boot Talos",
+		"TalosImageInstalled: wait for the Talos API on port 50000",
+		"* TalosAPIAvailable: apply the machine config gen/node1.yaml to the maintenance mode API",
+		"ConfigApplied: wait for the node to accept the talosconfig gen/talosconfig",
+		"WaitingForBootstrap: compare the running Talos version with v1.9.2, upgrade on a difference",
+		"* WaitingForBootstrap: bootstrap etcd",
+		"Bootstrapped: wait for etcd to become healthy",
+		"EtcdHealthy: wait for the Kubernetes API, write the kubeconfig to gen/kubeconfig",
+	}, descriptions(actions))
+}
+
+func TestPlanStopsAtDesiredState(t *testing.T) {
+	sm := NewStateMachine(new(mockRobotClient), new(sshtest.MockClient), &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+	sm.StateChange(TalosImageInstalled)
+
+	_, actions := sm.Plan()
+
+	assert.Equal(t, []string{"TalosImageInstalled: wait for the Talos API on port 50000"}, descriptions(actions))
+}
+
+func TestPlanDeprovision(t *testing.T) {
+	sm := NewStateMachine(new(mockRobotClient), new(sshtest.MockClient), &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+	sm.Deprovision(DeprovisionOptions{ResetTalos: true, Graceful: true})
+
+	_, actions := sm.Plan()
+
+	assert.Equal(t, []string{
+		"* Deprovisioning: POST boot/1/rescue os=linux: enable the rescue system",
+		"* Deprovisioning: cordon and drain the node and leave etcd",
+		"* Deprovisioning: reset Talos through the Talos API",
+		"WaitForReboot: wait for SSH of the rescue system",
+		"* SSHAvailable: stop software RAID arrays and wipe the signatures of all disks",
+	}, descriptions(actions))
+}
+
+func TestPlanInvalidState(t *testing.T) {
+	sm := NewStateMachine(new(mockRobotClient), new(sshtest.MockClient), &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+	sm.StateChange(ServerNotFound)
+
+	_, actions := sm.Plan()
+
+	assert.Equal(t, []string{"ServerNotFound: fail, ServerNotFound is not a valid state"}, descriptions(actions))
+}
+
+func TestReadOnlyClientRefusesPost(t *testing.T) {
+	client := new(mockRobotClient)
+	_, err := readOnlyClient{client}.Post("reset/1", url.Values{"type": {"hw"}})
+	require.NotNil(t, err)
+	assert.Equal(t, "POST reset/1 is not allowed in a dry run", err.Message)
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/sirupsen/logrus"
+)
+
+// RaidTeardownReport describes the software RAID teardown performed before installation
+type RaidTeardownReport struct {
+	StoppedArrays []string
+	ZeroedDevices []string
+	WipedDevices  []string
+}
+
+// Log writes the report to the log of the server
+func (r *RaidTeardownReport) Log(log *logrus.Entry) {
+	log.WithFields(logrus.Fields{
+		"stoppedArrays": r.StoppedArrays,
+		"zeroedDevices": r.ZeroedDevices,
+		"wipedDevices":  r.WipedDevices,
+	}).Info("Software RAID teardown completed")
+}
+
+// teardownRaid stops all md arrays found in the rescue system, zeroes the superblocks of their members
+// and wipes the signatures of the member partitions, the target disk and the sibling disks of the arrays.
+func teardownRaid(sshClient hetznerapi.SSHClientInterface, disk string) (*RaidTeardownReport, error) {
+	output, err := sshClient.ReadMDStat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /proc/mdstat: %w", err)
+	}
+	arrays, err := hetznerapi.ParseMDStat(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse /proc/mdstat: %w", err)
+	}
+
+	report := &RaidTeardownReport{}
+	var members []string
+	disks := []string{disk}
+	for _, array := range arrays {
+		if output, err := sshClient.StopRaidArray(array.Name); err != nil {
+			return report, fmt.Errorf("failed to stop array %s: %w (%s)", array.Name, err, output)
+		}
+		report.StoppedArrays = append(report.StoppedArrays, array.Name)
+
+		for _, device := range array.Devices {
+			members = append(members, device)
+			disks = appendUnique(disks, hetznerapi.ParentDisk(device))
+		}
+	}
+
+	for _, device := range members {
+		if output, err := sshClient.ZeroRaidSuperblock(device); err != nil {
+			return report, fmt.Errorf("failed to zero superblock of %s: %w (%s)", device, err, output)
+		}
+		report.ZeroedDevices = append(report.ZeroedDevices, device)
+	}
+
+	for _, device := range append(members, disks...) {
+		if output, err := sshClient.WipeDisk(device); err != nil {
+			return report, fmt.Errorf("failed to wipe %s: %w (%s)", device, err, output)
+		}
+		report.WipedDevices = append(report.WipedDevices, device)
+	}
+
+	return report, nil
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
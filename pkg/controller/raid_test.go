@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi/sshtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTeardownRaid(t *testing.T) {
+	sshClient := new(sshtest.MockClient)
+	sshClient.On("ReadMDStat").Return(`md1 : active raid1 sda2[0] sdb2[1]
+md0 : active raid1 sda1[0] sdb1[1]
+`, nil)
+	sshClient.On("StopRaidArray", mock.Anything).Return("", nil)
+	sshClient.On("ZeroRaidSuperblock", mock.Anything).Return("", nil)
+	sshClient.On("WipeDisk", mock.Anything).Return("", nil)
+
+	report, err := teardownRaid(sshClient, "sda")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"md1", "md0"}, report.StoppedArrays)
+	assert.Equal(t, []string{"sda2", "sdb2", "sda1", "sdb1"}, report.ZeroedDevices)
+	assert.Equal(t, []string{"sda2", "sdb2", "sda1", "sdb1", "sda", "sdb"}, report.WipedDevices)
+	sshClient.AssertExpectations(t)
+}
+
+func TestTeardownRaidWithoutArrays(t *testing.T) {
+	sshClient := new(sshtest.MockClient)
+	sshClient.On("ReadMDStat").Return("Personalities : \nunused devices: <none>\n", nil)
+	sshClient.On("WipeDisk", "nvme0n1").Return("", nil)
+
+	report, err := teardownRaid(sshClient, "nvme0n1")
+
+	assert.NoError(t, err)
+	assert.Empty(t, report.StoppedArrays)
+	assert.Equal(t, []string{"nvme0n1"}, report.WipedDevices)
+	sshClient.AssertExpectations(t)
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+)
+
+// resetEscalation is the order of the reset types used to reboot the server into the rescue system.
+// The next type is used when SSH does not come back after a reset. The run fails after the last type,
+// pressing the power button again would toggle the server off and on.
+var resetEscalation = []string{hetznerapi.ResetSoftware, hetznerapi.ResetHardware, hetznerapi.ResetPower}
+
+// resetType returns the type of the next reset into the rescue system, false when the escalation is exhausted.
+// Types not supported by the server are skipped.
+func (sm *StateMachine) resetType() (string, bool) {
+	supported := sm.supportedResetTypes()
+	var escalation []string
+	for _, resetType := range resetEscalation {
+		if supported == nil || slices.Contains(supported, resetType) {
+			escalation = append(escalation, resetType)
+		}
+	}
+	if len(escalation) == 0 {
+		escalation = []string{hetznerapi.ResetHardware}
+	}
+	if sm.resets >= len(escalation) {
+		return "", false
+	}
+	return escalation[sm.resets], true
+}
+
+// supportedResetTypes returns the reset types supported by the server, nil when they are not available
+func (sm *StateMachine) supportedResetTypes() []string {
+	if sm.resetTypes != nil {
+		return sm.resetTypes
+	}
+	reset, err := hetznerapi.GetResetTypes(sm.client, sm.server.ServerNumber)
+	if err != nil {
+		sm.log.WithError(err).Warn("Failed to get the reset types of the server")
+		return nil
+	}
+	sm.resetTypes = reset.Reset.Type
+	return sm.resetTypes
+}
+
+// describeResetEscalation describes the resets of the escalation for a plan
+func describeResetEscalation(serverNumber int) string {
+	return fmt.Sprintf("POST reset/%d type=%s: reset the server into the rescue system, escalating to %s while SSH does not come back",
+		serverNumber, resetEscalation[0], strings.Join(resetEscalation[1:], " and "))
+}
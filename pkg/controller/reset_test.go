@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/checkpoint"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi/sshtest"
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const allResetTypes = `{"reset": {"server_number": 1, "type": ["sw", "hw", "power", "power_long", "man"]}}`
+
+func resetTypes(client *mockRobotClient) []string {
+	var types []string
+	for _, call := range client.Calls {
+		if call.Method == "Post" && call.Arguments.String(0) == "reset/1" {
+			types = append(types, call.Arguments.Get(1).(url.Values).Get("type"))
+		}
+	}
+	return types
+}
+
+func TestResetEscalatesWhileSSHDoesNotComeBack(t *testing.T) {
+	client := new(mockRobotClient)
+	client.On("Get", "boot/1/rescue").Return(rescueEnabled, nil)
+	client.On("Get", "reset/1").Return(allResetTypes, nil).Once()
+	client.On("Post", "reset/1", mock.Anything).Return(`{}`, nil)
+	sshClient := new(sshtest.MockClient)
+	sshClient.On("SetTargetHost", "192.0.2.10", "22")
+	sshClient.On("Auth", "root", "secret").Return(nil)
+	sshClient.On("EstablishSSHSession").Return(errors.New("connection refused"))
+	sm := NewStateMachine(client, sshClient, &v1alpha1.ServerParameters{ServerNumber: 1}, 2)
+	clock := newFakeClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	sm.SetClock(clock)
+	sm.StateChange(RequiresReboot)
+
+	err := sm.Run(context.Background())
+
+	// power is not pressed again after the last reset of the escalation
+	assert.EqualError(t, err, "SSH did not come back after the last reset of the escalation")
+	assert.Equal(t, ReasonMaxRetries, sm.failureReason)
+	assert.Equal(t, []string{"sw", "hw", "power"}, resetTypes(client))
+	client.AssertExpectations(t)
+}
+
+func TestFailedResetIsRetriedWithTheSameType(t *testing.T) {
+	client := new(mockRobotClient)
+	client.On("Get", "reset/1").Return(allResetTypes, nil)
+	client.On("Post", "reset/1", mock.Anything).Return("", &robot.HTTPError{StatusCode: 429}).Once()
+	client.On("Post", "reset/1", mock.Anything).Return(`{}`, nil)
+	sm := NewStateMachine(client, new(sshtest.MockClient), &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+
+	state, err := sm.reboot()
+	require.NoError(t, err)
+	assert.Equal(t, RequiresReboot, state)
+	assert.Equal(t, 0, sm.resets)
+
+	state, err = sm.reboot()
+	require.NoError(t, err)
+	assert.Equal(t, WaitForReboot, state)
+
+	assert.Equal(t, []string{"sw", "sw"}, resetTypes(client))
+}
+
+func TestResetSkipsUnsupportedTypes(t *testing.T) {
+	client := new(mockRobotClient)
+	client.On("Get", "reset/1").Return(`{"reset": {"server_number": 1, "type": ["hw", "man"]}}`, nil)
+	client.On("Post", "reset/1", mock.Anything).Return(`{}`, nil)
+	sm := NewStateMachine(client, new(sshtest.MockClient), &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+
+	state, err := sm.reboot()
+	require.NoError(t, err)
+	assert.Equal(t, WaitForReboot, state)
+	_, err = sm.reboot()
+	assert.EqualError(t, err, "SSH did not come back after the last reset of the escalation")
+
+	assert.Equal(t, []string{"hw"}, resetTypes(client))
+}
+
+func TestResetWithoutResetTypes(t *testing.T) {
+	client := new(mockRobotClient)
+	client.On("Get", "reset/1").Return("", &robot.HTTPError{StatusCode: 503})
+	client.On("Post", "reset/1", mock.Anything).Return(`{}`, nil)
+	sm := NewStateMachine(client, new(sshtest.MockClient), &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+
+	sm.reboot()
+	sm.reboot()
+
+	// the escalation is used as is and the types are requested again
+	assert.Equal(t, []string{"sw", "hw"}, resetTypes(client))
+	client.AssertNumberOfCalls(t, "Get", 2)
+}
+
+func TestResetsAreResumed(t *testing.T) {
+	store := &checkpoint.FileStore{Dir: t.TempDir()}
+	client := new(mockRobotClient)
+	client.On("Get", "reset/1").Return(allResetTypes, nil)
+	client.On("Post", "reset/1", mock.Anything).Return(`{}`, nil)
+	sm := NewStateMachine(client, new(sshtest.MockClient), &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+	require.NoError(t, sm.Resume(store))
+	state, err := sm.reboot()
+	require.NoError(t, err)
+	sm.StateChange(state)
+	sm.saveCheckpoint()
+
+	resumed := NewStateMachine(client, new(sshtest.MockClient), &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+	require.NoError(t, resumed.Resume(store))
+	resumed.reboot()
+
+	assert.Equal(t, []string{"sw", "hw"}, resetTypes(client))
+}
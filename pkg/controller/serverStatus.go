@@ -17,6 +17,27 @@ import (
 type ServerStatus string
 
 const (
+	// KubernetesAvailable indicates the Kubernetes API of the bootstrapped cluster is ready
+	KubernetesAvailable ServerStatus = "KubernetesAvailable"
+
+	// EtcdHealthy indicates etcd is healthy on the bootstrapped node
+	EtcdHealthy ServerStatus = "EtcdHealthy"
+
+	// Bootstrapped indicates etcd has been bootstrapped on the node
+	Bootstrapped ServerStatus = "Bootstrapped"
+
+	// TalosUpgrading indicates an in-place upgrade has been requested and the node is expected to come back with the desired version
+	TalosUpgrading ServerStatus = "TalosUpgrading"
+
+	// TalosVersionDrift indicates the running Talos version differs from the desired version
+	TalosVersionDrift ServerStatus = "TalosVersionDrift"
+
+	// WaitingForBootstrap indicates the machine config is active and the node waits for etcd to be bootstrapped
+	WaitingForBootstrap ServerStatus = "WaitingForBootstrap"
+
+	// ConfigApplied indicates the machine config has been applied to the maintenance mode API
+	ConfigApplied ServerStatus = "ConfigApplied"
+
 	// TalosAPIAvailable indicates the Talos API is responding on port 50000
 	TalosAPIAvailable ServerStatus = "TalosAPIAvailable"
 
@@ -49,8 +70,30 @@ const (
 
 	// SSHAvailable indicates the server is accessible via SSH
 	SSHAvailable ServerStatus = "SSHAvailable"
+
+	// Deprovisioning indicates the server is being reset and returned to the rescue system
+	Deprovisioning ServerStatus = "Deprovisioning"
+
+	// Deprovisioned indicates the disks have been wiped and the server runs the rescue system
+	Deprovisioned ServerStatus = "Deprovisioned"
+
+	// DiskUnhealthy indicates the target disk failed the SMART health check
+	DiskUnhealthy ServerStatus = "DiskUnhealthy"
+
+	// DiskNotFound indicates the target disk does not exist in the rescue system
+	DiskNotFound ServerStatus = "DiskNotFound"
 )
 
+// States returns all states of the state machine
+func States() []ServerStatus {
+	return []ServerStatus{
+		Unknown, Uninitialized, RescueModeInitiated, RequiresReboot, WaitForReboot, SSHAvailable,
+		TalosImageInstalled, TalosAPIAvailable, ConfigApplied, WaitingForBootstrap, TalosVersionDrift,
+		TalosUpgrading, Bootstrapped, EtcdHealthy, KubernetesAvailable, Deprovisioning, Deprovisioned,
+		ServerNotFound, MissingServerNumber, RobotAPIUnavailable, DiskUnhealthy, DiskNotFound,
+	}
+}
+
 // String returns the string representation of the ServerStatus
 func (s ServerStatus) String() string {
 	return string(s)
@@ -74,19 +117,20 @@ func DetermineServerStatus(client robot.ClientInterface, sshClient hetznerapi.SS
 	if server.ServerNumber == 0 {
 		return MissingServerNumber
 	}
+	log := logrus.WithField("server", server.ServerNumber)
 
 	rescue, err := hetznerapi.GetRescueSystemDetails(client, server.ServerNumber)
 	if err != nil {
 		if err.StatusCode == 404 {
 			return ServerNotFound
 		}
-		logrus.WithError(err).Error("Error getting rescue system status")
+		log.WithError(err).Error("Error getting rescue system status")
 		return RobotAPIUnavailable
 	}
 
 	host := rescue.Rescue.ServerIP
 	if rescue.Rescue.Active {
-		logrus.Info("Rescue system active")
+		log.Info("Rescue system active")
 
 		return RescueModeInitiated
 	}
@@ -99,7 +143,10 @@ func DetermineServerStatus(client robot.ClientInterface, sshClient hetznerapi.SS
 	if rescue.Rescue.Password != "" {
 		sshPassword = rescue.Rescue.Password
 	}
-	sshClient.Auth(sshUser, sshPassword)
+	if err := sshClient.Auth(sshUser, sshPassword); err != nil {
+		log.WithError(err).Error("Failed to set up SSH authentication")
+		return Unknown
+	}
 	if err := sshClient.EstablishSSHSession(); err == nil {
 		return SSHAvailable
 	}
@@ -109,7 +156,7 @@ func DetermineServerStatus(client robot.ClientInterface, sshClient hetznerapi.SS
 		return TalosAPIAvailable
 	}
 	if talosError != nil {
-		logrus.WithError(talosError).Warn("Talos API not available")
+		log.WithError(talosError).Warn("Talos API not available")
 	}
 	// Or waiting for Talos API to become available
 	// We don't have access to the boot log (require KVM console and a human request towards Hetzner)
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -10,7 +11,10 @@ import (
 	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
 	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
 	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/eriklundjensen/thdctl/pkg/talos"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // StateMachine represents the state machine for server states
@@ -22,73 +26,286 @@ type StateMachine struct {
 	retries         int
 	maxRetries      int
 	lastSSHPassword string
+	status          v1alpha1.ServerStatus
+	talosConnector  talos.Connector
+	deprovision     *DeprovisionOptions
+	checkpoints     CheckpointStore
+	stateEnteredAt  time.Time
+	clock           Clock
+	timeouts        Timeouts
+	target          ServerStatus
+	// resets counts the resets into the rescue system since SSH was available, see resetEscalation
+	resets int
+	// completed is set when the last run reached the desired state, its checkpoint is not resumed
+	completed     bool
+	resetTypes    []string
+	subscribers   []Subscriber
+	failureReason string
+	// spanCtx is the context of the span of the running state handler
+	spanCtx context.Context
+	log     *logrus.Entry
 }
 
 // NewStateMachine creates a new StateMachine instance
 func NewStateMachine(client robot.ClientInterface, sshClient hetznerapi.SSHClientInterface, server *v1alpha1.ServerParameters, maxRetries int) *StateMachine {
-	return &StateMachine{
-		client:     client,
-		sshClient:  sshClient,
-		server:     server,
-		state:      Unknown,
-		maxRetries: maxRetries,
+	sm := &StateMachine{
+		sshClient:      sshClient,
+		server:         server,
+		state:          Unknown,
+		maxRetries:     maxRetries,
+		talosConnector: &talos.GRPCConnector{TalosconfigFile: server.Talosconfig},
+		clock:          realClock{},
+		timeouts:       DefaultTimeouts(),
+		log:            logrus.WithField("server", server.ServerNumber),
+		spanCtx:        context.Background(),
 	}
+	sm.client = &tracedClient{client: client, sm: sm}
+	return sm
 }
 
+// SetClock replaces the clock used for deadlines and poll intervals
+func (sm *StateMachine) SetClock(clock Clock) {
+	sm.clock = clock
+}
+
+// SetTargetState makes runs complete when the state is reached,
+// e.g. TalosImageInstalled to only install Talos like the init command
+func (sm *StateMachine) SetTargetState(state ServerStatus) {
+	sm.target = state
+}
+
+// SetTimeouts replaces the poll intervals and state deadlines
+func (sm *StateMachine) SetTimeouts(timeouts Timeouts) {
+	sm.timeouts = timeouts
+}
+
+// StateChange enters a state and publishes the transition
 func (sm *StateMachine) StateChange(state ServerStatus) {
+	sm.changeState(state, "")
+}
+
+func (sm *StateMachine) changeState(state ServerStatus, reason string) {
 	if sm.state == state {
 		return
 	}
-	logrus.Infof("State change from: %s to %s", sm.state, state)
+	sm.log.Infof("State change from: %s to %s", sm.state, state)
+	from := sm.state
 	sm.state = state
+	sm.stateEnteredAt = sm.clock.Now()
+	sm.publish(Transition{From: from, To: state, Reason: reason})
+}
+
+// Status returns the status observed while running the state machine
+func (sm *StateMachine) Status() v1alpha1.ServerStatus {
+	status := sm.status
+	status.State = sm.state.String()
+	if !sm.stateEnteredAt.IsZero() {
+		entered := sm.stateEnteredAt.UTC()
+		status.LastTransitionTime = &entered
+	}
+	return status
+}
+
+// SetStatus sets the previously observed status. Fields not observed by the next run are kept.
+func (sm *StateMachine) SetStatus(status v1alpha1.ServerStatus) {
+	sm.status = status
+}
+
+// Run executes the state machine until the server reached its desired state, a state failed or ctx is cancelled.
+// The progress is saved when a checkpoint store is set.
+// A failed run publishes a transition to Failed.
+func (sm *StateMachine) Run(ctx context.Context) error {
+	// the root span of the server, the state handlers add child spans
+	ctx, span := tracer.Start(ctx, "StateMachine.Run", trace.WithAttributes(
+		attribute.Int("thdctl.server", sm.server.ServerNumber),
+		attribute.String("thdctl.state", sm.state.String()),
+	))
+	defer sm.setSpanContext(context.Background())
+
+	sm.failureReason = ""
+	sm.completed = false
+	err := sm.run(ctx)
+	span.SetAttributes(attribute.String("thdctl.final_state", sm.state.String()))
+	endSpan(span, err)
+
+	sm.status.LastError = ""
+	if err != nil {
+		sm.status.LastError = err.Error()
+	}
+	sm.completed = err == nil
+	sm.saveCheckpoint()
+	if err != nil {
+		sm.publish(Transition{From: sm.state, To: Failed, Reason: sm.failureReason, Error: err.Error()})
+	}
+	return err
 }
 
-// Run executes the state machine
-func (sm *StateMachine) Run() error {
-	extendedMaxRetries := sm.maxRetries * 2
+func (sm *StateMachine) run(ctx context.Context) error {
+	if sm.stateEnteredAt.IsZero() {
+		sm.stateEnteredAt = sm.clock.Now()
+	}
+	polls := 0
 	for {
-		if (sm.retries >= sm.maxRetries && TalosImageInstalled != sm.state && Unknown != sm.state && WaitForReboot != sm.state) || sm.retries >= extendedMaxRetries {
-			return fmt.Errorf("max retries reached for state: %s", sm.state)
+		if err := ctx.Err(); err != nil {
+			return sm.fail(ReasonStopped, fmt.Errorf("stopped in state %s: %w", sm.state, err))
 		}
-
-		switch sm.state {
-		case Unknown:
-			sm.state = DetermineServerStatus(sm.client, sm.sshClient, sm.server)
-			// It is hard to determine the state of the server while rebooting, give it more time to settle until extended max retries eached
-			if sm.state == Unknown && sm.retries == extendedMaxRetries-1 {
-				sm.StateChange(Uninitialized)
+		if deadline, ok := sm.timeouts.StateDeadlines[sm.state]; ok {
+			if sm.clock.Now().Sub(sm.stateEnteredAt) >= deadline {
+				if sm.state != Unknown {
+					return sm.fail(ReasonDeadlineExceeded, fmt.Errorf("deadline of %s exceeded in state %s", deadline, sm.state))
+				}
+				// It is hard to determine the state of the server while rebooting, initialize it when it does not settle
+				sm.log.Warnf("State could not be determined within %s, initializing the server", deadline)
+				sm.changeState(Uninitialized, ReasonDeadlineExceeded)
 				sm.retries = 0
+				polls = 0
+				continue
 			}
-		case Uninitialized:
-			sm.StateChange(sm.initialize())
-		case RescueModeInitiated:
-			sm.StateChange(sm.checkRescueMode())
-		case RequiresReboot:
-			sm.StateChange(sm.reboot())
-		case WaitForReboot:
-			sm.StateChange(sm.checkSSH())
-		case SSHAvailable:
-			sm.StateChange(installImage(sm))
-		case TalosImageInstalled:
-			sm.StateChange(sm.checkTalosAPI())
-		case TalosAPIAvailable:
-			logrus.Info("Talos API is available")
-			return nil
-		case ServerNotFound, MissingServerNumber, RobotAPIUnavailable:
-			return fmt.Errorf("failed to reach a valid state: %s", sm.state)
-		default:
-			return fmt.Errorf("unknown state: %s", sm.state)
+		} else if sm.retries >= sm.maxRetries {
+			return sm.fail(ReasonMaxRetries, fmt.Errorf("max retries reached for state: %s", sm.state))
+		}
+
+		previous := sm.state
+		if done, err := sm.handleState(ctx); done || err != nil {
+			return err
 		}
 
 		sm.retries++
-		time.Sleep(5 * time.Second) // Add delay between state transitions
+		sm.saveCheckpoint()
+		// poll a state less often the longer it takes to change
+		polls++
+		if sm.state != previous {
+			polls = 1
+		}
+		select {
+		case <-ctx.Done():
+			return sm.fail(ReasonStopped, fmt.Errorf("stopped in state %s: %w", sm.state, ctx.Err()))
+		case <-sm.clock.After(sm.pollInterval(polls)):
+		}
 	}
 }
 
-func (sm *StateMachine) reboot() ServerStatus {
-	hetznerapi.RebootServer(sm.client, sm.server.ServerNumber)
+// handleState runs the handler of the current state in a span. done is true when the desired state is reached.
+func (sm *StateMachine) handleState(ctx context.Context) (done bool, err error) {
+	ctx, span := tracer.Start(ctx, sm.state.String())
+	sm.setSpanContext(ctx)
+	defer func() {
+		span.SetAttributes(attribute.String("thdctl.next_state", sm.state.String()))
+		endSpan(span, err)
+	}()
+
+	if sm.targetReached() {
+		return true, nil
+	}
+
+	switch sm.state {
+	case Unknown:
+		sm.StateChange(DetermineServerStatus(sm.client, sm.sshClient, sm.server))
+	case Uninitialized:
+		sm.StateChange(sm.initialize())
+	case RescueModeInitiated:
+		sm.StateChange(sm.checkRescueMode())
+	case RequiresReboot:
+		state, err := sm.reboot()
+		if err != nil {
+			return false, sm.fail(ReasonMaxRetries, err)
+		}
+		sm.StateChange(state)
+	case WaitForReboot:
+		sm.StateChange(sm.checkSSH())
+	case SSHAvailable:
+		if sm.deprovision != nil {
+			sm.StateChange(sm.wipeDisks())
+			break
+		}
+		sm.StateChange(installImage(sm))
+	case TalosImageInstalled:
+		sm.StateChange(sm.checkTalosAPI())
+	case TalosAPIAvailable:
+		if sm.server.MachineConfig == "" {
+			// the node is configured outside of thdctl, with a talosconfig its version is still reconciled
+			if state := sm.checkTalosVersion(); state != sm.state {
+				sm.StateChange(state)
+				break
+			}
+			sm.log.Info("Talos API is available")
+			return true, nil
+		}
+		sm.StateChange(sm.applyConfig())
+	case ConfigApplied:
+		if sm.server.Talosconfig == "" {
+			sm.log.Warn("Machine config applied, set talosconfig to wait for the configured node")
+			return true, nil
+		}
+		sm.StateChange(sm.checkConfigured())
+	case WaitingForBootstrap:
+		if state := sm.checkTalosVersion(); state != sm.state {
+			sm.StateChange(state)
+			break
+		}
+		if !sm.server.Bootstrap {
+			sm.log.Info("Talos is waiting for bootstrap")
+			return true, nil
+		}
+		sm.StateChange(sm.bootstrap())
+	case TalosVersionDrift:
+		sm.StateChange(sm.upgrade())
+	case TalosUpgrading:
+		sm.StateChange(sm.checkUpgrade())
+	case Bootstrapped:
+		sm.StateChange(sm.checkEtcd())
+	case EtcdHealthy:
+		sm.StateChange(sm.checkKubernetes())
+	case Deprovisioning:
+		sm.StateChange(sm.startDeprovision())
+	case Deprovisioned:
+		sm.logDeprovisionReport()
+		return true, nil
+	case KubernetesAvailable:
+		sm.log.Info("Kubernetes API is ready")
+		return true, nil
+	case ServerNotFound, MissingServerNumber, RobotAPIUnavailable, DiskUnhealthy, DiskNotFound:
+		return false, sm.fail(ReasonInvalidState, fmt.Errorf("failed to reach a valid state: %s", sm.state))
+	default:
+		return false, sm.fail(ReasonInvalidState, fmt.Errorf("unknown state: %s", sm.state))
+	}
+	// stop right after the transition instead of waiting for the next poll
+	return sm.targetReached(), nil
+}
+
+// targetReached reports whether the run stops in the current state, see SetTargetState
+func (sm *StateMachine) targetReached() bool {
+	if sm.target == "" || sm.state != sm.target {
+		return false
+	}
+	sm.log.Infof("Target state %s reached", sm.target)
+	return true
+}
+
+// pollInterval returns the delay before the next poll, it does not wait beyond the deadline of the state
+func (sm *StateMachine) pollInterval(polls int) time.Duration {
+	interval := sm.timeouts.pollInterval(polls)
+	if deadline, ok := sm.timeouts.StateDeadlines[sm.state]; ok {
+		if remaining := deadline - sm.clock.Now().Sub(sm.stateEnteredAt); remaining > 0 && remaining < interval {
+			return remaining
+		}
+	}
+	return interval
+}
+
+func (sm *StateMachine) reboot() (ServerStatus, error) {
+	resetType, ok := sm.resetType()
+	if !ok {
+		return sm.state, fmt.Errorf("SSH did not come back after the last reset of the escalation")
+	}
+	if err := hetznerapi.ResetServer(sm.client, sm.server.ServerNumber, resetType); err != nil {
+		// the next poll retries the same reset type, e.g. after a rate limit of the Robot API
+		sm.log.WithError(err).WithField("type", resetType).Error("Failed to reset the server")
+		return RequiresReboot, nil
+	}
+	sm.resets++
 	sm.retries = 0
-	return WaitForReboot
+	return WaitForReboot, nil
 }
 
 func (sm *StateMachine) initialize() ServerStatus {
@@ -97,11 +314,13 @@ func (sm *StateMachine) initialize() ServerStatus {
 	}
 	rescue, err := hetznerapi.EnableRescueSystem(sm.client, sm.server.ServerNumber)
 	if err != nil || rescue == nil {
-		logrus.WithError(err).Error("Rescue system state is not available")
+		sm.log.WithError(err).Error("Rescue system state is not available")
 		return Uninitialized
 	}
 	sm.retries = 0
 	sm.lastSSHPassword = rescue.Rescue.Password
+	// The password is only returned once, save it before the reboot
+	sm.saveCheckpoint()
 	return RequiresReboot
 }
 
@@ -111,7 +330,7 @@ func (sm *StateMachine) checkRescueMode() ServerStatus {
 		if err.StatusCode == 404 {
 			return ServerNotFound
 		}
-		logrus.WithError(err).Error("Error getting rescue system status")
+		sm.log.WithError(err).Error("Error getting rescue system status")
 		return RobotAPIUnavailable
 	}
 
@@ -125,7 +344,7 @@ func (sm *StateMachine) checkRescueMode() ServerStatus {
 func (sm *StateMachine) checkSSH() ServerStatus {
 	rescue, err := hetznerapi.GetRescueSystemDetails(sm.client, sm.server.ServerNumber)
 	if err != nil {
-		logrus.WithError(err).Error("Error getting rescue system status")
+		sm.log.WithError(err).Error("Error getting rescue system status")
 		return RobotAPIUnavailable
 	}
 
@@ -144,19 +363,24 @@ func (sm *StateMachine) checkSSH() ServerStatus {
 		sshPassword = sshPasswordFromEnv
 	}
 
-	sm.sshClient.Auth(sshUser, sshPassword)
+	if err := sm.sshClient.Auth(sshUser, sshPassword); err != nil {
+		sm.log.WithError(err).Error("Failed to set up SSH authentication")
+		return sm.state
+	}
 	if err := sm.sshClient.EstablishSSHSession(); err == nil {
 		sm.retries = 0
+		sm.resets = 0
 		return SSHAvailable
 	} else {
 		if strings.Contains(err.Error(), "i/o timeout") {
-			logrus.WithError(err).Warn("Warning: i/o timeout while establishing SSH session")
+			sm.log.WithError(err).Warn("Warning: i/o timeout while establishing SSH session")
 		} else {
-			logrus.WithError(err).Error("SSH not available")
+			sm.log.WithError(err).Error("SSH not available")
 		}
 	}
-	// Reboot if SSH is not available after several retries
+	// Reboot if SSH is not available after several retries, the next reset escalates the reset type
 	if rescue.Rescue.Active && sm.retries >= sm.maxRetries-1 {
+		sm.log.WithField("resets", sm.resets).Warn("SSH did not come back after the reset, resetting the server again")
 		sm.retries = 0
 		return RequiresReboot
 	}
@@ -166,7 +390,7 @@ func (sm *StateMachine) checkSSH() ServerStatus {
 func (sm *StateMachine) checkTalosAPI() ServerStatus {
 	rescue, err := hetznerapi.GetRescueSystemDetails(sm.client, sm.server.ServerNumber)
 	if err != nil {
-		logrus.WithError(err).Error("Error getting rescue system status")
+		sm.log.WithError(err).Error("Error getting rescue system status")
 		return RobotAPIUnavailable
 	}
 
@@ -177,26 +401,47 @@ func (sm *StateMachine) checkTalosAPI() ServerStatus {
 		return TalosAPIAvailable
 	}
 	if talosError != nil {
-		logrus.WithError(talosError).Warn("Talos API not available")
+		sm.log.WithError(talosError).Warn("Talos API not available")
 	}
 	return sm.state
 }
 
+// imageURL returns the URL of the Talos image to install. The image takes precedence over the version.
+func (sm *StateMachine) imageURL() string {
+	if sm.server.TalosImage != "" {
+		return sm.server.TalosImage
+	}
+	return talos.ImageURL(sm.server.TalosVersion)
+}
+
 func installImage(sm *StateMachine) ServerStatus {
-	version := sm.server.TalosVersion
-	image := sm.server.TalosImage
+	if sm.server.TalosVersion != "" && sm.server.TalosImage != "" {
+		sm.log.Warn("Warning: Both version and image are set. Using image definition.")
+	}
+	image := sm.imageURL()
 
-	if version != "" && image != "" {
-		logrus.Warn("Warning: Both version and image are set. Using image definition.")
-		version = ""
+	if state, ok := sm.checkDiskExists(); !ok {
+		return state
 	}
-	if image == "" {
-		image = fmt.Sprintf("https://github.com/siderolabs/talos/releases/download/%s/metal-amd64.raw.zst", version)
+
+	if sm.server.DiskHealth != nil {
+		if state, proceed := sm.checkDiskHealth(); !proceed {
+			return state
+		}
+	}
+
+	if sm.server.WipeRaid {
+		report, err := teardownRaid(sm.sshClient, sm.server.Disk)
+		if err != nil {
+			sm.log.WithError(err).Error("Failed to tear down software RAID")
+			return SSHAvailable
+		}
+		report.Log(sm.log)
 	}
 
 	output, sshErr := sm.sshClient.DownloadImage(image)
 	if sshErr != nil {
-		logrus.WithFields(logrus.Fields{
+		sm.log.WithFields(logrus.Fields{
 			"error":  sshErr,
 			"output": output,
 		}).Error("Failed to download image")
@@ -205,19 +450,93 @@ func installImage(sm *StateMachine) ServerStatus {
 
 	output, sshErr = sm.sshClient.InstallImage(sm.server.Disk)
 	if sshErr != nil {
-		logrus.WithFields(logrus.Fields{
+		sm.log.WithFields(logrus.Fields{
 			"error":  sshErr,
 			"output": output,
 		}).Error("Failed to install image")
 		output, sshErr = sm.sshClient.ListDisks()
-		logrus.WithFields(logrus.Fields{
+		sm.log.WithFields(logrus.Fields{
 			"error":  sshErr,
 			"output": output,
 		}).Error("Failed list disks")
 		return SSHAvailable
 	}
 
-	hetznerapi.RebootServer(sm.client, sm.server.ServerNumber)
+	partitions, err := verifyInstallation(sm.log, sm.sshClient, sm.server.Disk, sm.server.VerifyImageDigest)
+	if err != nil {
+		sm.log.WithError(err).Error("Verification of installed image failed")
+		return SSHAvailable
+	}
+
+	if sm.server.FirstBoot != nil {
+		if err := writeFirstBootConfig(sm.log, sm.sshClient, partitions, sm.server.FirstBoot); err != nil {
+			sm.log.WithError(err).Error("Failed to write first boot configuration")
+			return SSHAvailable
+		}
+	}
+
+	if installed := talos.ImageVersion(image); installed != "" {
+		sm.status.Talos.Version = installed
+	}
+	if err := hetznerapi.RebootServer(sm.client, sm.server.ServerNumber); err != nil {
+		sm.log.WithError(err).Error("Failed to reboot into the installed image")
+		return SSHAvailable
+	}
 	sm.retries = 0
 	return TalosImageInstalled
 }
+
+// checkDiskExists verifies the target disk exists in the rescue system, the available disks are logged when it does not
+func (sm *StateMachine) checkDiskExists() (ServerStatus, bool) {
+	output, err := sm.sshClient.VerifyDiskExists(sm.server.Disk)
+	if err == nil {
+		return SSHAvailable, true
+	}
+	sm.log.WithFields(logrus.Fields{
+		"error":  err,
+		"output": output,
+		"disk":   sm.server.Disk,
+	}).Error("Disk not found")
+
+	disks, listErr := sm.sshClient.ListDisks()
+	if listErr != nil {
+		sm.log.WithError(listErr).Error("Failed to list disks")
+		// the disk may be found on the next attempt
+		return SSHAvailable, false
+	}
+	parsed, _ := hetznerapi.ParseLSBLKOutput(disks)
+	sm.log.WithField("disks", parsed).Info("Available disks")
+	return DiskNotFound, false
+}
+
+// checkDiskHealth runs the SMART health check of the target disk and reports whether the installation may proceed
+func (sm *StateMachine) checkDiskHealth() (ServerStatus, bool) {
+	policy := sm.server.DiskHealth
+	health, err := readDiskHealth(sm.sshClient, sm.server.Disk)
+	if err != nil {
+		if policy.Action == v1alpha1.DiskHealthWarn {
+			sm.log.WithError(err).Warn("Disk health not available, continuing installation")
+			return SSHAvailable, true
+		}
+		sm.log.WithError(err).Error("Disk health not available")
+		return SSHAvailable, false
+	}
+	sm.status.DiskHealth = health
+
+	violations := diskHealthViolations(health, policy)
+	if len(violations) == 0 {
+		sm.log.WithField("disk", health.Disk).Info("Disk health check passed")
+		return SSHAvailable, true
+	}
+
+	entry := sm.log.WithFields(logrus.Fields{
+		"disk":       health.Disk,
+		"violations": violations,
+	})
+	if policy.Action == v1alpha1.DiskHealthWarn {
+		entry.Warn("Disk health thresholds exceeded, continuing installation")
+		return SSHAvailable, true
+	}
+	entry.Error("Disk health thresholds exceeded")
+	return DiskUnhealthy, false
+}
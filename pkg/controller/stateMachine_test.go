@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi/sshtest"
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock advances the time instantly when the state machine waits
+type fakeClock struct {
+	now    time.Time
+	waits  []time.Duration
+	cancel context.CancelFunc
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	if c.cancel != nil {
+		c.cancel()
+	}
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func newWaitForRebootStateMachine(clock *fakeClock) *StateMachine {
+	client := new(mockRobotClient)
+	client.On("Get", "boot/1/rescue").Return(rescueInactive, nil)
+	sshClient := new(sshtest.MockClient)
+	sshClient.On("SetTargetHost", "192.0.2.10", "22")
+	sshClient.On("Auth", "root", mock.Anything).Return(nil)
+	sshClient.On("EstablishSSHSession").Return(errors.New("connection refused"))
+	sm := NewStateMachine(client, sshClient, &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+	sm.SetClock(clock)
+	sm.StateChange(WaitForReboot)
+	return sm
+}
+
+func TestRunFailsAfterStateDeadline(t *testing.T) {
+	clock := newFakeClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	sm := newWaitForRebootStateMachine(clock)
+
+	err := sm.Run(context.Background())
+
+	assert.EqualError(t, err, "deadline of 15m0s exceeded in state WaitForReboot")
+	assert.Equal(t, "deadline of 15m0s exceeded in state WaitForReboot", sm.Status().LastError)
+	assert.Equal(t, []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 30 * time.Second}, clock.waits[:4])
+	assert.Equal(t, 15*time.Minute, clock.now.Sub(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC)))
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	clock := newFakeClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	sm := newWaitForRebootStateMachine(clock)
+	ctx, cancel := context.WithCancel(context.Background())
+	clock.cancel = cancel
+
+	err := sm.Run(ctx)
+
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, WaitForReboot, sm.state)
+	assert.Len(t, clock.waits, 1)
+}
+
+func TestRunWithCancelledContext(t *testing.T) {
+	sm := newWaitForRebootStateMachine(newFakeClock(time.Now()))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := sm.Run(ctx)
+
+	assert.EqualError(t, err, "stopped in state WaitForReboot: context canceled")
+}
+
+func TestRunFailsAfterMaxRetriesWithoutDeadline(t *testing.T) {
+	client := new(mockRobotClient)
+	client.On("Get", "boot/1/rescue").Return(`{"rescue": {"server_ip": "192.0.2.10", "server_number": 1, "active": false}}`, nil)
+	sm := NewStateMachine(client, new(sshtest.MockClient), &v1alpha1.ServerParameters{ServerNumber: 1}, 3)
+	clock := newFakeClock(time.Now())
+	sm.SetClock(clock)
+	sm.StateChange(RescueModeInitiated)
+
+	err := sm.Run(context.Background())
+
+	assert.EqualError(t, err, "max retries reached for state: RescueModeInitiated")
+	assert.Len(t, clock.waits, 3)
+}
+
+func TestPollInterval(t *testing.T) {
+	timeouts := Timeouts{PollInterval: time.Second, MaxPollInterval: 5 * time.Second}
+
+	assert.Equal(t, time.Second, timeouts.pollInterval(1))
+	assert.Equal(t, 2*time.Second, timeouts.pollInterval(2))
+	assert.Equal(t, 4*time.Second, timeouts.pollInterval(3))
+	assert.Equal(t, 5*time.Second, timeouts.pollInterval(4))
+	assert.Equal(t, 5*time.Second, timeouts.pollInterval(100))
+}
+
+func TestSubscribersReceiveTransitions(t *testing.T) {
+	start := time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	client := new(mockRobotClient)
+	client.On("Get", "boot/1/rescue").Return(rescueInactive, nil)
+	sshClient := new(sshtest.MockClient)
+	sshClient.On("SetTargetHost", "192.0.2.10", "22")
+	sshClient.On("Auth", "root", mock.Anything).Return(nil)
+	sshClient.On("EstablishSSHSession").Return(errors.New("connection refused"))
+	sm := NewStateMachine(client, sshClient, &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+	sm.SetClock(clock)
+	var transitions []Transition
+	sm.Subscribe(func(transition Transition) { transitions = append(transitions, transition) })
+	sm.StateChange(WaitForReboot)
+
+	err := sm.Run(context.Background())
+
+	require.Error(t, err)
+	assert.Equal(t, []Transition{
+		{ServerNumber: 1, From: Unknown, To: WaitForReboot, Time: start},
+		{
+			ServerNumber: 1,
+			From:         WaitForReboot,
+			To:           Failed,
+			Time:         start.Add(15 * time.Minute),
+			Reason:       ReasonDeadlineExceeded,
+			Error:        "deadline of 15m0s exceeded in state WaitForReboot",
+		},
+	}, transitions)
+}
+
+func TestRunStopsRightAfterReachingTarget(t *testing.T) {
+	clock := newFakeClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	client := new(mockRobotClient)
+	client.On("Get", "reset/1").Return(allResetTypes, nil)
+	client.On("Post", "reset/1", mock.Anything).Return(`{}`, nil)
+	sm := NewStateMachine(client, new(sshtest.MockClient), &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+	sm.SetClock(clock)
+	sm.SetTargetState(WaitForReboot)
+	sm.StateChange(RequiresReboot)
+
+	require.NoError(t, sm.Run(context.Background()))
+
+	assert.Equal(t, WaitForReboot, sm.state)
+	// the run does not poll again once the target is reached
+	assert.Empty(t, clock.waits)
+}
+
+func TestCheckSSHRetriesWhenAuthFails(t *testing.T) {
+	client := new(mockRobotClient)
+	client.On("Get", "boot/1/rescue").Return(rescueEnabled, nil)
+	sshClient := new(sshtest.MockClient)
+	sshClient.On("SetTargetHost", "192.0.2.10", "22")
+	sshClient.On("Auth", "root", "secret").Return(errors.New("no password"))
+	sm := NewStateMachine(client, sshClient, &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+	sm.StateChange(WaitForReboot)
+
+	assert.Equal(t, WaitForReboot, sm.checkSSH())
+	sshClient.AssertNotCalled(t, "EstablishSSHSession")
+}
+
+func TestInstallImageRetriesWhenRebootFails(t *testing.T) {
+	client := new(mockRobotClient)
+	client.On("Post", "reset/1", mock.Anything).Return("", &robot.HTTPError{StatusCode: 409})
+	sshClient := new(sshtest.MockClient)
+	sshClient.On("VerifyDiskExists", "sda").Return("sda", nil)
+	sshClient.On("DownloadImage", mock.Anything).Return("", nil)
+	sshClient.On("InstallImage", "sda").Return("", nil)
+	sshClient.On("ReadPartitionTable", "sda").Return(talosPartitionTable, nil)
+	sm := NewStateMachine(client, sshClient, &v1alpha1.ServerParameters{ServerNumber: 1, Disk: "sda", TalosVersion: "v1.9.2"}, 5)
+	sm.StateChange(SSHAvailable)
+
+	assert.Equal(t, SSHAvailable, installImage(sm))
+	client.AssertExpectations(t)
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/eriklundjensen/thdctl/pkg/talos"
+)
+
+// talosAPITimeout limits the duration of a single Talos API call
+const talosAPITimeout = 30 * time.Second
+
+// serverIP returns the main IP address of the server
+func (sm *StateMachine) serverIP() (string, error) {
+	rescue, err := hetznerapi.GetRescueSystemDetails(sm.client, sm.server.ServerNumber)
+	if err != nil {
+		return "", err
+	}
+	return rescue.Rescue.ServerIP, nil
+}
+
+// applyConfig applies the machine config to the maintenance mode API of the node
+func (sm *StateMachine) applyConfig() ServerStatus {
+	host, err := sm.serverIP()
+	if err != nil {
+		sm.log.WithError(err).Error("Error getting server IP")
+		return RobotAPIUnavailable
+	}
+
+	if sm.server.Talosconfig != "" && sm.talosConfigured(host) {
+		sm.log.Info("Machine config already applied")
+		sm.retries = 0
+		return WaitingForBootstrap
+	}
+
+	config, err := os.ReadFile(sm.server.MachineConfig)
+	if err != nil {
+		sm.log.WithError(err).Error("Error reading machine config")
+		return sm.state
+	}
+
+	client, err := sm.talosConnector.Insecure(host)
+	if err != nil {
+		sm.log.WithError(err).Error("Failed to connect to Talos maintenance API")
+		return sm.state
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(sm.spanCtx, talosAPITimeout)
+	defer cancel()
+	if err := client.ApplyConfiguration(ctx, config, talos.ApplyModeAuto); err != nil {
+		sm.log.WithError(err).Error("Failed to apply machine config")
+		return sm.state
+	}
+
+	sm.log.WithField("host", host).Info("Machine config applied")
+	sm.retries = 0
+	return ConfigApplied
+}
+
+// checkConfigured waits for the Talos API to accept the credentials of the talosconfig
+func (sm *StateMachine) checkConfigured() ServerStatus {
+	host, err := sm.serverIP()
+	if err != nil {
+		sm.log.WithError(err).Error("Error getting server IP")
+		return RobotAPIUnavailable
+	}
+
+	if sm.talosConfigured(host) {
+		sm.retries = 0
+		return WaitingForBootstrap
+	}
+	return sm.state
+}
+
+// talosConfigured reports whether the node accepts the credentials of the talosconfig
+func (sm *StateMachine) talosConfigured(host string) bool {
+	client, err := sm.talosConnector.Secure(host)
+	if err != nil {
+		sm.log.WithError(err).Warn("Failed to connect to Talos API")
+		return false
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(sm.spanCtx, talosAPITimeout)
+	defer cancel()
+	version, err := client.Version(ctx)
+	if err != nil {
+		sm.log.WithError(err).Debug("Talos API not accepting talosconfig credentials")
+		return false
+	}
+	sm.log.WithField("version", version).Info("Talos API available using talosconfig")
+	return true
+}
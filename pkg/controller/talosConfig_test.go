@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi/sshtest"
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/eriklundjensen/thdctl/pkg/talos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Mocking the robot.ClientInterface
+type mockRobotClient struct {
+	mock.Mock
+}
+
+func (m *mockRobotClient) Get(path string) ([]byte, *robot.HTTPError) {
+	args := m.Called(path)
+	if err, ok := args.Get(1).(*robot.HTTPError); ok && err != nil {
+		return nil, err
+	}
+	return []byte(args.String(0)), nil
+}
+
+func (m *mockRobotClient) Post(path string, values url.Values) ([]byte, *robot.HTTPError) {
+	args := m.Called(path, values)
+	if err, ok := args.Get(1).(*robot.HTTPError); ok && err != nil {
+		return nil, err
+	}
+	return []byte(args.String(0)), nil
+}
+
+// Mocking the talos.Client
+type mockTalosClient struct {
+	mock.Mock
+}
+
+func (m *mockTalosClient) ApplyConfiguration(ctx context.Context, config []byte, mode talos.ApplyMode) error {
+	args := m.Called(config, mode)
+	return args.Error(0)
+}
+
+func (m *mockTalosClient) Version(ctx context.Context) (string, error) {
+	args := m.Called()
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockTalosClient) Bootstrap(ctx context.Context) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *mockTalosClient) ServiceList(ctx context.Context) ([]talos.Service, error) {
+	args := m.Called()
+	services, _ := args.Get(0).([]talos.Service)
+	return services, args.Error(1)
+}
+
+func (m *mockTalosClient) Kubeconfig(ctx context.Context) ([]byte, error) {
+	args := m.Called()
+	config, _ := args.Get(0).([]byte)
+	return config, args.Error(1)
+}
+
+func (m *mockTalosClient) Upgrade(ctx context.Context, image string) error {
+	args := m.Called(image)
+	return args.Error(0)
+}
+
+func (m *mockTalosClient) Reset(ctx context.Context, graceful, reboot bool) error {
+	args := m.Called(graceful, reboot)
+	return args.Error(0)
+}
+
+func (m *mockTalosClient) Close() error {
+	return nil
+}
+
+// fakeConnector returns the same clients for all endpoints
+type fakeConnector struct {
+	insecure talos.Client
+	secure   talos.Client
+}
+
+func (c *fakeConnector) Insecure(endpoint string) (talos.Client, error) {
+	if c.insecure == nil {
+		return nil, errors.New("no insecure client")
+	}
+	return c.insecure, nil
+}
+
+func (c *fakeConnector) Secure(endpoint string) (talos.Client, error) {
+	if c.secure == nil {
+		return nil, errors.New("no secure client")
+	}
+	return c.secure, nil
+}
+
+const rescueInactive = `{"rescue": {"server_ip": "192.0.2.10", "server_number": 1, "active": false}}`
+
+func newTalosTestStateMachine(t *testing.T, server *v1alpha1.ServerParameters, connector talos.Connector) *StateMachine {
+	t.Helper()
+	client := new(mockRobotClient)
+	client.On("Get", "boot/1/rescue").Return(rescueInactive, nil)
+	sm := NewStateMachine(client, new(sshtest.MockClient), server, 5)
+	sm.talosConnector = connector
+	return sm
+}
+
+func writeMachineConfig(t *testing.T) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "node1.yaml")
+	assert.NoError(t, os.WriteFile(filename, []byte("version: v1alpha1\n"), 0o600))
+	return filename
+}
+
+func TestApplyConfig(t *testing.T) {
+	insecure := new(mockTalosClient)
+	insecure.On("ApplyConfiguration", []byte("version: v1alpha1\n"), talos.ApplyModeAuto).Return(nil)
+	server := &v1alpha1.ServerParameters{ServerNumber: 1, MachineConfig: writeMachineConfig(t)}
+	sm := newTalosTestStateMachine(t, server, &fakeConnector{insecure: insecure})
+	sm.state = TalosAPIAvailable
+
+	assert.Equal(t, ConfigApplied, sm.applyConfig())
+	insecure.AssertExpectations(t)
+}
+
+func TestApplyConfigSkippedWhenConfigured(t *testing.T) {
+	insecure := new(mockTalosClient)
+	secure := new(mockTalosClient)
+	secure.On("Version").Return("v1.9.2", nil)
+	server := &v1alpha1.ServerParameters{ServerNumber: 1, MachineConfig: writeMachineConfig(t), Talosconfig: "talosconfig"}
+	sm := newTalosTestStateMachine(t, server, &fakeConnector{insecure: insecure, secure: secure})
+	sm.state = TalosAPIAvailable
+
+	assert.Equal(t, WaitingForBootstrap, sm.applyConfig())
+	insecure.AssertNotCalled(t, "ApplyConfiguration", mock.Anything, mock.Anything)
+}
+
+func TestApplyConfigFailureKeepsState(t *testing.T) {
+	insecure := new(mockTalosClient)
+	insecure.On("ApplyConfiguration", mock.Anything, mock.Anything).Return(errors.New("connection refused"))
+	server := &v1alpha1.ServerParameters{ServerNumber: 1, MachineConfig: writeMachineConfig(t)}
+	sm := newTalosTestStateMachine(t, server, &fakeConnector{insecure: insecure})
+	sm.state = TalosAPIAvailable
+
+	assert.Equal(t, TalosAPIAvailable, sm.applyConfig())
+}
+
+func TestCheckConfigured(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("Version").Return("", errors.New("certificate required")).Once()
+	secure.On("Version").Return("v1.9.2", nil)
+	server := &v1alpha1.ServerParameters{ServerNumber: 1, Talosconfig: "talosconfig"}
+	sm := newTalosTestStateMachine(t, server, &fakeConnector{secure: secure})
+	sm.state = ConfigApplied
+
+	assert.Equal(t, ConfigApplied, sm.checkConfigured())
+	assert.Equal(t, WaitingForBootstrap, sm.checkConfigured())
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/eriklundjensen/thdctl/pkg/controller")
+
+// contextSetter is implemented by SSH clients tracing their commands, e.g. hetznerapi.SSHClient
+type contextSetter interface {
+	SetContext(ctx context.Context)
+}
+
+// setSpanContext sets the parent of the spans of the Robot requests and SSH commands of a state handler
+func (sm *StateMachine) setSpanContext(ctx context.Context) {
+	sm.spanCtx = ctx
+	if client, ok := sm.sshClient.(contextSetter); ok {
+		client.SetContext(ctx)
+	}
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedClient records a span for each Robot request of a state machine.
+// Requests of a ContextClient are cancelled with the run.
+type tracedClient struct {
+	client robot.ClientInterface
+	sm     *StateMachine
+}
+
+func (c *tracedClient) Get(path string) ([]byte, *robot.HTTPError) {
+	span := c.start("GET", path)
+	var body []byte
+	var err *robot.HTTPError
+	if client, ok := c.client.(robot.ContextClient); ok {
+		body, err = client.GetContext(c.sm.spanCtx, path)
+	} else {
+		body, err = c.client.Get(path)
+	}
+	c.end(span, err)
+	return body, err
+}
+
+// Post does not record the values, they may contain passwords and keys
+func (c *tracedClient) Post(path string, values url.Values) ([]byte, *robot.HTTPError) {
+	span := c.start("POST", path)
+	var body []byte
+	var err *robot.HTTPError
+	if client, ok := c.client.(robot.ContextClient); ok {
+		body, err = client.PostContext(c.sm.spanCtx, path, values)
+	} else {
+		body, err = c.client.Post(path, values)
+	}
+	c.end(span, err)
+	return body, err
+}
+
+func (c *tracedClient) start(method, path string) trace.Span {
+	endpoint, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	_, span := tracer.Start(c.sm.spanCtx, "Robot "+method+" "+endpoint, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", method),
+			attribute.String("url.path", path),
+		))
+	return span
+}
+
+func (c *tracedClient) end(span trace.Span, err *robot.HTTPError) {
+	if err == nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", 200))
+		span.End()
+		return
+	}
+	if err.StatusCode != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", err.StatusCode))
+	}
+	endSpan(span, err)
+}
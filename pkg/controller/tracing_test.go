@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi/sshtest"
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func TestRunRecordsSpans(t *testing.T) {
+	exporter := recordSpans(t)
+	sm := newWaitForRebootStateMachine(newFakeClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC)))
+
+	require.Error(t, sm.Run(context.Background()))
+
+	spans := exporter.GetSpans()
+	byName := map[string][]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+	require.Len(t, byName["StateMachine.Run"], 1)
+	root := byName["StateMachine.Run"][0]
+	assert.Equal(t, codes.Error, root.Status.Code)
+	assert.False(t, root.Parent.IsValid())
+
+	require.NotEmpty(t, byName["WaitForReboot"])
+	handler := byName["WaitForReboot"][0]
+	assert.Equal(t, root.SpanContext.SpanID(), handler.Parent.SpanID())
+
+	require.NotEmpty(t, byName["Robot GET boot"])
+	request := byName["Robot GET boot"][0]
+	assert.Equal(t, handler.SpanContext.SpanID(), request.Parent.SpanID())
+	assert.Equal(t, root.SpanContext.TraceID(), request.SpanContext.TraceID())
+}
+
+func TestRobotRequestsAreCancelledWithTheRun(t *testing.T) {
+	client := new(mockRobotClient)
+	client.On("Get", "server/1").Return(`{}`, nil).Once()
+	// the first request uses the burst, the next one waits for the limiter
+	limited := robot.NewRateLimitedClient(client, 0.001, 1)
+	sm := NewStateMachine(limited, new(sshtest.MockClient), &v1alpha1.ServerParameters{ServerNumber: 1}, 5)
+	_, err := sm.client.Get("server/1")
+	require.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	sm.setSpanContext(ctx)
+	cancel()
+
+	_, err = sm.client.Get("server/1")
+
+	require.NotNil(t, err)
+	assert.ErrorIs(t, err.Err, context.Canceled)
+	client.AssertExpectations(t)
+}
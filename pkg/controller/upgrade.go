@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/talos"
+	"github.com/sirupsen/logrus"
+)
+
+// desiredTalosVersion returns the Talos version of the spec. The version is taken from the
+// release or image factory URL of the image when TalosVersion is not set.
+func desiredTalosVersion(server *v1alpha1.ServerParameters) string {
+	if server.TalosVersion != "" {
+		return server.TalosVersion
+	}
+	return talos.ImageVersion(server.TalosImage)
+}
+
+// sameVersion compares Talos versions with or without the v prefix
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
+
+// runningTalosVersion returns the Talos version reported by the configured node
+func (sm *StateMachine) runningTalosVersion() (string, error) {
+	host, err := sm.serverIP()
+	if err != nil {
+		return "", err
+	}
+	client, err := sm.talosConnector.Secure(host)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(sm.spanCtx, talosAPITimeout)
+	defer cancel()
+	return client.Version(ctx)
+}
+
+// checkTalosVersion compares the running Talos version with the spec.
+// The current state is kept when the versions match or the version cannot be determined.
+func (sm *StateMachine) checkTalosVersion() ServerStatus {
+	desired := desiredTalosVersion(sm.server)
+	if desired == "" || sm.server.Talosconfig == "" {
+		return sm.state
+	}
+
+	running, err := sm.runningTalosVersion()
+	if err != nil {
+		sm.log.WithError(err).Warn("Failed to get running Talos version")
+		return sm.state
+	}
+	sm.status.Talos.Version = running
+	if sameVersion(running, desired) {
+		return sm.state
+	}
+
+	sm.log.WithFields(logrus.Fields{
+		"running": running,
+		"desired": desired,
+	}).Info("Talos version drift detected")
+	sm.retries = 0
+	return TalosVersionDrift
+}
+
+// upgrade starts an in-place upgrade to the desired version using the installer image of the spec
+func (sm *StateMachine) upgrade() ServerStatus {
+	desired := desiredTalosVersion(sm.server)
+	image := talos.InstallerImage(desired, sm.server.TalosImage)
+
+	client, state, ok := sm.secureTalosClient()
+	if !ok {
+		return state
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(sm.spanCtx, talosAPITimeout)
+	defer cancel()
+	if err := client.Upgrade(ctx, image); err != nil {
+		sm.log.WithError(err).Error("Failed to upgrade Talos")
+		return sm.state
+	}
+
+	sm.log.WithFields(logrus.Fields{
+		"from":  sm.status.Talos.Version,
+		"to":    desired,
+		"image": image,
+	}).Info("Talos upgrade started")
+	sm.status.Talos.Upgrade = &v1alpha1.TalosUpgrade{
+		FromVersion: sm.status.Talos.Version,
+		ToVersion:   desired,
+		Image:       image,
+	}
+	sm.retries = 0
+	return TalosUpgrading
+}
+
+// checkUpgrade waits for the node to come back running the desired version
+func (sm *StateMachine) checkUpgrade() ServerStatus {
+	running, err := sm.runningTalosVersion()
+	if err != nil {
+		sm.log.WithError(err).Debug("Waiting for the Talos API after upgrade")
+		return sm.state
+	}
+	desired := desiredTalosVersion(sm.server)
+	if !sameVersion(running, desired) {
+		sm.log.WithField("version", running).Info("Waiting for the upgrade to complete")
+		return sm.state
+	}
+
+	sm.log.WithField("version", running).Info("Talos upgrade completed")
+	sm.status.Talos.Version = running
+	if sm.status.Talos.Upgrade != nil {
+		sm.status.Talos.Upgrade.Completed = true
+	}
+	sm.retries = 0
+	return WaitingForBootstrap
+}
@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const factorySchematic = "376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba"
+
+func TestDesiredTalosVersion(t *testing.T) {
+	assert.Equal(t, "v1.9.3", desiredTalosVersion(&v1alpha1.ServerParameters{TalosVersion: "v1.9.3"}))
+	assert.Equal(t, "v1.9.2", desiredTalosVersion(&v1alpha1.ServerParameters{
+		TalosImage: "https://factory.talos.dev/image/" + factorySchematic + "/v1.9.2/metal-amd64.raw.zst",
+	}))
+	assert.Equal(t, "", desiredTalosVersion(&v1alpha1.ServerParameters{TalosImage: "https://example.com/talos.raw.zst"}))
+}
+
+func TestCheckTalosVersion(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("Version").Return("v1.9.2", nil)
+	server := &v1alpha1.ServerParameters{ServerNumber: 1, Talosconfig: "talosconfig", TalosVersion: "v1.9.2"}
+	sm := newTalosTestStateMachine(t, server, &fakeConnector{secure: secure})
+	sm.state = WaitingForBootstrap
+
+	assert.Equal(t, WaitingForBootstrap, sm.checkTalosVersion())
+	assert.Equal(t, "v1.9.2", sm.Status().Talos.Version)
+
+	server.TalosVersion = "v1.9.3"
+	assert.Equal(t, TalosVersionDrift, sm.checkTalosVersion())
+}
+
+func TestCheckTalosVersionUnavailableKeepsState(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("Version").Return("", errors.New("connection refused"))
+	server := &v1alpha1.ServerParameters{ServerNumber: 1, Talosconfig: "talosconfig", TalosVersion: "v1.9.3"}
+	sm := newTalosTestStateMachine(t, server, &fakeConnector{secure: secure})
+	sm.state = WaitingForBootstrap
+
+	assert.Equal(t, WaitingForBootstrap, sm.checkTalosVersion())
+}
+
+func TestVersionDriftWithoutMachineConfig(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("Version").Return("v1.9.2", nil)
+	// the node is configured outside of thdctl
+	server := &v1alpha1.ServerParameters{ServerNumber: 1, Talosconfig: "talosconfig", TalosVersion: "v1.9.3"}
+	sm := newTalosTestStateMachine(t, server, &fakeConnector{secure: secure})
+	sm.state = TalosAPIAvailable
+
+	done, err := sm.handleState(context.Background())
+
+	assert.NoError(t, err)
+	assert.False(t, done)
+	assert.Equal(t, TalosVersionDrift, sm.state)
+
+	server.TalosVersion = "v1.9.2"
+	sm.state = TalosAPIAvailable
+	done, err = sm.handleState(context.Background())
+
+	assert.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, TalosAPIAvailable, sm.state)
+}
+
+func TestUpgradeKeepsSchematic(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("Upgrade", "factory.talos.dev/installer/"+factorySchematic+":v1.9.3").Return(nil)
+	server := &v1alpha1.ServerParameters{
+		ServerNumber: 1,
+		Talosconfig:  "talosconfig",
+		TalosVersion: "v1.9.3",
+		TalosImage:   "https://factory.talos.dev/image/" + factorySchematic + "/v1.9.2/metal-amd64.raw.zst",
+	}
+	sm := newTalosTestStateMachine(t, server, &fakeConnector{secure: secure})
+	sm.state = TalosVersionDrift
+	sm.status.Talos.Version = "v1.9.2"
+
+	assert.Equal(t, TalosUpgrading, sm.upgrade())
+	secure.AssertExpectations(t)
+	assert.Equal(t, &v1alpha1.TalosUpgrade{
+		FromVersion: "v1.9.2",
+		ToVersion:   "v1.9.3",
+		Image:       "factory.talos.dev/installer/" + factorySchematic + ":v1.9.3",
+	}, sm.Status().Talos.Upgrade)
+}
+
+func TestUpgradeFailureKeepsState(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("Upgrade", mock.Anything).Return(errors.New("upgrade in progress"))
+	server := &v1alpha1.ServerParameters{ServerNumber: 1, Talosconfig: "talosconfig", TalosVersion: "v1.9.3"}
+	sm := newTalosTestStateMachine(t, server, &fakeConnector{secure: secure})
+	sm.state = TalosVersionDrift
+
+	assert.Equal(t, TalosVersionDrift, sm.upgrade())
+	assert.Nil(t, sm.Status().Talos.Upgrade)
+}
+
+func TestCheckUpgrade(t *testing.T) {
+	secure := new(mockTalosClient)
+	secure.On("Version").Return("", errors.New("connection refused")).Once()
+	secure.On("Version").Return("v1.9.2", nil).Once()
+	secure.On("Version").Return("v1.9.3", nil)
+	server := &v1alpha1.ServerParameters{ServerNumber: 1, Talosconfig: "talosconfig", TalosVersion: "v1.9.3"}
+	sm := newTalosTestStateMachine(t, server, &fakeConnector{secure: secure})
+	sm.state = TalosUpgrading
+	sm.status.Talos.Upgrade = &v1alpha1.TalosUpgrade{FromVersion: "v1.9.2", ToVersion: "v1.9.3"}
+
+	assert.Equal(t, TalosUpgrading, sm.checkUpgrade())
+	assert.Equal(t, TalosUpgrading, sm.checkUpgrade())
+	assert.Equal(t, WaitingForBootstrap, sm.checkUpgrade())
+	assert.True(t, sm.Status().Talos.Upgrade.Completed)
+	assert.Equal(t, "v1.9.3", sm.Status().Talos.Version)
+}
+
+// contextTalosClient records the context of Version
+type contextTalosClient struct {
+	mockTalosClient
+	ctx context.Context
+}
+
+func (c *contextTalosClient) Version(ctx context.Context) (string, error) {
+	c.ctx = ctx
+	return "", ctx.Err()
+}
+
+func TestTalosRequestsAreCancelledWithTheRun(t *testing.T) {
+	secure := &contextTalosClient{}
+	server := &v1alpha1.ServerParameters{ServerNumber: 1, Talosconfig: "talosconfig", TalosVersion: "v1.9.3"}
+	sm := newTalosTestStateMachine(t, server, &fakeConnector{secure: secure})
+	ctx, cancel := context.WithCancel(context.Background())
+	sm.setSpanContext(ctx)
+	cancel()
+
+	_, err := sm.runningTalosVersion()
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, secure.ctx.Err(), context.Canceled)
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/sirupsen/logrus"
+)
+
+// TalosPartitions are the partitions expected on a disk after the Talos metal image has been written
+var TalosPartitions = []string{"EFI", "BIOS", "BOOT", "META", "STATE"}
+
+// verifyInstallation re-reads the partition table of the disk and verifies the Talos partitions are present.
+// When verifyDigest is set the digest of the written prefix of the disk is compared with the digest of the image.
+func verifyInstallation(log *logrus.Entry, sshClient hetznerapi.SSHClientInterface, disk string, verifyDigest bool) (*hetznerapi.PartitionTable, error) {
+	output, err := sshClient.ReadPartitionTable(disk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partition table of %s: %w", disk, err)
+	}
+	table, err := hetznerapi.ParseSfdiskOutput(output)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, name := range TalosPartitions {
+		if table.PartitionByName(name) == nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("partitions %v missing on %s", missing, disk)
+	}
+	log.WithField("disk", disk).Info("Talos partitions verified")
+
+	if verifyDigest {
+		if err := verifyImageDigest(log, sshClient, disk); err != nil {
+			return nil, err
+		}
+	}
+	return table, nil
+}
+
+func verifyImageDigest(log *logrus.Entry, sshClient hetznerapi.SSHClientInterface, disk string) error {
+	output, err := sshClient.ImageSizeAndDigest()
+	if err != nil {
+		return fmt.Errorf("failed to calculate image digest: %w", err)
+	}
+	size, imageDigest, err := hetznerapi.ParseSizeAndDigestOutput(output)
+	if err != nil {
+		return err
+	}
+
+	output, err = sshClient.DiskDigest(disk, size)
+	if err != nil {
+		return fmt.Errorf("failed to calculate digest of %s: %w", disk, err)
+	}
+	diskDigest, err := hetznerapi.ParseSHA256SumOutput(output)
+	if err != nil {
+		return err
+	}
+
+	if imageDigest != diskDigest {
+		return fmt.Errorf("digest of %s (%s) does not match image digest (%s)", disk, diskDigest, imageDigest)
+	}
+	log.WithFields(logrus.Fields{
+		"disk":   disk,
+		"size":   size,
+		"digest": imageDigest,
+	}).Info("Image digest verified")
+	return nil
+}
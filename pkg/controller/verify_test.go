@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi/sshtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const talosPartitionTable = `{"partitiontable": {"label": "gpt", "device": "/dev/sda", "partitions": [
+	{"node": "/dev/sda1", "name": "EFI"},
+	{"node": "/dev/sda2", "name": "BIOS"},
+	{"node": "/dev/sda3", "name": "BOOT"},
+	{"node": "/dev/sda4", "name": "META"},
+	{"node": "/dev/sda5", "name": "STATE"}
+]}}`
+
+func TestVerifyInstallation(t *testing.T) {
+	sshClient := new(sshtest.MockClient)
+	sshClient.On("ReadPartitionTable", "sda").Return(talosPartitionTable, nil)
+
+	table, err := verifyInstallation(logrus.NewEntry(logrus.StandardLogger()), sshClient, "sda", false)
+
+	assert.NoError(t, err)
+	assert.Len(t, table.Partitions, 5)
+	sshClient.AssertExpectations(t)
+}
+
+func TestVerifyInstallationMissingPartitions(t *testing.T) {
+	sshClient := new(sshtest.MockClient)
+	sshClient.On("ReadPartitionTable", "sda").Return(`{"partitiontable": {"label": "gpt", "partitions": [{"node": "/dev/sda1", "name": "EFI"}]}}`, nil)
+
+	_, err := verifyInstallation(logrus.NewEntry(logrus.StandardLogger()), sshClient, "sda", false)
+
+	assert.ErrorContains(t, err, "[BIOS BOOT META STATE]")
+}
+
+func TestVerifyInstallationDigest(t *testing.T) {
+	imageDigest := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08  -"
+	tests := []struct {
+		name       string
+		diskDigest string
+		wantErr    bool
+	}{
+		{"matching digest", imageDigest, false},
+		{"truncated image", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  -", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sshClient := new(sshtest.MockClient)
+			sshClient.On("ReadPartitionTable", "sda").Return(talosPartitionTable, nil)
+			sshClient.On("ImageSizeAndDigest").Return("1306525696\n"+imageDigest+"\n", nil)
+			sshClient.On("DiskDigest", "sda", int64(1306525696)).Return(tt.diskDigest, nil)
+
+			_, err := verifyInstallation(logrus.NewEntry(logrus.StandardLogger()), sshClient, "sda", true)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			sshClient.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// Package genconfig generates the Talos machine configs and the talosconfig of a cluster.
+//
+// The configs are generated by talosctl. Secrets are generated once and reused for all nodes and later runs,
+// while the node specific patches (hostname, install disk and installer image) are derived from the server specifications.
+package genconfig
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+
+	clusterv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/cluster/v1alpha"
+	serverv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/talos"
+	yaml "github.com/goccy/go-yaml"
+	"github.com/sirupsen/logrus"
+)
+
+// validNodeName matches node names usable as hostname and file name
+var validNodeName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Runner runs talosctl with the given arguments
+type Runner interface {
+	Run(args ...string) (string, error)
+}
+
+// Talosctl runs the talosctl binary
+type Talosctl struct {
+	Path string
+}
+
+func (t Talosctl) Run(args ...string) (string, error) {
+	path := t.Path
+	if path == "" {
+		path = "talosctl"
+	}
+	output, err := exec.Command(path, args...).CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("failed to run talosctl %v: %w", args, err)
+	}
+	return string(output), nil
+}
+
+// Node is a node of the cluster together with its server specification
+type Node struct {
+	clusterv1alpha1.Node
+	Server *serverv1alpha1.ServerParameters
+}
+
+// Generator writes the generated configs to OutputDir
+type Generator struct {
+	Runner    Runner
+	OutputDir string
+}
+
+// SecretsFile returns the path of the secrets bundle
+func (g *Generator) SecretsFile() string {
+	return filepath.Join(g.OutputDir, "secrets.yaml")
+}
+
+// TalosconfigFile returns the path of the generated talosconfig
+func (g *Generator) TalosconfigFile() string {
+	return filepath.Join(g.OutputDir, "talosconfig")
+}
+
+// NodeConfigFile returns the path of the machine config of a node
+func (g *Generator) NodeConfigFile(node string) string {
+	return filepath.Join(g.OutputDir, node+".yaml")
+}
+
+// Generate writes the secrets (if not present), the talosconfig and a machine config per node
+func (g *Generator) Generate(cluster *clusterv1alpha1.ClusterParameters, nodes []Node) error {
+	if cluster.ClusterName == "" || cluster.Endpoint == "" {
+		return fmt.Errorf("clusterName and endpoint must be set")
+	}
+	for _, node := range nodes {
+		if !validNodeName.MatchString(node.Name) {
+			return fmt.Errorf("invalid node name '%s'", node.Name)
+		}
+		if node.Role != clusterv1alpha1.ControlPlane && node.Role != clusterv1alpha1.Worker {
+			return fmt.Errorf("invalid role '%s' of node %s", node.Role, node.Name)
+		}
+	}
+
+	if err := os.MkdirAll(g.OutputDir, 0o700); err != nil {
+		return fmt.Errorf("error creating output directory: %v", err)
+	}
+	if err := g.generateSecrets(); err != nil {
+		return err
+	}
+	if err := g.generateTalosconfig(cluster, nodes); err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if err := g.generateNodeConfig(cluster, node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Generator) generateSecrets() error {
+	if _, err := os.Stat(g.SecretsFile()); err == nil {
+		logrus.WithField("file", g.SecretsFile()).Info("Reusing existing secrets")
+		return nil
+	}
+	if output, err := g.Runner.Run("gen", "secrets", "--output-file", g.SecretsFile()); err != nil {
+		logrus.WithField("output", output).Error("Failed to generate secrets")
+		return err
+	}
+	logrus.WithField("file", g.SecretsFile()).Info("Secrets generated")
+	return nil
+}
+
+func (g *Generator) generateTalosconfig(cluster *clusterv1alpha1.ClusterParameters, nodes []Node) error {
+	args := append(g.commonArgs(cluster), "--output-types", "talosconfig", "--output", g.TalosconfigFile(), cluster.ClusterName, cluster.Endpoint)
+	if output, err := g.Runner.Run(args...); err != nil {
+		logrus.WithField("output", output).Error("Failed to generate talosconfig")
+		return err
+	}
+
+	var endpoints []string
+	for _, node := range nodes {
+		if node.Role == clusterv1alpha1.ControlPlane && node.Address != "" {
+			endpoints = append(endpoints, node.Address)
+		}
+	}
+	if len(endpoints) > 0 {
+		args := append([]string{"--talosconfig", g.TalosconfigFile(), "config", "endpoint"}, endpoints...)
+		if output, err := g.Runner.Run(args...); err != nil {
+			logrus.WithField("output", output).Error("Failed to set talosconfig endpoints")
+			return err
+		}
+	}
+	logrus.WithField("file", g.TalosconfigFile()).Info("Talosconfig generated")
+	return nil
+}
+
+func (g *Generator) generateNodeConfig(cluster *clusterv1alpha1.ClusterParameters, node Node) error {
+	patchFile := filepath.Join(g.OutputDir, node.Name+"-patch.yaml")
+	patch, err := yaml.Marshal(nodePatch(cluster, node))
+	if err != nil {
+		return fmt.Errorf("error creating patch of node %s: %v", node.Name, err)
+	}
+	if err := os.WriteFile(patchFile, patch, 0o600); err != nil {
+		return fmt.Errorf("error writing patch of node %s: %v", node.Name, err)
+	}
+
+	patches := append([]string{}, cluster.Patches...)
+	if node.Role == clusterv1alpha1.ControlPlane {
+		patches = append(patches, cluster.ControlPlanePatches...)
+	} else {
+		patches = append(patches, cluster.WorkerPatches...)
+	}
+	patches = append(append(patches, node.Patches...), patchFile)
+
+	args := append(g.commonArgs(cluster), "--output-types", string(node.Role), "--output", g.NodeConfigFile(node.Name))
+	for _, patch := range patches {
+		args = append(args, "--config-patch", "@"+patch)
+	}
+	args = append(args, cluster.ClusterName, cluster.Endpoint)
+
+	if output, err := g.Runner.Run(args...); err != nil {
+		logrus.WithField("output", output).Errorf("Failed to generate config of node %s", node.Name)
+		return err
+	}
+	logrus.WithFields(logrus.Fields{
+		"node": node.Name,
+		"role": node.Role,
+		"file": g.NodeConfigFile(node.Name),
+	}).Info("Machine config generated")
+	return nil
+}
+
+func (g *Generator) commonArgs(cluster *clusterv1alpha1.ClusterParameters) []string {
+	args := []string{"gen", "config", "--with-secrets", g.SecretsFile(), "--force",
+		fmt.Sprintf("--with-cluster-discovery=%t", cluster.ClusterDiscovery)}
+	if cluster.KubernetesVersion != "" {
+		args = append(args, "--kubernetes-version", cluster.KubernetesVersion)
+	}
+	if cluster.TalosVersion != "" {
+		args = append(args, "--talos-version", cluster.TalosVersion)
+	}
+	return args
+}
+
+// nodePatch returns the machine config patch with the node specific settings
+func nodePatch(cluster *clusterv1alpha1.ClusterParameters, node Node) yaml.MapSlice {
+	install := yaml.MapSlice{}
+	if node.Server != nil {
+		if node.Server.Disk != "" {
+			install = append(install, yaml.MapItem{Key: "disk", Value: "/dev/" + node.Server.Disk})
+		}
+		version := node.Server.TalosVersion
+		if version == "" {
+			version = cluster.TalosVersion
+		}
+		if image := talos.InstallerImage(version, node.Server.TalosImage); image != "" {
+			install = append(install, yaml.MapItem{Key: "image", Value: image})
+		}
+	}
+
+	machine := yaml.MapSlice{
+		{Key: "network", Value: yaml.MapSlice{{Key: "hostname", Value: node.Name}}},
+	}
+	if len(install) > 0 {
+		machine = append(machine, yaml.MapItem{Key: "install", Value: install})
+	}
+	return yaml.MapSlice{{Key: "machine", Value: machine}}
+}
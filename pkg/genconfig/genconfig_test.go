@@ -0,0 +1,104 @@
+package genconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	clusterv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/cluster/v1alpha"
+	serverv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRunner struct {
+	calls [][]string
+}
+
+func (r *fakeRunner) Run(args ...string) (string, error) {
+	r.calls = append(r.calls, args)
+	return "", nil
+}
+
+func testCluster() *clusterv1alpha1.ClusterParameters {
+	return &clusterv1alpha1.ClusterParameters{
+		ClusterName:         "demo-1",
+		Endpoint:            "https://88.99.98.244:6443",
+		KubernetesVersion:   "1.32.3",
+		Patches:             []string{"talos/cluster.yaml", "talos/all-nodes.yaml"},
+		ControlPlanePatches: []string{"talos/controlplane.yaml"},
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	runner := &fakeRunner{}
+	g := &Generator{Runner: runner, OutputDir: t.TempDir()}
+	nodes := []Node{
+		{
+			Node:   clusterv1alpha1.Node{Name: "node1", Role: clusterv1alpha1.ControlPlane, Address: "88.99.98.244"},
+			Server: &serverv1alpha1.ServerParameters{ServerNumber: 1, Disk: "sda", TalosVersion: "v1.9.2"},
+		},
+		{
+			Node:   clusterv1alpha1.Node{Name: "node2", Role: clusterv1alpha1.Worker},
+			Server: &serverv1alpha1.ServerParameters{ServerNumber: 2, Disk: "nvme0n1", TalosVersion: "v1.9.2"},
+		},
+	}
+
+	err := g.Generate(testCluster(), nodes)
+
+	assert.NoError(t, err)
+	assert.Len(t, runner.calls, 5)
+	assert.Equal(t, []string{"gen", "secrets", "--output-file", g.SecretsFile()}, runner.calls[0])
+	assert.Contains(t, strings.Join(runner.calls[1], " "), "--output-types talosconfig")
+	assert.Equal(t, []string{"--talosconfig", g.TalosconfigFile(), "config", "endpoint", "88.99.98.244"}, runner.calls[2])
+
+	node1 := strings.Join(runner.calls[3], " ")
+	assert.Contains(t, node1, "--output-types controlplane --output "+g.NodeConfigFile("node1"))
+	assert.Contains(t, node1, "--with-cluster-discovery=false")
+	assert.Contains(t, node1, "--kubernetes-version 1.32.3")
+	assert.Contains(t, node1, "--config-patch @talos/cluster.yaml --config-patch @talos/all-nodes.yaml --config-patch @talos/controlplane.yaml --config-patch @"+filepath.Join(g.OutputDir, "node1-patch.yaml"))
+	assert.True(t, strings.HasSuffix(node1, "demo-1 https://88.99.98.244:6443"))
+
+	node2 := strings.Join(runner.calls[4], " ")
+	assert.Contains(t, node2, "--output-types worker")
+	assert.NotContains(t, node2, "controlplane.yaml")
+
+	patch, err := os.ReadFile(filepath.Join(g.OutputDir, "node2-patch.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, `machine:
+  network:
+    hostname: node2
+  install:
+    disk: /dev/nvme0n1
+    image: ghcr.io/siderolabs/installer:v1.9.2
+`, string(patch))
+}
+
+func TestGenerateReusesSecrets(t *testing.T) {
+	runner := &fakeRunner{}
+	g := &Generator{Runner: runner, OutputDir: t.TempDir()}
+	assert.NoError(t, os.WriteFile(g.SecretsFile(), []byte("cluster: {}\n"), 0o600))
+
+	err := g.Generate(testCluster(), nil)
+
+	assert.NoError(t, err)
+	assert.Len(t, runner.calls, 1)
+	assert.Equal(t, []string{"gen", "config"}, runner.calls[0][:2])
+}
+
+func TestGenerateInvalidNode(t *testing.T) {
+	tests := []clusterv1alpha1.Node{
+		{Name: "../node1", Role: clusterv1alpha1.ControlPlane},
+		{Name: "node1", Role: "master"},
+	}
+
+	for _, node := range tests {
+		runner := &fakeRunner{}
+		g := &Generator{Runner: runner, OutputDir: t.TempDir()}
+
+		err := g.Generate(testCluster(), []Node{{Node: node}})
+
+		assert.Error(t, err)
+		assert.Empty(t, runner.calls)
+	}
+}
@@ -0,0 +1,94 @@
+package hetznerapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Partition struct {
+	Node  string `json:"node"`
+	Start int64  `json:"start"`
+	Size  int64  `json:"size"`
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+}
+
+type PartitionTable struct {
+	Label      string      `json:"label"`
+	Device     string      `json:"device"`
+	SectorSize int64       `json:"sectorsize"`
+	Partitions []Partition `json:"partitions"`
+}
+
+var sha256Digest = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ParseSfdiskOutput parses the output of `sfdisk --json`.
+func ParseSfdiskOutput(output string) (*PartitionTable, error) {
+	var result struct {
+		PartitionTable *PartitionTable `json:"partitiontable"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse sfdisk output: %w", err)
+	}
+	if result.PartitionTable == nil {
+		return nil, fmt.Errorf("no partition table found")
+	}
+	return result.PartitionTable, nil
+}
+
+// PartitionByName returns the partition with the given (GPT) name.
+func (t *PartitionTable) PartitionByName(name string) *Partition {
+	for i := range t.Partitions {
+		if t.Partitions[i].Name == name {
+			return &t.Partitions[i]
+		}
+	}
+	return nil
+}
+
+// SizeInBytes returns the size of a partition of the table in bytes.
+func (t *PartitionTable) SizeInBytes(partition *Partition) int64 {
+	sectorSize := t.SectorSize
+	if sectorSize == 0 {
+		sectorSize = 512
+	}
+	return partition.Size * sectorSize
+}
+
+// ParseSHA256SumOutput returns the digest from the output of `sha256sum`.
+func ParseSHA256SumOutput(output string) (string, error) {
+	fields := strings.Fields(output)
+	if len(fields) == 0 || !sha256Digest.MatchString(fields[0]) {
+		return "", fmt.Errorf("unexpected sha256sum output: %q", output)
+	}
+	return fields[0], nil
+}
+
+// ParseSizeAndDigestOutput parses the byte count followed by the sha256sum line printed by ImageSizeAndDigest
+func ParseSizeAndDigestOutput(output string) (int64, string, error) {
+	sizeLine, digestLine, found := strings.Cut(strings.TrimSpace(output), "\n")
+	if !found {
+		return 0, "", fmt.Errorf("unexpected size and digest output: %q", output)
+	}
+	size, err := ParseSizeOutput(sizeLine)
+	if err != nil {
+		return 0, "", err
+	}
+	digest, err := ParseSHA256SumOutput(digestLine)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, digest, nil
+}
+
+// ParseSizeOutput parses a byte count like the output of `wc -c`.
+func ParseSizeOutput(output string) (int64, error) {
+	size, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected size output: %q", output)
+	}
+	return size, nil
+}
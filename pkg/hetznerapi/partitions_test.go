@@ -0,0 +1,62 @@
+package hetznerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSfdiskOutput(t *testing.T) {
+	output := `{
+   "partitiontable": {
+      "label": "gpt",
+      "id": "0B1E6C2A-6C9A-4F1C-9D43-4E4A2E8A7C11",
+      "device": "/dev/sda",
+      "unit": "sectors",
+      "sectorsize": 512,
+      "partitions": [
+         {"node": "/dev/sda1", "start": 2048, "size": 204800, "type": "C12A7328-F81F-11D2-BA4B-00A0C93EC93B", "name": "EFI"},
+         {"node": "/dev/sda2", "start": 206848, "size": 2048, "type": "21686148-6449-6E6F-744E-656564454649", "name": "BIOS"},
+         {"node": "/dev/sda3", "start": 208896, "size": 2048000, "type": "0FC63DAF-8483-4772-8E79-3D69D8477DE4", "name": "BOOT"}
+      ]
+   }
+}`
+
+	table, err := ParseSfdiskOutput(output)
+	assert.NoError(t, err)
+	assert.Equal(t, "gpt", table.Label)
+	assert.Len(t, table.Partitions, 3)
+	assert.Equal(t, "/dev/sda2", table.PartitionByName("BIOS").Node)
+	assert.Nil(t, table.PartitionByName("STATE"))
+}
+
+func TestParseSfdiskOutputWithoutPartitionTable(t *testing.T) {
+	_, err := ParseSfdiskOutput(`{}`)
+	assert.Error(t, err)
+}
+
+func TestParseSHA256SumOutput(t *testing.T) {
+	digest, err := ParseSHA256SumOutput("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  -\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", digest)
+
+	_, err = ParseSHA256SumOutput("sha256sum: command not found")
+	assert.Error(t, err)
+}
+
+func TestParseSizeOutput(t *testing.T) {
+	size, err := ParseSizeOutput("1306525696\n")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1306525696), size)
+}
+
+func TestParseSizeAndDigestOutput(t *testing.T) {
+	size, digest, err := ParseSizeAndDigestOutput("1306525696\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  -\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", digest)
+	assert.Equal(t, int64(1306525696), size)
+
+	// the digest is missing when sha256sum fails
+	_, _, err = ParseSizeAndDigestOutput("1306525696\n")
+	assert.Error(t, err)
+}
@@ -0,0 +1,65 @@
+package hetznerapi
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+)
+
+type MDArray struct {
+	Name    string
+	State   string
+	Level   string
+	Devices []string
+}
+
+var (
+	// mdArrayLine matches the first line of an array in /proc/mdstat, e.g.
+	// "md2 : active raid1 sda3[0] sdb3[1]" or "md127 : inactive sda3[0](S)"
+	mdArrayLine = regexp.MustCompile(`^(md[a-z0-9_]+) : (active|inactive)(.*)$`)
+	// mdDevice matches a member device like "sda3[0]" or "nvme0n1p2[1](F)"
+	mdDevice = regexp.MustCompile(`^([a-z0-9]+)\[\d+\](\([A-Z]\))?$`)
+	// partitionSuffix matches the partition part of a device name, e.g. "3" in sda3 or "p2" in nvme0n1p2
+	partitionSuffix = regexp.MustCompile(`^((?:nvme\d+n\d+|mmcblk\d+)p\d+|sd[a-z]+\d+)$`)
+)
+
+// ParseMDStat parses the content of /proc/mdstat and extracts the software RAID arrays.
+func ParseMDStat(output string) ([]MDArray, error) {
+	var arrays []MDArray
+	scanner := bufio.NewScanner(strings.NewReader(output))
+
+	for scanner.Scan() {
+		match := mdArrayLine.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if match == nil {
+			continue
+		}
+
+		array := MDArray{Name: match[1], State: match[2]}
+		for _, field := range strings.Fields(match[3]) {
+			if device := mdDevice.FindStringSubmatch(field); device != nil {
+				array.Devices = append(array.Devices, device[1])
+			} else if strings.HasPrefix(field, "raid") || field == "linear" {
+				array.Level = field
+			}
+		}
+		arrays = append(arrays, array)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return arrays, nil
+}
+
+// ParentDisk returns the disk a partition belongs to, e.g. sda for sda3 and nvme0n1 for nvme0n1p2.
+// Names that are not partitions are returned unchanged.
+func ParentDisk(device string) string {
+	if !partitionSuffix.MatchString(device) {
+		return device
+	}
+	if strings.HasPrefix(device, "sd") {
+		return strings.TrimRight(device, "0123456789")
+	}
+	return device[:strings.LastIndex(device, "p")]
+}
@@ -0,0 +1,51 @@
+package hetznerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMDStat(t *testing.T) {
+	mdstat := `Personalities : [raid1] [linear] [multipath] [raid0] [raid6] [raid5] [raid4] [raid10]
+md2 : active raid1 sda3[0] sdb3[1]
+      1919301632 blocks super 1.2 [2/2] [UU]
+      bitmap: 2/15 pages [8KB], 65536KB chunk
+
+md1 : active raid1 nvme0n1p2[0] nvme1n1p2[1](F)
+      1046528 blocks super 1.2 [2/2] [UU]
+
+md127 : inactive sdc1[0](S)
+      33520640 blocks super 1.2
+
+unused devices: <none>`
+
+	arrays, err := ParseMDStat(mdstat)
+	assert.NoError(t, err)
+	assert.Equal(t, []MDArray{
+		{Name: "md2", State: "active", Level: "raid1", Devices: []string{"sda3", "sdb3"}},
+		{Name: "md1", State: "active", Level: "raid1", Devices: []string{"nvme0n1p2", "nvme1n1p2"}},
+		{Name: "md127", State: "inactive", Devices: []string{"sdc1"}},
+	}, arrays)
+}
+
+func TestParseMDStatNoArrays(t *testing.T) {
+	arrays, err := ParseMDStat("Personalities : \nunused devices: <none>\n")
+	assert.NoError(t, err)
+	assert.Empty(t, arrays)
+}
+
+func TestParentDisk(t *testing.T) {
+	tests := map[string]string{
+		"sda":       "sda",
+		"sda3":      "sda",
+		"sdb12":     "sdb",
+		"nvme0n1":   "nvme0n1",
+		"nvme0n1p2": "nvme0n1",
+		"mmcblk0p1": "mmcblk0",
+		"mmcblk0":   "mmcblk0",
+	}
+	for device, disk := range tests {
+		assert.Equal(t, disk, ParentDisk(device), device)
+	}
+}
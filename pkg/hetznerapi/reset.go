@@ -0,0 +1,92 @@
+package hetznerapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/sirupsen/logrus"
+)
+
+// Reset types of the Robot API
+const (
+	// ResetSoftware sends CTRL+ALT+DEL to the server
+	ResetSoftware = "sw"
+	// ResetHardware presses the reset button of the server
+	ResetHardware = "hw"
+	// ResetPower presses the power button of the server
+	ResetPower = "power"
+	// ResetPowerLong presses the power button of the server for 4 seconds, e.g. to power off a hanging server
+	ResetPowerLong = "power_long"
+	// ResetManual orders a technician to reset the server manually
+	ResetManual = "man"
+)
+
+// ResetTypes are the reset types known by the Robot API
+var ResetTypes = []string{ResetSoftware, ResetHardware, ResetPower, ResetPowerLong, ResetManual}
+
+type ResetDetails struct {
+	ServerIP        string   `json:"server_ip"`
+	ServerIPv6Net   string   `json:"server_ipv6_net"`
+	ServerNumber    int      `json:"server_number"`
+	Type            []string `json:"type"`
+	OperatingStatus string   `json:"operating_status"`
+}
+
+type Reset struct {
+	Reset ResetDetails `json:"reset"`
+}
+
+// Supports reports whether the server supports the reset type
+func (r *ResetDetails) Supports(resetType string) bool {
+	return slices.Contains(r.Type, resetType)
+}
+
+// GetResetTypes returns the reset types supported by the server
+func GetResetTypes(client robot.ClientInterface, serverNumber int) (*Reset, *robot.HTTPError) {
+	path := fmt.Sprintf("reset/%d", serverNumber)
+
+	body, err := client.Get(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var reset Reset
+	if err := json.Unmarshal(body, &reset); err != nil {
+		return nil, &robot.HTTPError{StatusCode: 0, Message: "failed to unmarshal response", Err: err}
+	}
+
+	return &reset, nil
+}
+
+// ResetServer resets the server using the reset type, see ResetTypes
+func ResetServer(client robot.ClientInterface, serverNumber int, resetType string) *robot.HTTPError {
+	if !slices.Contains(ResetTypes, resetType) {
+		return &robot.HTTPError{StatusCode: 0, Message: "invalid reset type", Err: fmt.Errorf("unknown reset type %q", resetType)}
+	}
+	path := fmt.Sprintf("reset/%d", serverNumber)
+
+	data := url.Values{}
+	data.Set("type", resetType)
+
+	_, err := client.Post(path, data)
+	if err != nil {
+		return err
+	}
+	logrus.WithField("type", resetType).Info("Server reset successfully initiated")
+	return nil
+}
+
+// WakeOnLAN sends a Wake-on-LAN packet to the server, e.g. to power on a server after a power_long reset
+func WakeOnLAN(client robot.ClientInterface, serverNumber int) *robot.HTTPError {
+	path := fmt.Sprintf("wol/%d", serverNumber)
+
+	_, err := client.Post(path, url.Values{})
+	if err != nil {
+		return err
+	}
+	logrus.Info("Wake-on-LAN packet sent")
+	return nil
+}
@@ -3,10 +3,8 @@ package hetznerapi
 import (
 	"encoding/json"
 	"fmt"
-	"net/url"
 
 	"github.com/eriklundjensen/thdctl/pkg/robot"
-	"github.com/sirupsen/logrus"
 )
 
 type Subnet struct {
@@ -46,12 +44,12 @@ func GetServerDetails(client robot.ClientInterface, serverNumber int) (*ServerDe
 		return nil, err
 	}
 
-	var serverDetails ServerDetails
-	if err := json.Unmarshal(body, &serverDetails); err != nil {
+	var server Server
+	if err := json.Unmarshal(body, &server); err != nil {
 		return nil, &robot.HTTPError{StatusCode: 0, Message: "failed to unmarshal response", Err: err}
 	}
 
-	return &serverDetails, nil
+	return &server.Server, nil
 }
 
 func ListServers(client robot.ClientInterface) ([]Server, *robot.HTTPError) {
@@ -70,16 +68,7 @@ func ListServers(client robot.ClientInterface) ([]Server, *robot.HTTPError) {
 	return servers, nil
 }
 
+// RebootServer resets the server by a hardware reset
 func RebootServer(client robot.ClientInterface, serverNumber int) *robot.HTTPError {
-	path := fmt.Sprintf("reset/%d", serverNumber)
-
-	data := url.Values{}
-	data.Set("type", "hw")
-
-	_, err := client.Post(path, data)
-	if err != nil {
-		return err
-	}
-	logrus.Info("Server reboot successfully initiated")
-	return nil
+	return ResetServer(client, serverNumber, ResetHardware)
 }
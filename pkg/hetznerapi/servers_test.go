@@ -0,0 +1,39 @@
+package hetznerapi
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRobotClient returns the same response to every request
+type fakeRobotClient struct {
+	response string
+	paths    []string
+}
+
+func (c *fakeRobotClient) Get(path string) ([]byte, *robot.HTTPError) {
+	c.paths = append(c.paths, path)
+	return []byte(c.response), nil
+}
+
+func (c *fakeRobotClient) Post(path string, values url.Values) ([]byte, *robot.HTTPError) {
+	c.paths = append(c.paths, path)
+	return []byte(c.response), nil
+}
+
+func TestGetServerDetails(t *testing.T) {
+	client := &fakeRobotClient{response: `{"server": {"server_ip": "192.0.2.10", "server_number": 123456, "server_name": "node1", "product": "EX44", "dc": "FSN1-DC8"}}`}
+
+	details, err := GetServerDetails(client, 123456)
+
+	require.Nil(t, err)
+	assert.Equal(t, []string{"server/123456"}, client.paths)
+	assert.Equal(t, 123456, details.ServerNumber)
+	assert.Equal(t, "node1", details.ServerName)
+	assert.Equal(t, "192.0.2.10", details.ServerIP)
+	assert.Equal(t, "EX44", details.Product)
+}
@@ -0,0 +1,100 @@
+package hetznerapi
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DiskHealth contains the SMART health information of a disk.
+type DiskHealth struct {
+	Disk               string `json:"disk"`
+	Passed             bool   `json:"passed"`
+	ReallocatedSectors int64  `json:"reallocatedSectors"`
+	MediaErrors        int64  `json:"mediaErrors"`
+	PercentageUsed     int64  `json:"percentageUsed"`
+}
+
+type smartctlAttribute struct {
+	ID    int   `json:"id"`
+	Value int64 `json:"value"`
+	Raw   struct {
+		Value int64 `json:"value"`
+	} `json:"raw"`
+}
+
+type smartctlOutput struct {
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	ATASmartAttributes struct {
+		Table []smartctlAttribute `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeSmartHealth *nvmeSmartLog `json:"nvme_smart_health_information_log"`
+}
+
+type nvmeSmartLog struct {
+	CriticalWarning int64 `json:"critical_warning"`
+	PercentUsed     int64 `json:"percent_used"`
+	PercentageUsed  int64 `json:"percentage_used"`
+	MediaErrors     int64 `json:"media_errors"`
+}
+
+// ATA SMART attribute IDs used for the health evaluation
+const (
+	ataReallocatedSectors    = 5
+	ataWearLevelingCount     = 177
+	ataReportedUncorrect     = 187
+	ataMediaWearoutIndicator = 233
+)
+
+// ParseSmartctlOutput parses the JSON output of `smartctl -j -H -A`.
+func ParseSmartctlOutput(disk, output string) (*DiskHealth, error) {
+	var smart smartctlOutput
+	if err := json.Unmarshal([]byte(output), &smart); err != nil {
+		return nil, fmt.Errorf("failed to parse smartctl output: %w", err)
+	}
+	if smart.SmartStatus == nil {
+		return nil, fmt.Errorf("smartctl did not report a SMART status for %s", disk)
+	}
+
+	health := &DiskHealth{Disk: disk, Passed: smart.SmartStatus.Passed}
+	if smart.NVMeSmartHealth != nil {
+		health.MediaErrors = smart.NVMeSmartHealth.MediaErrors
+		health.PercentageUsed = smart.NVMeSmartHealth.PercentageUsed
+		return health, nil
+	}
+
+	for _, attribute := range smart.ATASmartAttributes.Table {
+		switch attribute.ID {
+		case ataReallocatedSectors:
+			health.ReallocatedSectors = attribute.Raw.Value
+		case ataReportedUncorrect:
+			health.MediaErrors = attribute.Raw.Value
+		case ataWearLevelingCount, ataMediaWearoutIndicator:
+			// The normalized value starts at 100 for a new SSD and decreases with wear
+			if used := 100 - attribute.Value; used > health.PercentageUsed {
+				health.PercentageUsed = used
+			}
+		}
+	}
+	return health, nil
+}
+
+// ParseNVMeSmartLog parses the JSON output of `nvme smart-log -o json`.
+func ParseNVMeSmartLog(disk, output string) (*DiskHealth, error) {
+	var smartLog nvmeSmartLog
+	if err := json.Unmarshal([]byte(output), &smartLog); err != nil {
+		return nil, fmt.Errorf("failed to parse nvme smart-log output: %w", err)
+	}
+
+	percentageUsed := smartLog.PercentUsed
+	if smartLog.PercentageUsed > percentageUsed {
+		percentageUsed = smartLog.PercentageUsed
+	}
+	return &DiskHealth{
+		Disk:           disk,
+		Passed:         smartLog.CriticalWarning == 0,
+		MediaErrors:    smartLog.MediaErrors,
+		PercentageUsed: percentageUsed,
+	}, nil
+}
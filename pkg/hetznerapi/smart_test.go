@@ -0,0 +1,49 @@
+package hetznerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSmartctlOutputATA(t *testing.T) {
+	output := `{
+		"device": {"name": "/dev/sda", "type": "sat"},
+		"smart_status": {"passed": true},
+		"ata_smart_attributes": {
+			"table": [
+				{"id": 5, "name": "Reallocated_Sector_Ct", "value": 100, "raw": {"value": 8}},
+				{"id": 177, "name": "Wear_Leveling_Count", "value": 93, "raw": {"value": 71}},
+				{"id": 187, "name": "Reported_Uncorrect", "value": 100, "raw": {"value": 2}}
+			]
+		}
+	}`
+
+	health, err := ParseSmartctlOutput("sda", output)
+	assert.NoError(t, err)
+	assert.Equal(t, &DiskHealth{Disk: "sda", Passed: true, ReallocatedSectors: 8, MediaErrors: 2, PercentageUsed: 7}, health)
+}
+
+func TestParseSmartctlOutputNVMe(t *testing.T) {
+	output := `{
+		"smart_status": {"passed": false},
+		"nvme_smart_health_information_log": {"critical_warning": 4, "percentage_used": 102, "media_errors": 12}
+	}`
+
+	health, err := ParseSmartctlOutput("nvme0n1", output)
+	assert.NoError(t, err)
+	assert.Equal(t, &DiskHealth{Disk: "nvme0n1", Passed: false, MediaErrors: 12, PercentageUsed: 102}, health)
+}
+
+func TestParseSmartctlOutputMissingStatus(t *testing.T) {
+	_, err := ParseSmartctlOutput("sda", `{"smartctl": {"exit_status": 2}}`)
+	assert.Error(t, err)
+}
+
+func TestParseNVMeSmartLog(t *testing.T) {
+	output := `{"critical_warning": 0, "temperature": 310, "avail_spare": 100, "percent_used": 3, "media_errors": 0}`
+
+	health, err := ParseNVMeSmartLog("nvme1n1", output)
+	assert.NoError(t, err)
+	assert.Equal(t, &DiskHealth{Disk: "nvme1n1", Passed: true, PercentageUsed: 3}, health)
+}
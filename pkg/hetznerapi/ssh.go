@@ -2,10 +2,20 @@ package hetznerapi
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -13,20 +23,60 @@ type SSHClientInterface interface {
 	Auth(user, password string) error
 	EstablishSSHSession() error
 	ExecuteCommand(command string) (string, error)
+	UploadFile(path string, data []byte) (string, error)
 	ExecuteLSCommand() (string, error)
 
 	VerifyDiskExists(disk string) (string, error)
 	DownloadImage(url string) (string, error)
 	InstallImage(disk string) (string, error)
+	ReadPartitionTable(disk string) (string, error)
+	ImageSizeAndDigest() (string, error)
+	DiskDigest(disk string, size int64) (string, error)
 	ListDisks() (string, error)
+	WriteMetaPartition(partition string) (string, error)
+	WriteMachineConfig(partition string) (string, error)
+	ReadMDStat() (string, error)
+	StopRaidArray(array string) (string, error)
+	ZeroRaidSuperblock(device string) (string, error)
+	WipeDisk(device string) (string, error)
+	SmartHealth(disk string) (string, error)
+	NVMeSmartLog(disk string) (string, error)
 	WaitForReboot() bool
 	SetTargetHost(host, port string)
 }
 
+// SSHObserver receives the commands run by an SSHClient, e.g. to export metrics
+type SSHObserver interface {
+	ObserveCommand(command string, duration time.Duration, err error)
+	ObserveDownload(bytes int64)
+}
+
 type SSHClient struct {
 	Host, Port string
 	Session    *ssh.Session
 	Config     *ssh.ClientConfig
+	// Observer is optional
+	Observer SSHObserver
+	// ctx is the parent of the spans of the commands
+	ctx context.Context
+}
+
+var tracer = otel.Tracer("github.com/eriklundjensen/thdctl/pkg/hetznerapi")
+
+// Credentials and queries of URLs, e.g. tokens of an image download
+var (
+	urlCredentials = regexp.MustCompile(`(https?://)[^/\s@]*@`)
+	urlQuery       = regexp.MustCompile(`(https?://[^\s?']*)\?[^\s']*`)
+)
+
+// SanitizeCommand removes credentials and queries of URLs from a command so it can be logged and traced
+func SanitizeCommand(command string) string {
+	return urlQuery.ReplaceAllString(urlCredentials.ReplaceAllString(command, "$1"), "$1")
+}
+
+// SetContext sets the parent of the spans of the following commands
+func (client *SSHClient) SetContext(ctx context.Context) {
+	client.ctx = ctx
 }
 
 func (client *SSHClient) Auth(user, password string) error {
@@ -56,28 +106,78 @@ func (client *SSHClient) EstablishSSHSession() error {
 }
 
 func (client *SSHClient) ExecuteCommand(command string) (string, error) {
+	return client.executeCommand(command, nil)
+}
+
+// UploadFile writes data to the given path on the target host
+func (client *SSHClient) UploadFile(path string, data []byte) (string, error) {
+	return client.executeCommand(fmt.Sprintf("cat > %s", path), bytes.NewReader(data))
+}
+
+func (client *SSHClient) executeCommand(command string, stdin io.Reader) (string, error) {
 	var b bytes.Buffer
 	if client.Session == nil {
 		return "", fmt.Errorf("session is not established")
 	}
 
 	client.EstablishSSHSession()
+	client.Session.Stdin = stdin
 	client.Session.Stdout = &b
 	defer client.Session.Close()
 
-	if err := client.Session.Run(command); err != nil {
+	ctx := client.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := tracer.Start(ctx, "SSH "+CommandName(command), trace.WithAttributes(
+		attribute.String("ssh.command", SanitizeCommand(command)),
+		attribute.String("server.address", client.Host),
+	))
+	defer span.End()
+
+	start := time.Now()
+	err := client.Session.Run(command)
+	if client.Observer != nil {
+		client.Observer.ObserveCommand(command, time.Since(start), err)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return "", fmt.Errorf("failed to run command: %w", err)
 	}
 	return b.String(), nil
 }
 
+// ShellQuote quotes a value as a single shell word, e.g. a URL passed to a command
+func ShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// CommandName returns the program of a command without its path
+func CommandName(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return ""
+	}
+	return path.Base(fields[0])
+}
+
 func (client *SSHClient) ExecuteLSCommand() (string, error) {
 	return client.ExecuteCommand("ls")
 }
 
 func (client *SSHClient) DownloadImage(url string) (string, error) {
-	download := fmt.Sprintf("wget -O /tmp/talos.raw.xz %s", url)
-	return client.ExecuteCommand(download)
+	download := fmt.Sprintf("wget -O /tmp/talos.raw.xz %s", ShellQuote(url))
+	output, err := client.ExecuteCommand(download)
+	if err != nil || client.Observer == nil {
+		return output, err
+	}
+	if size, err := client.ExecuteCommand("stat -c %s /tmp/talos.raw.xz"); err == nil {
+		if bytes, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64); err == nil {
+			client.Observer.ObserveDownload(bytes)
+		}
+	}
+	return output, nil
 }
 
 func (client *SSHClient) ListDisks() (string, error) {
@@ -93,6 +193,69 @@ func (client *SSHClient) InstallImage(disk string) (string, error) {
 	return client.ExecuteCommand(unpack)
 }
 
+func (client *SSHClient) ReadPartitionTable(disk string) (string, error) {
+	return client.ExecuteCommand(fmt.Sprintf("sfdisk --json /dev/%s", disk))
+}
+
+// ImageSizeAndDigest decompresses the image once and prints its size in bytes followed by its sha256sum.
+// tee feeds the size count through a fifo, wait makes sure the digest is complete before it is printed.
+func (client *SSHClient) ImageSizeAndDigest() (string, error) {
+	if output, err := client.ExecuteCommand("rm -f /tmp/talos.fifo && mkfifo /tmp/talos.fifo"); err != nil {
+		return output, err
+	}
+	return client.ExecuteCommand("zstdcat -dc /tmp/talos.raw.xz | tee /tmp/talos.fifo | sha256sum >/tmp/talos.sha256 & " +
+		"wc -c </tmp/talos.fifo && wait $! && cat /tmp/talos.sha256")
+}
+
+// DiskDigest returns the sha256sum of the first size bytes written to the disk
+func (client *SSHClient) DiskDigest(disk string, size int64) (string, error) {
+	return client.ExecuteCommand(fmt.Sprintf("head -c %d /dev/%s | sha256sum", size, disk))
+}
+
+// Paths used for files uploaded to the rescue system
+const (
+	MetaImagePath     = "/tmp/talos-meta.bin"
+	MachineConfigPath = "/tmp/talos-config.yaml"
+)
+
+// WriteMetaPartition writes the uploaded META image to the META partition, e.g. /dev/sda4
+func (client *SSHClient) WriteMetaPartition(partition string) (string, error) {
+	return client.ExecuteCommand(fmt.Sprintf("dd if=%s of=%s bs=4096 conv=notrunc,fsync", MetaImagePath, partition))
+}
+
+// WriteMachineConfig copies the uploaded machine config to the STATE partition, e.g. /dev/sda5
+func (client *SSHClient) WriteMachineConfig(partition string) (string, error) {
+	return client.ExecuteCommand(fmt.Sprintf(
+		"mkdir -p /mnt/talos-state && mount %s /mnt/talos-state && cp %s /mnt/talos-state/config.yaml; status=$?; umount /mnt/talos-state; exit $status",
+		partition, MachineConfigPath))
+}
+
+func (client *SSHClient) ReadMDStat() (string, error) {
+	return client.ExecuteCommand("cat /proc/mdstat")
+}
+
+func (client *SSHClient) StopRaidArray(array string) (string, error) {
+	return client.ExecuteCommand(fmt.Sprintf("mdadm --stop /dev/%s", array))
+}
+
+func (client *SSHClient) ZeroRaidSuperblock(device string) (string, error) {
+	return client.ExecuteCommand(fmt.Sprintf("mdadm --zero-superblock /dev/%s", device))
+}
+
+func (client *SSHClient) WipeDisk(device string) (string, error) {
+	return client.ExecuteCommand(fmt.Sprintf("wipefs -a /dev/%s", device))
+}
+
+// SmartHealth returns the SMART health and attributes as JSON. smartctl uses the exit code as a bit mask
+// reporting disk problems, hence the exit code is ignored and the JSON output is evaluated instead.
+func (client *SSHClient) SmartHealth(disk string) (string, error) {
+	return client.ExecuteCommand(fmt.Sprintf("smartctl -j -H -A /dev/%s || true", disk))
+}
+
+func (client *SSHClient) NVMeSmartLog(disk string) (string, error) {
+	return client.ExecuteCommand(fmt.Sprintf("nvme smart-log -o json /dev/%s", disk))
+}
+
 func (client *SSHClient) WaitForReboot() bool {
 	maxRetries := 10
 	retryInterval := 10 * time.Second
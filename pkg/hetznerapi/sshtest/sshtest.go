@@ -0,0 +1,123 @@
+// Package sshtest provides a mock of the SSH client of the rescue system for tests.
+package sshtest
+
+import (
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockClient is a testify mock of hetznerapi.SSHClientInterface
+type MockClient struct {
+	mock.Mock
+}
+
+var _ hetznerapi.SSHClientInterface = (*MockClient)(nil)
+
+func (m *MockClient) Auth(user, password string) error {
+	args := m.Called(user, password)
+	return args.Error(0)
+}
+
+func (m *MockClient) EstablishSSHSession() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockClient) ExecuteCommand(command string) (string, error) {
+	args := m.Called(command)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) ExecuteLSCommand() (string, error) {
+	args := m.Called()
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) VerifyDiskExists(disk string) (string, error) {
+	args := m.Called(disk)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) DownloadImage(url string) (string, error) {
+	args := m.Called(url)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) InstallImage(disk string) (string, error) {
+	args := m.Called(disk)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) ReadPartitionTable(disk string) (string, error) {
+	args := m.Called(disk)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) ImageSizeAndDigest() (string, error) {
+	args := m.Called()
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) DiskDigest(disk string, size int64) (string, error) {
+	args := m.Called(disk, size)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) ListDisks() (string, error) {
+	args := m.Called()
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) UploadFile(path string, data []byte) (string, error) {
+	args := m.Called(path, data)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) WriteMetaPartition(partition string) (string, error) {
+	args := m.Called(partition)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) WriteMachineConfig(partition string) (string, error) {
+	args := m.Called(partition)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) ReadMDStat() (string, error) {
+	args := m.Called()
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) StopRaidArray(array string) (string, error) {
+	args := m.Called(array)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) ZeroRaidSuperblock(device string) (string, error) {
+	args := m.Called(device)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) WipeDisk(device string) (string, error) {
+	args := m.Called(device)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) SmartHealth(disk string) (string, error) {
+	args := m.Called(disk)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) NVMeSmartLog(disk string) (string, error) {
+	args := m.Called(disk)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) WaitForReboot() bool {
+	args := m.Called()
+	return args.Bool(0)
+}
+
+func (m *MockClient) SetTargetHost(host, port string) {
+	m.Called(host, port)
+}
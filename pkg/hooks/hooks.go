@@ -0,0 +1,255 @@
+// Package hooks notifies about state transitions of servers by running local commands
+// or posting JSON payloads to webhooks, e.g. a chat notification when an installation fails.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eriklundjensen/thdctl/pkg/api/manifest"
+	"github.com/eriklundjensen/thdctl/pkg/controller"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultTimeout is the time a hook may take before it is cancelled
+const DefaultTimeout = 30 * time.Second
+
+// Hook is run on transitions to the states in On
+type Hook struct {
+	Name string `json:"name,omitempty"`
+	// On are the target states triggering the hook, e.g. Failed or TalosAPIAvailable. All transitions when empty.
+	On []controller.ServerStatus `json:"on,omitempty"`
+	// Command is run with sh -c. The payload is written to stdin and the transition is set in THDCTL_* variables.
+	Command string `json:"command,omitempty"`
+	// Webhook is the URL the payload is posted to
+	Webhook string `json:"webhook,omitempty"`
+	// Headers are added to the webhook request, e.g. Authorization
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Config is the hooks file
+type Config struct {
+	Hooks []Hook `json:"hooks"`
+}
+
+// Payload is the JSON document sent to a hook
+type Payload struct {
+	controller.Transition
+	// Text is a human readable summary, chat webhooks like Slack and Mattermost show it as message
+	Text string `json:"text"`
+}
+
+// Load reads and validates a hooks file
+func Load(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading hooks: %v", err)
+	}
+	var config Config
+	if err := manifest.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filename, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", filename, err)
+	}
+	return &config, nil
+}
+
+// Validate checks that each hook has either a command or a webhook and triggers on known states
+func (c *Config) Validate() error {
+	states := append(controller.States(), controller.Failed)
+	for i, hook := range c.Hooks {
+		name := hook.Name
+		if name == "" {
+			name = "hooks[" + strconv.Itoa(i) + "]"
+		}
+		if (hook.Command == "") == (hook.Webhook == "") {
+			return fmt.Errorf("%s: either command or webhook must be set", name)
+		}
+		if hook.Webhook != "" {
+			u, err := url.Parse(hook.Webhook)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return fmt.Errorf("%s: webhook must be a http or https URL", name)
+			}
+		}
+		for _, state := range hook.On {
+			if !slices.Contains(states, state) {
+				return fmt.Errorf("%s: unknown state %s", name, state)
+			}
+		}
+	}
+	return nil
+}
+
+// queueSize is the number of transitions waiting for their hooks, further transitions are dropped
+const queueSize = 100
+
+// StopTimeout is the time Stop waits for the queued hooks before it cancels them
+const StopTimeout = time.Minute
+
+// Runner runs the hooks of transitions on a goroutine, state machines do not wait for slow hooks
+type Runner struct {
+	config *Config
+	queue  chan controller.Transition
+	done   chan struct{}
+	// ctx is cancelled by Stop, hooks keep running when the command is interrupted to report the interruption
+	ctx         context.Context
+	cancel      context.CancelFunc
+	stopTimeout time.Duration
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+// Start runs the hooks of the transitions published to the subscriber of the runner until Stop is called.
+// Hooks run one after another and are cancelled after DefaultTimeout, failing hooks are logged.
+func (c *Config) Start() *Runner {
+	r := &Runner{
+		config:      c,
+		queue:       make(chan controller.Transition, queueSize),
+		done:        make(chan struct{}),
+		stopTimeout: StopTimeout,
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	go r.run()
+	return r
+}
+
+// Subscriber returns a subscriber queueing the transitions for the hooks matching them
+func (r *Runner) Subscriber() controller.Subscriber {
+	return func(transition controller.Transition) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.stopped {
+			return
+		}
+		select {
+		case r.queue <- transition:
+		default:
+			logrus.WithFields(logrus.Fields{
+				"server": transition.ServerNumber,
+				"to":     transition.To,
+			}).Warn("Too many pending hooks, skipping the hooks of the transition")
+		}
+	}
+}
+
+// Stop waits up to StopTimeout for the hooks of the queued transitions and cancels the remaining hooks.
+// Later transitions are ignored.
+func (r *Runner) Stop() {
+	r.mu.Lock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+	defer r.cancel()
+
+	timer := time.NewTimer(r.stopTimeout)
+	defer timer.Stop()
+	select {
+	case <-r.done:
+	case <-timer.C:
+		logrus.WithField("timeout", r.stopTimeout).Warn("Hooks did not complete in time, cancelling them")
+		r.cancel()
+		<-r.done
+	}
+}
+
+func (r *Runner) run() {
+	defer close(r.done)
+	for transition := range r.queue {
+		for _, hook := range r.config.Hooks {
+			if !hook.matches(transition) {
+				continue
+			}
+			log := logrus.WithFields(logrus.Fields{
+				"hook":   hook.Name,
+				"server": transition.ServerNumber,
+				"to":     transition.To,
+			})
+			ctx, cancel := context.WithTimeout(r.ctx, DefaultTimeout)
+			if err := hook.Run(ctx, transition); err != nil {
+				log.WithError(err).Error("Hook failed")
+			} else {
+				log.Debug("Hook completed")
+			}
+			cancel()
+		}
+	}
+}
+
+func (h Hook) matches(transition controller.Transition) bool {
+	return len(h.On) == 0 || slices.Contains(h.On, transition.To)
+}
+
+// Run runs the command or posts to the webhook of the hook
+func (h Hook) Run(ctx context.Context, transition controller.Transition) error {
+	data, err := json.Marshal(Payload{Transition: transition, Text: summary(transition)})
+	if err != nil {
+		return err
+	}
+	if h.Command != "" {
+		return runCommand(ctx, h.Command, transition, data)
+	}
+	return postWebhook(ctx, h.Webhook, h.Headers, data)
+}
+
+func summary(transition controller.Transition) string {
+	text := fmt.Sprintf("Server %d: %s -> %s", transition.ServerNumber, transition.From, transition.To)
+	if transition.Reason != "" {
+		text += " (" + transition.Reason + ")"
+	}
+	if transition.Error != "" {
+		text += ": " + transition.Error
+	}
+	return text
+}
+
+func runCommand(ctx context.Context, command string, transition controller.Transition, payload []byte) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	// children of the shell may keep the output open after the shell is killed
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		"THDCTL_SERVER="+strconv.Itoa(transition.ServerNumber),
+		"THDCTL_FROM="+transition.From.String(),
+		"THDCTL_TO="+transition.To.String(),
+		"THDCTL_REASON="+transition.Reason,
+		"THDCTL_ERROR="+transition.Error,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("command failed: %v: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+func postWebhook(ctx context.Context, webhook string, headers map[string]string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
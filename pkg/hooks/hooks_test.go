@@ -0,0 +1,165 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eriklundjensen/thdctl/pkg/controller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var failed = controller.Transition{
+	ServerNumber: 321,
+	From:         controller.WaitForReboot,
+	To:           controller.Failed,
+	Time:         time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC),
+	Reason:       controller.ReasonDeadlineExceeded,
+	Error:        "server did not come back",
+}
+
+func TestLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "hooks.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(`
+hooks:
+- name: chat
+  on: [Failed, TalosAPIAvailable]
+  webhook: https://chat.example.com/hooks/abc
+  headers:
+    Authorization: Bearer token
+- command: logger -t thdctl "$THDCTL_TO"
+`), 0600))
+
+	config, err := Load(filename)
+	require.NoError(t, err)
+	require.Len(t, config.Hooks, 2)
+	assert.Equal(t, []controller.ServerStatus{controller.Failed, controller.TalosAPIAvailable}, config.Hooks[0].On)
+	assert.Equal(t, "Bearer token", config.Hooks[0].Headers["Authorization"])
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		hook Hook
+		err  string
+	}{
+		"both":          {Hook{Command: "true", Webhook: "https://example.com"}, "hooks[0]: either command or webhook must be set"},
+		"none":          {Hook{Name: "empty"}, "empty: either command or webhook must be set"},
+		"invalid URL":   {Hook{Webhook: "example.com/hook"}, "hooks[0]: webhook must be a http or https URL"},
+		"unknown state": {Hook{Command: "true", On: []controller.ServerStatus{"Installed"}}, "hooks[0]: unknown state Installed"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := Config{Hooks: []Hook{tt.hook}}
+			assert.EqualError(t, config.Validate(), tt.err)
+		})
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var payload Payload
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+	}))
+	defer server.Close()
+
+	hook := Hook{Webhook: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}}
+	require.NoError(t, hook.Run(context.Background(), failed))
+
+	assert.Equal(t, "Bearer token", authorization)
+	assert.Equal(t, failed, payload.Transition)
+	assert.Equal(t, "Server 321: WaitForReboot -> Failed (DeadlineExceeded): server did not come back", payload.Text)
+}
+
+func TestWebhookError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	err := Hook{Webhook: server.URL}.Run(context.Background(), failed)
+	assert.EqualError(t, err, "webhook returned 403 Forbidden")
+}
+
+func TestCommand(t *testing.T) {
+	dir := t.TempDir()
+	hook := Hook{Command: `cat > payload.json && echo "$THDCTL_SERVER $THDCTL_FROM $THDCTL_TO $THDCTL_REASON" > env`}
+	hook.Command = "cd " + dir + " && " + hook.Command
+	require.NoError(t, hook.Run(context.Background(), failed))
+
+	env, err := os.ReadFile(filepath.Join(dir, "env"))
+	require.NoError(t, err)
+	assert.Equal(t, "321 WaitForReboot Failed DeadlineExceeded\n", string(env))
+
+	data, err := os.ReadFile(filepath.Join(dir, "payload.json"))
+	require.NoError(t, err)
+	var payload Payload
+	require.NoError(t, json.Unmarshal(data, &payload))
+	assert.Equal(t, failed, payload.Transition)
+}
+
+func TestCommandError(t *testing.T) {
+	err := Hook{Command: "echo broken >&2; exit 3"}.Run(context.Background(), failed)
+	assert.EqualError(t, err, "command failed: exit status 3: broken")
+}
+
+func TestSubscriberRunsMatchingHooks(t *testing.T) {
+	var received []controller.ServerStatus
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload Payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		received = append(received, payload.To)
+	}))
+	defer server.Close()
+
+	config := Config{Hooks: []Hook{
+		{Webhook: server.URL, On: []controller.ServerStatus{controller.Failed}},
+		{Webhook: server.URL},
+		// failing hooks are logged and do not stop the following hooks
+		{Command: "exit 1"},
+	}}
+	runner := config.Start()
+	subscriber := runner.Subscriber()
+	subscriber(controller.Transition{From: controller.SSHAvailable, To: controller.TalosImageInstalled})
+	subscriber(failed)
+	runner.Stop()
+	// transitions after Stop are ignored
+	subscriber(failed)
+
+	assert.Equal(t, []controller.ServerStatus{controller.TalosImageInstalled, controller.Failed, controller.Failed}, received)
+}
+
+func TestSubscriberDoesNotWaitForHooks(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	config := Config{Hooks: []Hook{{Webhook: server.URL}}}
+	runner := config.Start()
+	subscriber := runner.Subscriber()
+	subscriber(failed)
+	subscriber(failed)
+	close(release)
+	runner.Stop()
+}
+
+func TestStopCancelsHooksAfterTimeout(t *testing.T) {
+	config := Config{Hooks: []Hook{{Command: "sleep 20"}}}
+	runner := config.Start()
+	runner.stopTimeout = 10 * time.Millisecond
+	start := time.Now()
+	runner.Subscriber()(failed)
+	runner.Stop()
+
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
@@ -0,0 +1,144 @@
+// Package kubeconfig reads the admin kubeconfig of a Talos cluster and checks the Kubernetes API.
+package kubeconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Kubeconfig is the part of a kubeconfig file needed to reach the Kubernetes API
+type Kubeconfig struct {
+	CurrentContext string         `json:"current-context"`
+	Clusters       []NamedCluster `json:"clusters"`
+	Contexts       []NamedContext `json:"contexts"`
+	Users          []NamedUser    `json:"users"`
+}
+
+type NamedCluster struct {
+	Name    string `json:"name"`
+	Cluster struct {
+		Server                   string `json:"server"`
+		CertificateAuthorityData string `json:"certificate-authority-data"`
+	} `json:"cluster"`
+}
+
+type NamedContext struct {
+	Name    string `json:"name"`
+	Context struct {
+		Cluster string `json:"cluster"`
+		User    string `json:"user"`
+	} `json:"context"`
+}
+
+type NamedUser struct {
+	Name string `json:"name"`
+	User struct {
+		ClientCertificateData string `json:"client-certificate-data"`
+		ClientKeyData         string `json:"client-key-data"`
+	} `json:"user"`
+}
+
+// Parse decodes a kubeconfig
+func Parse(data []byte) (*Kubeconfig, error) {
+	var config Kubeconfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %w", err)
+	}
+	return &config, nil
+}
+
+// Endpoint returns the API server URL and TLS configuration of the current context
+func (k *Kubeconfig) Endpoint() (string, *tls.Config, error) {
+	var context *NamedContext
+	for i := range k.Contexts {
+		if k.Contexts[i].Name == k.CurrentContext {
+			context = &k.Contexts[i]
+		}
+	}
+	if context == nil {
+		return "", nil, fmt.Errorf("context %q not found in kubeconfig", k.CurrentContext)
+	}
+
+	var cluster *NamedCluster
+	for i := range k.Clusters {
+		if k.Clusters[i].Name == context.Context.Cluster {
+			cluster = &k.Clusters[i]
+		}
+	}
+	if cluster == nil {
+		return "", nil, fmt.Errorf("cluster %q not found in kubeconfig", context.Context.Cluster)
+	}
+
+	var user *NamedUser
+	for i := range k.Users {
+		if k.Users[i].Name == context.Context.User {
+			user = &k.Users[i]
+		}
+	}
+	if user == nil {
+		return "", nil, fmt.Errorf("user %q not found in kubeconfig", context.Context.User)
+	}
+
+	ca, err := base64.StdEncoding.DecodeString(cluster.Cluster.CertificateAuthorityData)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode certificate authority of cluster %q: %w", cluster.Name, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return "", nil, fmt.Errorf("invalid certificate authority of cluster %q", cluster.Name)
+	}
+	crt, err := base64.StdEncoding.DecodeString(user.User.ClientCertificateData)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode client certificate of user %q: %w", user.Name, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(user.User.ClientKeyData)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode client key of user %q: %w", user.Name, err)
+	}
+	certificate, err := tls.X509KeyPair(crt, key)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid client certificate of user %q: %w", user.Name, err)
+	}
+
+	return cluster.Cluster.Server, &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{certificate},
+	}, nil
+}
+
+// Ready returns nil when the /readyz endpoint of the Kubernetes API reports ok
+func Ready(ctx context.Context, data []byte) error {
+	config, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	server, tlsConfig, err := config.Endpoint()
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(server, "/")+"/readyz", nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("Kubernetes API not reachable: %w", err)
+	}
+	defer response.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Kubernetes API not ready: %s %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
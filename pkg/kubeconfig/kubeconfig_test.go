@@ -0,0 +1,94 @@
+package kubeconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clientCertificate returns a PEM encoded self-signed client certificate and key
+func clientCertificate(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "admin"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func testKubeconfig(t *testing.T, server *httptest.Server) []byte {
+	t.Helper()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	crt, key := clientCertificate(t)
+	return []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+users:
+- name: admin@test
+  user:
+    client-certificate-data: %s
+    client-key-data: %s
+contexts:
+- name: admin@test
+  context:
+    cluster: test
+    user: admin@test
+current-context: admin@test
+`, server.URL, base64.StdEncoding.EncodeToString(ca), base64.StdEncoding.EncodeToString(crt), base64.StdEncoding.EncodeToString(key)))
+}
+
+func TestReady(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/readyz", r.URL.Path)
+		assert.Len(t, r.TLS.PeerCertificates, 1)
+		w.WriteHeader(status)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	kubeconfig := testKubeconfig(t, server)
+
+	assert.ErrorContains(t, Ready(context.Background(), kubeconfig), "not ready")
+
+	status = http.StatusOK
+	assert.NoError(t, Ready(context.Background(), kubeconfig))
+}
+
+func TestEndpointMissingContext(t *testing.T) {
+	config, err := Parse([]byte("current-context: missing\n"))
+	require.NoError(t, err)
+
+	_, _, err = config.Endpoint()
+
+	assert.ErrorContains(t, err, `context "missing" not found`)
+}
@@ -0,0 +1,167 @@
+// Package metrics exports Prometheus metrics of the state machines, the Robot API requests and the SSH commands
+// run in the rescue system.
+package metrics
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eriklundjensen/thdctl/pkg/controller"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "thdctl"
+
+// Metrics are the collectors of thdctl. Subscriber, InstrumentRobot and the SSHObserver methods feed them.
+type Metrics struct {
+	serverState         *prometheus.GaugeVec
+	transitions         *prometheus.CounterVec
+	stateDuration       *prometheus.HistogramVec
+	robotRequests       *prometheus.CounterVec
+	robotRequestLatency *prometheus.HistogramVec
+	sshCommandDuration  *prometheus.HistogramVec
+	imageDownloadBytes  prometheus.Counter
+
+	mu sync.Mutex
+	// entered is the time servers entered their current state
+	entered map[int]time.Time
+}
+
+// New creates the collectors, use Register to export them
+func New() *Metrics {
+	return &Metrics{
+		serverState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "server_state",
+			Help:      "Current state of a server, 1 for the state the server is in.",
+		}, []string{"server", "state"}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "state_transitions_total",
+			Help:      "Number of state transitions.",
+		}, []string{"from", "to"}),
+		stateDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "state_duration_seconds",
+			Help:      "Time servers spent in a state before the next transition.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		}, []string{"state"}),
+		robotRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "robot_requests_total",
+			Help:      "Number of Robot API requests by endpoint and HTTP status code, code is 0 when no response was received.",
+		}, []string{"method", "endpoint", "code"}),
+		robotRequestLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "robot_request_duration_seconds",
+			Help:      "Latency of Robot API requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "endpoint"}),
+		sshCommandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "ssh_command_duration_seconds",
+			Help:      "Duration of the commands run in the rescue system by program name.",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 14),
+		}, []string{"command", "result"}),
+		imageDownloadBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "image_download_bytes_total",
+			Help:      "Bytes of the Talos images downloaded in the rescue system.",
+		}),
+		entered: map[int]time.Time{},
+	}
+}
+
+// Register registers the collectors, e.g. with the registry of the controller-runtime metrics endpoint
+func (m *Metrics) Register(registerer prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{
+		m.serverState, m.transitions, m.stateDuration, m.robotRequests, m.robotRequestLatency,
+		m.sshCommandDuration, m.imageDownloadBytes,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscriber records the transitions of state machines
+func (m *Metrics) Subscriber() controller.Subscriber {
+	return func(transition controller.Transition) {
+		server := strconv.Itoa(transition.ServerNumber)
+		m.transitions.WithLabelValues(transition.From.String(), transition.To.String()).Inc()
+		m.serverState.DeletePartialMatch(prometheus.Labels{"server": server})
+		m.serverState.WithLabelValues(server, transition.To.String()).Set(1)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		// the time in the first state of a run is unknown
+		if entered, ok := m.entered[transition.ServerNumber]; ok {
+			m.stateDuration.WithLabelValues(transition.From.String()).Observe(transition.Time.Sub(entered).Seconds())
+		}
+		m.entered[transition.ServerNumber] = transition.Time
+	}
+}
+
+// ObserveCommand records the duration of an SSH command. Only the program name is used as label,
+// arguments may contain passwords and URLs.
+func (m *Metrics) ObserveCommand(command string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.sshCommandDuration.WithLabelValues(hetznerapi.CommandName(command), result).Observe(duration.Seconds())
+}
+
+// ObserveDownload records the size of a downloaded image
+func (m *Metrics) ObserveDownload(bytes int64) {
+	m.imageDownloadBytes.Add(float64(bytes))
+}
+
+// InstrumentRobot returns a client recording the requests of client
+func (m *Metrics) InstrumentRobot(client robot.ClientInterface) robot.ClientInterface {
+	return &instrumentedClient{client: client, metrics: m}
+}
+
+type instrumentedClient struct {
+	client  robot.ClientInterface
+	metrics *Metrics
+}
+
+func (c *instrumentedClient) Get(path string) ([]byte, *robot.HTTPError) {
+	start := time.Now()
+	body, err := c.client.Get(path)
+	c.metrics.observeRequest("GET", path, time.Since(start), err)
+	return body, err
+}
+
+func (c *instrumentedClient) Post(path string, values url.Values) ([]byte, *robot.HTTPError) {
+	start := time.Now()
+	body, err := c.client.Post(path, values)
+	c.metrics.observeRequest("POST", path, time.Since(start), err)
+	return body, err
+}
+
+func (m *Metrics) observeRequest(method, path string, duration time.Duration, err *robot.HTTPError) {
+	endpoint := endpointName(path)
+	code := "200"
+	if err != nil {
+		code = strconv.Itoa(err.StatusCode)
+	}
+	m.robotRequests.WithLabelValues(method, endpoint, code).Inc()
+	m.robotRequestLatency.WithLabelValues(method, endpoint).Observe(duration.Seconds())
+}
+
+// endpointName returns the first segment of a Robot API path, e.g. boot for boot/123456/rescue.
+// Server numbers and IP addresses are not used as labels.
+func endpointName(path string) string {
+	endpoint, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return endpoint
+}
+
+var _ hetznerapi.SSHObserver = &Metrics{}
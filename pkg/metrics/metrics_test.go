@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/eriklundjensen/thdctl/pkg/controller"
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRobotClient struct {
+	err *robot.HTTPError
+}
+
+func (c *fakeRobotClient) Get(path string) ([]byte, *robot.HTTPError) { return []byte("{}"), c.err }
+
+func (c *fakeRobotClient) Post(path string, values url.Values) ([]byte, *robot.HTTPError) {
+	return []byte("{}"), c.err
+}
+
+// scrape returns the metrics served by the /metrics handler
+func scrape(t *testing.T, m *Metrics) string {
+	registry := prometheus.NewRegistry()
+	require.NoError(t, m.Register(registry))
+	recorder := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestTransitions(t *testing.T) {
+	m := New()
+	subscriber := m.Subscriber()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	subscriber(controller.Transition{ServerNumber: 42, From: controller.Uninitialized, To: controller.RescueModeInitiated, Time: start})
+	subscriber(controller.Transition{ServerNumber: 42, From: controller.RescueModeInitiated, To: controller.WaitForReboot, Time: start.Add(3 * time.Second)})
+
+	body := scrape(t, m)
+
+	assert.Contains(t, body, `thdctl_server_state{server="42",state="WaitForReboot"} 1`)
+	assert.NotContains(t, body, `thdctl_server_state{server="42",state="RescueModeInitiated"}`)
+	assert.Contains(t, body, `thdctl_state_transitions_total{from="Uninitialized",to="RescueModeInitiated"} 1`)
+	assert.Contains(t, body, `thdctl_state_transitions_total{from="RescueModeInitiated",to="WaitForReboot"} 1`)
+	assert.Contains(t, body, `thdctl_state_duration_seconds_sum{state="RescueModeInitiated"} 3`)
+	assert.Contains(t, body, `thdctl_state_duration_seconds_count{state="RescueModeInitiated"} 1`)
+}
+
+func TestRobotRequests(t *testing.T) {
+	m := New()
+	client := &fakeRobotClient{}
+	instrumented := m.InstrumentRobot(client)
+	instrumented.Get("boot/42/rescue")
+	instrumented.Post("reset/42", url.Values{"type": {"hw"}})
+	client.err = &robot.HTTPError{StatusCode: 404}
+	instrumented.Get("server/42")
+
+	body := scrape(t, m)
+
+	assert.Contains(t, body, `thdctl_robot_requests_total{code="200",endpoint="boot",method="GET"} 1`)
+	assert.Contains(t, body, `thdctl_robot_requests_total{code="200",endpoint="reset",method="POST"} 1`)
+	assert.Contains(t, body, `thdctl_robot_requests_total{code="404",endpoint="server",method="GET"} 1`)
+	assert.Contains(t, body, `thdctl_robot_request_duration_seconds_count{endpoint="boot",method="GET"} 1`)
+}
+
+func TestSSHCommands(t *testing.T) {
+	m := New()
+	m.ObserveCommand("wget -O /tmp/talos.raw.xz https://factory.talos.dev/image.raw.xz", 2*time.Second, nil)
+	m.ObserveCommand("/usr/sbin/smartctl -j -H -A /dev/sda", time.Second, errors.New("exit status 2"))
+	m.ObserveDownload(1024)
+	m.ObserveDownload(2048)
+
+	body := scrape(t, m)
+
+	assert.Contains(t, body, `thdctl_ssh_command_duration_seconds_sum{command="wget",result="success"} 2`)
+	assert.Contains(t, body, `thdctl_ssh_command_duration_seconds_count{command="smartctl",result="error"} 1`)
+	assert.NotContains(t, body, "factory.talos.dev")
+	assert.Contains(t, body, `thdctl_image_download_bytes_total 3072`)
+}
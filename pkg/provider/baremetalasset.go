@@ -0,0 +1,195 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	baremetalassetv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/baremetalasset/v1alpha"
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/validation"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Keys of the Secrets referenced by a BareMetalAsset
+const (
+	// NetworkConfigKey is the key of the network configuration in the talosNetwork Secrets
+	NetworkConfigKey = "network.yaml"
+	// TalosconfigKey is the key of the talosconfig in the talosConfig Secrets,
+	// the machine configs use the key <role>.yaml, e.g. controlplane.yaml
+	TalosconfigKey = "talosconfig"
+)
+
+// Condition reasons of a BareMetalAsset
+const (
+	ReasonWaitingForImage = "WaitingForImage"
+	ReasonConfigError     = "ConfigError"
+)
+
+// BareMetalAssetReconciler installs the servers of BareMetalAsset resources using the install flow of a Server.
+// The asset is mapped onto the server parameters: the BMC address is the server number, the root device hints
+// select the disk, the image is the Talos image and the role selects the machine config of the talosConfig Secrets.
+type BareMetalAssetReconciler struct {
+	// ServerReconciler provides the clients, state machine and checkpoints of the runs
+	ServerReconciler
+	// ConfigDir is the directory the configs of the referenced Secrets are written to
+	ConfigDir string
+}
+
+// SetupWithManager registers the reconciler with a manager
+func (r *BareMetalAssetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&baremetalassetv1alpha1.BareMetalAsset{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(crcontroller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r)
+}
+
+// Reconcile installs the server of an asset once the image is set and writes the observed state
+func (r *BareMetalAssetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var asset baremetalassetv1alpha1.BareMetalAsset
+	if err := r.Client.Get(ctx, req.NamespacedName, &asset); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	log := logrus.WithFields(logrus.Fields{
+		"resource": req.NamespacedName.String(),
+		"bmc":      asset.Spec.BMC.Address,
+	})
+	status := &asset.Status
+
+	if err := validation.ValidateBareMetalAsset(&asset).ToAggregate(); err != nil {
+		log.WithError(err).Error("Invalid asset spec")
+		setConditions(&status.Conditions, asset.Generation, status.State, ReasonInvalidSpec, err)
+		return ctrl.Result{}, r.updateStatus(ctx, &asset)
+	}
+	if asset.Spec.Image == "" {
+		log.Info("Image is not set, asset is not provisioned")
+		setConditions(&status.Conditions, asset.Generation, status.State, ReasonWaitingForImage, nil)
+		markUnavailable(&status.Conditions, asset.Generation, "image is not set")
+		return ctrl.Result{}, r.updateStatus(ctx, &asset)
+	}
+
+	robotClient, err := r.robotClient(ctx, asset.Namespace, &v1alpha1.SecretReference{Name: asset.Spec.BMC.CredentialsName})
+	if err != nil {
+		log.WithError(err).Error("Failed to read Robot credentials")
+		return ctrl.Result{}, r.fail(ctx, &asset, ReasonCredentialsError, err)
+	}
+	parameters, err := r.ServerParameters(ctx, &asset)
+	if err != nil {
+		log.WithError(err).Error("Failed to map asset onto server parameters")
+		return ctrl.Result{}, r.fail(ctx, &asset, ReasonConfigError, err)
+	}
+
+	log = log.WithField("server", parameters.ServerNumber)
+	log.Info("Reconcile asset")
+	serverStatus, runErr := r.run(ctx, robotClient, parameters, v1alpha1.ServerStatus{State: status.State})
+	if errors.Is(runErr, errResume) {
+		return ctrl.Result{}, runErr
+	}
+	status.State = serverStatus.State
+	status.LastError = serverStatus.LastError
+	status.Provisioned = runErr == nil
+	reason := ReasonReconcileSuccess
+	if runErr != nil {
+		log.WithError(runErr).Error("Failed to reconcile asset")
+		reason = ReasonReconcileError
+	}
+	setConditions(&status.Conditions, asset.Generation, status.State, reason, runErr)
+	if err := r.updateStatus(ctx, &asset); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.Resync}, nil
+}
+
+// fail writes the conditions of an error and returns the error, so the asset is reconciled again with a backoff
+func (r *BareMetalAssetReconciler) fail(ctx context.Context, asset *baremetalassetv1alpha1.BareMetalAsset, reason string, err error) error {
+	setConditions(&asset.Status.Conditions, asset.Generation, asset.Status.State, reason, err)
+	if updateErr := r.updateStatus(ctx, asset); updateErr != nil {
+		logrus.WithError(updateErr).Error("Failed to write status")
+	}
+	return err
+}
+
+// ServerParameters maps an asset onto the parameters of a server.
+// The configs of the referenced Secrets are written to a directory of the asset in ConfigDir.
+func (r *BareMetalAssetReconciler) ServerParameters(ctx context.Context, asset *baremetalassetv1alpha1.BareMetalAsset) (*v1alpha1.ServerParameters, error) {
+	spec := asset.Spec
+	serverNumber, err := spec.BMC.ServerNumber()
+	if err != nil {
+		return nil, err
+	}
+	parameters := &v1alpha1.ServerParameters{
+		ServerNumber: serverNumber,
+		Disk:         spec.RootDeviceHints.DeviceName,
+		TalosImage:   spec.Image,
+	}
+	dir := filepath.Join(r.ConfigDir, asset.Namespace, asset.Name)
+
+	for _, network := range spec.TalosNetwork {
+		data, err := r.secretValue(ctx, asset.Namespace, []string{network.ConfigRef}, NetworkConfigKey)
+		if err != nil {
+			return nil, err
+		}
+		file, err := writeConfig(dir, NetworkConfigKey, data)
+		if err != nil {
+			return nil, err
+		}
+		parameters.FirstBoot = &v1alpha1.FirstBootConfig{NetworkConfigFile: file}
+	}
+
+	if len(spec.TalosConfig) > 0 {
+		names := make([]string, 0, len(spec.TalosConfig))
+		for _, config := range spec.TalosConfig {
+			names = append(names, config.SecretRef)
+		}
+		machineConfigKey := string(spec.Role) + ".yaml"
+		data, err := r.secretValue(ctx, asset.Namespace, names, machineConfigKey)
+		if err != nil {
+			return nil, err
+		}
+		if parameters.MachineConfig, err = writeConfig(dir, machineConfigKey, data); err != nil {
+			return nil, err
+		}
+		// the talosconfig is optional, without it the state machine stops after applying the machine config
+		if data, err := r.secretValue(ctx, asset.Namespace, names, TalosconfigKey); err == nil {
+			if parameters.Talosconfig, err = writeConfig(dir, TalosconfigKey, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return parameters, nil
+}
+
+// secretValue returns the value of key of the first Secret containing it
+func (r *BareMetalAssetReconciler) secretValue(ctx context.Context, namespace string, names []string, key string) ([]byte, error) {
+	for _, name := range names {
+		var secret corev1.Secret
+		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &secret); err != nil {
+			return nil, fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+		}
+		if data, ok := secret.Data[key]; ok {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("key %s not found in secrets %v", key, names)
+}
+
+// writeConfig writes a config only readable by the manager and returns the file name
+func writeConfig(dir, name string, data []byte) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return file, nil
+}
@@ -0,0 +1,153 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	baremetalassetv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/baremetalasset/v1alpha"
+	clusterv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/cluster/v1alpha"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const talosImage = "https://factory.talos.dev/image/376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba/v1.9.2/metal-amd64.raw.zst"
+
+func newAsset() *baremetalassetv1alpha1.BareMetalAsset {
+	return &baremetalassetv1alpha1.BareMetalAsset{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Namespace: "default", Generation: 1},
+		Spec: baremetalassetv1alpha1.BareMetalAssetSpec{
+			BMC:             baremetalassetv1alpha1.BMCDetails{Address: "hetzner://321", CredentialsName: "robot"},
+			BootMACAddress:  "00:1B:44:11:3A:B7",
+			RootDeviceHints: &baremetalassetv1alpha1.RootDeviceHints{DeviceName: "nvme0n1"},
+			Role:            clusterv1alpha1.ControlPlane,
+			ClusterName:     "demo-1",
+			Image:           talosImage,
+			TalosNetwork:    []baremetalassetv1alpha1.ConfigReference{{ConfigRef: "network"}},
+			TalosConfig:     []baremetalassetv1alpha1.SecretReference{{SecretRef: "demo-1-talosconfig"}, {SecretRef: "demo-1-configs"}},
+		},
+	}
+}
+
+func newConfigSecrets() []client.Object {
+	return []client.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "network", Namespace: "default"},
+			Data:       map[string][]byte{NetworkConfigKey: []byte("addresses: []")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "demo-1-talosconfig", Namespace: "default"},
+			Data:       map[string][]byte{TalosconfigKey: []byte("context: demo-1")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "demo-1-configs", Namespace: "default"},
+			Data: map[string][]byte{
+				"controlplane.yaml": []byte("machine:\n  type: controlplane"),
+				"worker.yaml":       []byte("machine:\n  type: worker"),
+			},
+		},
+	}
+}
+
+func newAssetReconciler(t *testing.T, sm *fakeStateMachine, objects ...client.Object) (*BareMetalAssetReconciler, client.Client) {
+	r, c := newReconciler(t, sm, objects...)
+	return &BareMetalAssetReconciler{ServerReconciler: *r, ConfigDir: t.TempDir()}, c
+}
+
+func getAsset(t *testing.T, c client.Client) *baremetalassetv1alpha1.BareMetalAsset {
+	var asset baremetalassetv1alpha1.BareMetalAsset
+	require.NoError(t, c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "node-1"}, &asset))
+	return &asset
+}
+
+func readConfig(t *testing.T, file string) string {
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestReconcileBareMetalAsset(t *testing.T) {
+	sm := &fakeStateMachine{state: "WaitingForBootstrap"}
+	objects := append(newConfigSecrets(), newAsset(), newSecret())
+	r, c := newAssetReconciler(t, sm, objects...)
+
+	_, err := runReconcile(t, r)
+
+	require.NoError(t, err)
+	require.NotNil(t, sm.server)
+	assert.Equal(t, 321, sm.server.ServerNumber)
+	assert.Equal(t, "nvme0n1", sm.server.Disk)
+	assert.Equal(t, talosImage, sm.server.TalosImage)
+	dir := filepath.Join(r.ConfigDir, "default", "node-1")
+	assert.Equal(t, filepath.Join(dir, "controlplane.yaml"), sm.server.MachineConfig)
+	assert.Equal(t, "machine:\n  type: controlplane", readConfig(t, sm.server.MachineConfig))
+	assert.Equal(t, "context: demo-1", readConfig(t, sm.server.Talosconfig))
+	require.NotNil(t, sm.server.FirstBoot)
+	assert.Equal(t, "addresses: []", readConfig(t, sm.server.FirstBoot.NetworkConfigFile))
+
+	asset := getAsset(t, c)
+	assert.True(t, asset.Status.Provisioned)
+	assert.Equal(t, "WaitingForBootstrap", asset.Status.State)
+	assert.True(t, apimeta.IsStatusConditionTrue(asset.Status.Conditions, ConditionReady))
+}
+
+func TestReconcileBareMetalAssetWorker(t *testing.T) {
+	asset := newAsset()
+	asset.Spec.Role = clusterv1alpha1.Worker
+	asset.Spec.TalosNetwork = nil
+	sm := &fakeStateMachine{state: "WaitingForBootstrap"}
+	r, _ := newAssetReconciler(t, sm, append(newConfigSecrets(), asset, newSecret())...)
+
+	_, err := runReconcile(t, r)
+
+	require.NoError(t, err)
+	assert.Equal(t, "machine:\n  type: worker", readConfig(t, sm.server.MachineConfig))
+	assert.Nil(t, sm.server.FirstBoot)
+}
+
+func TestReconcileBareMetalAssetWithoutImage(t *testing.T) {
+	asset := newAsset()
+	asset.Spec.Image = ""
+	sm := &fakeStateMachine{}
+	r, c := newAssetReconciler(t, sm, asset, newSecret())
+
+	result, err := runReconcile(t, r)
+
+	require.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter)
+	assert.Nil(t, sm.server)
+	conditions := getAsset(t, c).Status.Conditions
+	assert.Equal(t, ReasonWaitingForImage, apimeta.FindStatusCondition(conditions, ConditionSynced).Reason)
+	ready := apimeta.FindStatusCondition(conditions, ConditionReady)
+	require.NotNil(t, ready)
+	assert.Equal(t, metav1.ConditionFalse, ready.Status)
+	assert.Equal(t, "image is not set", ready.Message)
+}
+
+func TestReconcileBareMetalAssetMissingMachineConfig(t *testing.T) {
+	sm := &fakeStateMachine{}
+	r, c := newAssetReconciler(t, sm, append(newConfigSecrets()[:2], newAsset(), newSecret())...)
+
+	_, err := runReconcile(t, r)
+
+	assert.ErrorContains(t, err, "failed to get secret default/demo-1-configs")
+	assert.Nil(t, sm.server)
+	synced := apimeta.FindStatusCondition(getAsset(t, c).Status.Conditions, ConditionSynced)
+	require.NotNil(t, synced)
+	assert.Equal(t, ReasonConfigError, synced.Reason)
+}
+
+func TestBMCServerNumber(t *testing.T) {
+	serverNumber, err := baremetalassetv1alpha1.BMCDetails{Address: "hetzner://123456"}.ServerNumber()
+	require.NoError(t, err)
+	assert.Equal(t, 123456, serverNumber)
+
+	_, err = baremetalassetv1alpha1.BMCDetails{Address: "ipmi://10.0.0.1:623"}.ServerNumber()
+	assert.ErrorContains(t, err, "scheme must be hetzner")
+}
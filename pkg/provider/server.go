@@ -0,0 +1,263 @@
+// Package provider reconciles Server resources of a Kubernetes cluster with the state machine of the controller
+// package, similar to a crossplane provider. The observed status and the Ready and Synced conditions are written
+// to the status of the resources.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/controller"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/eriklundjensen/thdctl/pkg/metrics"
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/eriklundjensen/thdctl/pkg/validation"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Condition types of a server
+const (
+	// ConditionReady is true when the last run of the state machine reached the desired state
+	ConditionReady = "Ready"
+	// ConditionSynced is true when the spec was reconciled without errors
+	ConditionSynced = "Synced"
+)
+
+// Condition reasons of a server
+const (
+	ReasonAvailable        = "Available"
+	ReasonUnavailable      = "Unavailable"
+	ReasonReconcileSuccess = "ReconcileSuccess"
+	ReasonReconcileError   = "ReconcileError"
+	ReasonInvalidSpec      = "InvalidSpec"
+	ReasonCredentialsError = "CredentialsError"
+)
+
+// Keys of the credentials Secret
+const (
+	UsernameKey = "username"
+	PasswordKey = "password"
+)
+
+// StateMachine runs the installation of a server, it is implemented by controller.StateMachine
+type StateMachine interface {
+	SetStatus(status v1alpha1.ServerStatus)
+	Resume(store controller.CheckpointStore) error
+	Run(ctx context.Context) error
+	Status() v1alpha1.ServerStatus
+	Subscribe(subscriber controller.Subscriber)
+}
+
+// ServerReconciler runs the state machine of a Server resource whenever its spec changes and on every resync.
+// A run blocks a worker until the server reached its desired state or failed, use MaxConcurrentReconciles to
+// install several servers at the same time.
+type ServerReconciler struct {
+	Client client.Client
+	// NewRobotClient creates a Robot client using the credentials of the Secret of a server
+	NewRobotClient func(username, password string) robot.ClientInterface
+	// NewSSHClient creates the SSH client of a run
+	NewSSHClient func() hetznerapi.SSHClientInterface
+	// NewStateMachine creates the state machine of a run, controller.NewStateMachine when nil
+	NewStateMachine func(client robot.ClientInterface, sshClient hetznerapi.SSHClientInterface, server *v1alpha1.ServerParameters) StateMachine
+	// Checkpoints persists the progress of the runs, runs can not be resumed when nil
+	Checkpoints controller.CheckpointStore
+	// Subscribers receive the state transitions of all servers, e.g. the hooks
+	Subscribers []controller.Subscriber
+	// Resync is the interval servers are reconciled at when their spec does not change
+	Resync time.Duration
+	// MaxConcurrentReconciles is the number of servers reconciled at the same time
+	MaxConcurrentReconciles int
+}
+
+// SetupWithManager registers the reconciler with a manager.
+// Status updates do not change the generation of a server and therefore do not trigger a reconcile.
+func (r *ServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.Server{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(crcontroller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r)
+}
+
+// Reconcile runs the state machine of a server and writes the observed status
+func (r *ServerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var server v1alpha1.Server
+	if err := r.Client.Get(ctx, req.NamespacedName, &server); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	parameters := &server.Spec.ForProvider
+	log := logrus.WithFields(logrus.Fields{
+		"resource": req.NamespacedName.String(),
+		"server":   parameters.ServerNumber,
+	})
+
+	if err := validation.ValidateServer(&server).ToAggregate(); err != nil {
+		// the spec is not reconciled again before it changes
+		log.WithError(err).Error("Invalid server spec")
+		setConditions(&server.Status.Conditions, server.Generation, server.Status.State, ReasonInvalidSpec, err)
+		return ctrl.Result{}, r.updateStatus(ctx, &server)
+	}
+
+	robotClient, err := r.robotClient(ctx, server.Namespace, server.Spec.CredentialsSecretRef)
+	if err != nil {
+		log.WithError(err).Error("Failed to read Robot credentials")
+		setConditions(&server.Status.Conditions, server.Generation, server.Status.State, ReasonCredentialsError, err)
+		if updateErr := r.updateStatus(ctx, &server); updateErr != nil {
+			log.WithError(updateErr).Error("Failed to write status")
+		}
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Reconcile server")
+	status, runErr := r.run(ctx, robotClient, parameters, server.Status)
+	if errors.Is(runErr, errResume) {
+		return ctrl.Result{}, runErr
+	}
+	server.Status = status
+	reason := ReasonReconcileSuccess
+	if runErr != nil {
+		log.WithError(runErr).Error("Failed to reconcile server")
+		reason = ReasonReconcileError
+	}
+	setConditions(&server.Status.Conditions, server.Generation, server.Status.State, reason, runErr)
+	if err := r.updateStatus(ctx, &server); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.Resync}, nil
+}
+
+// errResume is returned by run when the checkpoint of the server can not be loaded
+var errResume = errors.New("failed to resume from checkpoint")
+
+// run runs the state machine of a server. Fields of the previous status not observed by the run are kept.
+func (r *ServerReconciler) run(ctx context.Context, client robot.ClientInterface, parameters *v1alpha1.ServerParameters, previous v1alpha1.ServerStatus) (v1alpha1.ServerStatus, error) {
+	sm := r.newStateMachine(client, parameters)
+	sm.SetStatus(previous)
+	if r.Checkpoints != nil {
+		if err := sm.Resume(r.Checkpoints); err != nil {
+			return previous, fmt.Errorf("%w: %v", errResume, err)
+		}
+	}
+	err := sm.Run(ctx)
+
+	status := sm.Status()
+	if details, err := hetznerapi.GetServerDetails(client, parameters.ServerNumber); err == nil {
+		status.Details = *details
+	}
+	return status, err
+}
+
+func (r *ServerReconciler) newStateMachine(client robot.ClientInterface, server *v1alpha1.ServerParameters) StateMachine {
+	sshClient := r.NewSSHClient()
+	var sm StateMachine
+	if r.NewStateMachine != nil {
+		sm = r.NewStateMachine(client, sshClient, server)
+	} else {
+		sm = controller.NewStateMachine(client, sshClient, server, 5)
+	}
+	for _, subscriber := range r.Subscribers {
+		sm.Subscribe(subscriber)
+	}
+	return sm
+}
+
+// robotClient creates a Robot client with the credentials of a Secret. namespace is used when ref has no namespace.
+func (r *ServerReconciler) robotClient(ctx context.Context, namespace string, ref *v1alpha1.SecretReference) (robot.ClientInterface, error) {
+	if ref == nil {
+		return nil, fmt.Errorf("spec.credentialsSecretRef is required")
+	}
+	key := types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+	if key.Namespace == "" {
+		key.Namespace = namespace
+	}
+
+	var secret corev1.Secret
+	if err := r.Client.Get(ctx, key, &secret); err != nil {
+		return nil, fmt.Errorf("failed to get secret %s: %w", key, err)
+	}
+	username, password := string(secret.Data[UsernameKey]), string(secret.Data[PasswordKey])
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("secret %s must contain the keys %s and %s", key, UsernameKey, PasswordKey)
+	}
+	return r.NewRobotClient(username, password), nil
+}
+
+// setConditions sets the Ready and Synced conditions. A resource is ready when the spec was reconciled without error.
+func setConditions(conditions *[]metav1.Condition, generation int64, state string, reason string, err error) {
+	synced := metav1.Condition{
+		Type:               ConditionSynced,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		ObservedGeneration: generation,
+	}
+	ready := metav1.Condition{
+		Type:               ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonAvailable,
+		Message:            fmt.Sprintf("server is in state %s", state),
+		ObservedGeneration: generation,
+	}
+	if err != nil {
+		synced.Status = metav1.ConditionFalse
+		synced.Message = err.Error()
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = ReasonUnavailable
+	}
+	if state == "" {
+		ready.Message = "state of the server is unknown"
+	}
+	apimeta.SetStatusCondition(conditions, synced)
+	apimeta.SetStatusCondition(conditions, ready)
+}
+
+// markUnavailable sets the Ready condition to false
+func markUnavailable(conditions *[]metav1.Condition, generation int64, message string) {
+	apimeta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               ConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonUnavailable,
+		Message:            message,
+		ObservedGeneration: generation,
+	})
+}
+
+func (r *ServerReconciler) updateStatus(ctx context.Context, obj client.Object) error {
+	if err := r.Client.Status().Update(ctx, obj); err != nil {
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+	return nil
+}
+
+// RateLimitedClients returns a factory of Robot clients. Servers using the same credentials share a client
+// and therefore the request limit of the Robot user. The requests are recorded in m when it is not nil.
+func RateLimitedClients(requestsPerSecond float64, burst int, m *metrics.Metrics) func(username, password string) robot.ClientInterface {
+	var mu sync.Mutex
+	clients := map[robot.Client]robot.ClientInterface{}
+	return func(username, password string) robot.ClientInterface {
+		mu.Lock()
+		defer mu.Unlock()
+		credentials := robot.Client{Username: username, Password: password}
+		if client, ok := clients[credentials]; ok {
+			return client
+		}
+		var instrumented robot.ClientInterface = credentials
+		if m != nil {
+			instrumented = m.InstrumentRobot(credentials)
+		}
+		client := robot.NewRateLimitedClient(instrumented, requestsPerSecond, burst)
+		clients[credentials] = client
+		return client
+	}
+}
@@ -0,0 +1,222 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	baremetalassetv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/baremetalasset/v1alpha"
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/checkpoint"
+	"github.com/eriklundjensen/thdctl/pkg/controller"
+	"github.com/eriklundjensen/thdctl/pkg/hetznerapi"
+	"github.com/eriklundjensen/thdctl/pkg/robot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type fakeRobotClient struct {
+	username string
+}
+
+func (c *fakeRobotClient) Get(path string) ([]byte, *robot.HTTPError) {
+	return []byte(`{"server": {"server_number": 321, "server_name": "node-1", "server_ip": "192.0.2.1"}}`), nil
+}
+
+func (c *fakeRobotClient) Post(path string, values url.Values) ([]byte, *robot.HTTPError) {
+	return nil, &robot.HTTPError{StatusCode: 404, Message: "not found"}
+}
+
+type memoryStore struct{}
+
+func (s *memoryStore) Load(serverNumber int) (*checkpoint.Checkpoint, error) { return nil, nil }
+
+func (s *memoryStore) Save(checkpoint *checkpoint.Checkpoint) error { return nil }
+
+type fakeStateMachine struct {
+	server      *v1alpha1.ServerParameters
+	status      v1alpha1.ServerStatus
+	state       string
+	err         error
+	resumed     bool
+	subscribers []controller.Subscriber
+}
+
+func (sm *fakeStateMachine) SetStatus(status v1alpha1.ServerStatus) { sm.status = status }
+
+func (sm *fakeStateMachine) Resume(store controller.CheckpointStore) error {
+	sm.resumed = true
+	return nil
+}
+
+func (sm *fakeStateMachine) Run(ctx context.Context) error {
+	if sm.err != nil {
+		sm.status.LastError = sm.err.Error()
+	}
+	return sm.err
+}
+
+func (sm *fakeStateMachine) Subscribe(subscriber controller.Subscriber) {
+	sm.subscribers = append(sm.subscribers, subscriber)
+}
+
+func (sm *fakeStateMachine) Status() v1alpha1.ServerStatus {
+	status := sm.status
+	status.State = sm.state
+	return status
+}
+
+func newServer() *v1alpha1.Server {
+	return &v1alpha1.Server{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Namespace: "default", Generation: 2},
+		Spec: v1alpha1.ServerSpec{
+			ForProvider: v1alpha1.ServerParameters{
+				ServerNumber: 321,
+				Disk:         "sda",
+				TalosVersion: "v1.9.2",
+			},
+			CredentialsSecretRef: &v1alpha1.SecretReference{Name: "robot"},
+		},
+	}
+}
+
+func newSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "robot", Namespace: "default"},
+		Data:       map[string][]byte{UsernameKey: []byte("user"), PasswordKey: []byte("secret")},
+	}
+}
+
+func newReconciler(t *testing.T, sm *fakeStateMachine, objects ...client.Object) (*ServerReconciler, client.Client) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	require.NoError(t, baremetalassetv1alpha1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objects...).
+		WithStatusSubresource(&v1alpha1.Server{}, &baremetalassetv1alpha1.BareMetalAsset{}).
+		Build()
+	return &ServerReconciler{
+		Client:         c,
+		NewRobotClient: func(username, password string) robot.ClientInterface { return &fakeRobotClient{username: username} },
+		NewSSHClient:   func() hetznerapi.SSHClientInterface { return nil },
+		NewStateMachine: func(client robot.ClientInterface, sshClient hetznerapi.SSHClientInterface, server *v1alpha1.ServerParameters) StateMachine {
+			assert.Equal(t, "user", client.(*fakeRobotClient).username)
+			sm.server = server
+			return sm
+		},
+		Checkpoints: &memoryStore{},
+		Resync:      10 * time.Minute,
+	}, c
+}
+
+func runReconcile(t *testing.T, r reconcile.Reconciler) (ctrl.Result, error) {
+	return r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "node-1"}})
+}
+
+func getServer(t *testing.T, c client.Client) *v1alpha1.Server {
+	var server v1alpha1.Server
+	require.NoError(t, c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "node-1"}, &server))
+	return &server
+}
+
+func TestReconcileWritesStatusAndConditions(t *testing.T) {
+	sm := &fakeStateMachine{state: "KubernetesAvailable"}
+	r, c := newReconciler(t, sm, newServer(), newSecret())
+	r.Subscribers = []controller.Subscriber{func(controller.Transition) {}}
+
+	result, err := runReconcile(t, r)
+
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, result.RequeueAfter)
+	assert.True(t, sm.resumed)
+	assert.Len(t, sm.subscribers, 1)
+	server := getServer(t, c)
+	assert.Equal(t, "KubernetesAvailable", server.Status.State)
+	assert.Equal(t, "node-1", server.Status.Details.ServerName)
+	ready := apimeta.FindStatusCondition(server.Status.Conditions, ConditionReady)
+	require.NotNil(t, ready)
+	assert.Equal(t, metav1.ConditionTrue, ready.Status)
+	assert.Equal(t, ReasonAvailable, ready.Reason)
+	assert.Equal(t, int64(2), ready.ObservedGeneration)
+	synced := apimeta.FindStatusCondition(server.Status.Conditions, ConditionSynced)
+	require.NotNil(t, synced)
+	assert.Equal(t, metav1.ConditionTrue, synced.Status)
+}
+
+func TestReconcileFailedRun(t *testing.T) {
+	sm := &fakeStateMachine{state: "RescueMode", err: errors.New("max retries reached")}
+	r, c := newReconciler(t, sm, newServer(), newSecret())
+
+	result, err := runReconcile(t, r)
+
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, result.RequeueAfter)
+	server := getServer(t, c)
+	assert.Equal(t, "max retries reached", server.Status.LastError)
+	assert.True(t, apimeta.IsStatusConditionFalse(server.Status.Conditions, ConditionReady))
+	synced := apimeta.FindStatusCondition(server.Status.Conditions, ConditionSynced)
+	require.NotNil(t, synced)
+	assert.Equal(t, metav1.ConditionFalse, synced.Status)
+	assert.Equal(t, ReasonReconcileError, synced.Reason)
+	assert.Equal(t, "max retries reached", synced.Message)
+}
+
+func TestReconcileMissingSecret(t *testing.T) {
+	sm := &fakeStateMachine{state: "KubernetesAvailable"}
+	r, c := newReconciler(t, sm, newServer())
+
+	_, err := runReconcile(t, r)
+
+	assert.ErrorContains(t, err, "failed to get secret default/robot")
+	synced := apimeta.FindStatusCondition(getServer(t, c).Status.Conditions, ConditionSynced)
+	require.NotNil(t, synced)
+	assert.Equal(t, ReasonCredentialsError, synced.Reason)
+	assert.False(t, sm.resumed)
+}
+
+func TestReconcileInvalidSpec(t *testing.T) {
+	server := newServer()
+	server.Spec.ForProvider.Disk = "/dev/sda"
+	sm := &fakeStateMachine{state: "KubernetesAvailable"}
+	r, c := newReconciler(t, sm, server, newSecret())
+
+	result, err := runReconcile(t, r)
+
+	require.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter)
+	synced := apimeta.FindStatusCondition(getServer(t, c).Status.Conditions, ConditionSynced)
+	require.NotNil(t, synced)
+	assert.Equal(t, ReasonInvalidSpec, synced.Reason)
+	assert.Contains(t, synced.Message, "spec.forProvider.disk")
+	assert.False(t, sm.resumed)
+}
+
+func TestReconcileDeletedServer(t *testing.T) {
+	r, _ := newReconciler(t, &fakeStateMachine{})
+
+	result, err := runReconcile(t, r)
+
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+}
+
+func TestRateLimitedClientsShareClientPerUser(t *testing.T) {
+	clients := RateLimitedClients(1, 5, nil)
+
+	assert.Same(t, clients("user", "secret"), clients("user", "secret"))
+	assert.NotSame(t, clients("user", "secret"), clients("other", "secret"))
+}
@@ -1,6 +1,7 @@
 package robot
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -18,6 +19,12 @@ type ClientInterface interface {
 	Post(path string, values url.Values) ([]byte, *HTTPError)
 }
 
+// ContextClient is a client whose requests stop waiting when the context is cancelled, e.g. for the rate limit
+type ContextClient interface {
+	GetContext(ctx context.Context, path string) ([]byte, *HTTPError)
+	PostContext(ctx context.Context, path string, values url.Values) ([]byte, *HTTPError)
+}
+
 type Client struct {
 	Username string
 	Password string
@@ -0,0 +1,47 @@
+package robot
+
+import (
+	"context"
+	"net/url"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitedClient limits the rate of requests of a client shared by concurrent reconciles.
+// The Robot API blocks users exceeding the request limits of an endpoint for some time.
+type RateLimitedClient struct {
+	client  ClientInterface
+	limiter *rate.Limiter
+}
+
+// NewRateLimitedClient allows requestsPerSecond requests on average with bursts of burst requests
+func NewRateLimitedClient(client ClientInterface, requestsPerSecond float64, burst int) *RateLimitedClient {
+	return &RateLimitedClient{
+		client:  client,
+		limiter: rate.NewLimiter(rate.Limit(requestsPerSecond), burst),
+	}
+}
+
+func (c *RateLimitedClient) Get(path string) ([]byte, *HTTPError) {
+	return c.GetContext(context.Background(), path)
+}
+
+func (c *RateLimitedClient) Post(path string, values url.Values) ([]byte, *HTTPError) {
+	return c.PostContext(context.Background(), path, values)
+}
+
+// GetContext waits for the rate limit until ctx is cancelled
+func (c *RateLimitedClient) GetContext(ctx context.Context, path string) ([]byte, *HTTPError) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, &HTTPError{0, "rate limit exceeded", err}
+	}
+	return c.client.Get(path)
+}
+
+// PostContext waits for the rate limit until ctx is cancelled
+func (c *RateLimitedClient) PostContext(ctx context.Context, path string, values url.Values) ([]byte, *HTTPError) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, &HTTPError{0, "rate limit exceeded", err}
+	}
+	return c.client.Post(path, values)
+}
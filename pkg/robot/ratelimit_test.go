@@ -0,0 +1,51 @@
+package robot
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingClient struct {
+	requests int
+}
+
+func (c *countingClient) Get(path string) ([]byte, *HTTPError) {
+	c.requests++
+	return nil, nil
+}
+
+func (c *countingClient) Post(path string, values url.Values) ([]byte, *HTTPError) {
+	c.requests++
+	return nil, nil
+}
+
+func TestRateLimitedClient(t *testing.T) {
+	counting := &countingClient{}
+	client := NewRateLimitedClient(counting, 20, 2)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		client.Get("server")
+	}
+
+	assert.Equal(t, 4, counting.requests)
+	// the burst is used by the first two requests, the others wait 50ms each
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
+
+func TestRateLimitedClientIsCancelled(t *testing.T) {
+	counting := &countingClient{}
+	client := NewRateLimitedClient(counting, 0.001, 1)
+	client.Get("server")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.GetContext(ctx, "server")
+
+	assert.ErrorIs(t, err.Err, context.Canceled)
+	assert.Equal(t, 1, counting.requests)
+}
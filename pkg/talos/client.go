@@ -0,0 +1,306 @@
+package talos
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// APIPort is the port of the Talos API
+const APIPort = "50000"
+
+// ApplyMode defines how a machine config is applied (machine.ApplyConfigurationRequest.Mode)
+type ApplyMode int
+
+const (
+	ApplyModeReboot ApplyMode = iota
+	ApplyModeAuto
+	ApplyModeNoReboot
+	ApplyModeStaged
+)
+
+// Client is the part of the Talos machine API used by thdctl
+type Client interface {
+	// ApplyConfiguration applies a machine config to the node
+	ApplyConfiguration(ctx context.Context, config []byte, mode ApplyMode) error
+	// Version returns the Talos version running on the node
+	Version(ctx context.Context) (string, error)
+	// Bootstrap bootstraps etcd on the node
+	Bootstrap(ctx context.Context) error
+	// ServiceList returns the state of the Talos services
+	ServiceList(ctx context.Context) ([]Service, error)
+	// Kubeconfig returns the admin kubeconfig of the cluster
+	Kubeconfig(ctx context.Context) ([]byte, error)
+	// Upgrade upgrades Talos on the node using an installer image and reboots the node
+	Upgrade(ctx context.Context, image string) error
+	// Reset wipes the Talos installation. A graceful reset cordons and drains the node and leaves etcd first.
+	Reset(ctx context.Context, graceful, reboot bool) error
+	Close() error
+}
+
+// Service is the state of a Talos service, e.g. etcd or kubelet
+type Service struct {
+	ID      string
+	State   string
+	Healthy bool
+}
+
+// Connector creates Talos API clients for a node
+type Connector interface {
+	// Insecure connects to the maintenance mode API of a node without machine config
+	Insecure(endpoint string) (Client, error)
+	// Secure connects to a configured node using the credentials of the talosconfig
+	Secure(endpoint string) (Client, error)
+}
+
+// GRPCConnector creates gRPC clients. TalosconfigFile is required for secure connections.
+type GRPCConnector struct {
+	TalosconfigFile string
+}
+
+func (c *GRPCConnector) Insecure(endpoint string) (Client, error) {
+	return NewGRPCClient(endpoint, &tls.Config{InsecureSkipVerify: true})
+}
+
+func (c *GRPCConnector) Secure(endpoint string) (Client, error) {
+	if c.TalosconfigFile == "" {
+		return nil, fmt.Errorf("talosconfig is required to connect to a configured node")
+	}
+	config, err := ReadTalosconfig(c.TalosconfigFile)
+	if err != nil {
+		return nil, err
+	}
+	current, err := config.CurrentContext()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := current.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewGRPCClient(endpoint, tlsConfig)
+}
+
+// GRPCClient calls the Talos machine API of a single node
+type GRPCClient struct {
+	conn *grpc.ClientConn
+}
+
+// NewGRPCClient creates a client for the endpoint. The Talos API port is used if the endpoint has no port.
+func NewGRPCClient(endpoint string, tlsConfig *tls.Config) (*GRPCClient, error) {
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		endpoint = net.JoinHostPort(endpoint, APIPort)
+	}
+	conn, err := grpc.NewClient(endpoint,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{})),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Talos API client for %s: %w", endpoint, err)
+	}
+	return &GRPCClient{conn: conn}, nil
+}
+
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+func (c *GRPCClient) invoke(ctx context.Context, method string, request []byte) ([]byte, error) {
+	req := rawMessage(request)
+	var resp rawMessage
+	if err := c.conn.Invoke(ctx, "/machine.MachineService/"+method, &req, &resp); err != nil {
+		return nil, fmt.Errorf("%s failed: %w", method, err)
+	}
+	return resp, nil
+}
+
+func (c *GRPCClient) ApplyConfiguration(ctx context.Context, config []byte, mode ApplyMode) error {
+	// machine.ApplyConfigurationRequest: bytes data = 1; Mode mode = 4;
+	request := appendBytesField(nil, 1, config)
+	request = appendVarintField(request, 4, uint64(mode))
+
+	resp, err := c.invoke(ctx, "ApplyConfiguration", request)
+	if err != nil {
+		return err
+	}
+	_, err = responseMessages(resp)
+	return err
+}
+
+func (c *GRPCClient) Version(ctx context.Context) (string, error) {
+	resp, err := c.invoke(ctx, "Version", nil)
+	if err != nil {
+		return "", err
+	}
+	messages, err := responseMessages(resp)
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "", fmt.Errorf("empty version response")
+	}
+	// machine.Version: VersionInfo version = 2; machine.VersionInfo: string tag = 1;
+	info, err := bytesField(messages[0], 2)
+	if err != nil {
+		return "", err
+	}
+	tag, err := bytesField(info, 1)
+	if err != nil {
+		return "", err
+	}
+	return string(tag), nil
+}
+
+func (c *GRPCClient) Bootstrap(ctx context.Context) error {
+	resp, err := c.invoke(ctx, "Bootstrap", nil)
+	if err != nil {
+		return err
+	}
+	_, err = responseMessages(resp)
+	return err
+}
+
+func (c *GRPCClient) ServiceList(ctx context.Context) ([]Service, error) {
+	resp, err := c.invoke(ctx, "ServiceList", nil)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := responseMessages(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var services []Service
+	for _, message := range messages {
+		// machine.ServiceList: repeated ServiceInfo services = 2;
+		infos, err := repeatedBytes(message, 2)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			service, err := decodeServiceInfo(info)
+			if err != nil {
+				return nil, err
+			}
+			services = append(services, service)
+		}
+	}
+	return services, nil
+}
+
+// decodeServiceInfo decodes machine.ServiceInfo: string id = 1; string state = 2; ServiceHealth health = 4;
+func decodeServiceInfo(info []byte) (Service, error) {
+	fields, err := decodeFields(info)
+	if err != nil {
+		return Service{}, err
+	}
+	var service Service
+	for _, f := range fields {
+		switch f.Number {
+		case 1:
+			service.ID = string(f.Bytes)
+		case 2:
+			service.State = string(f.Bytes)
+		case 4:
+			// machine.ServiceHealth: bool unknown = 1; bool healthy = 2;
+			health, err := decodeFields(f.Bytes)
+			if err != nil {
+				return Service{}, err
+			}
+			for _, h := range health {
+				if h.Number == 2 {
+					service.Healthy = h.Varint != 0
+				}
+			}
+		}
+	}
+	return service, nil
+}
+
+func (c *GRPCClient) Upgrade(ctx context.Context, image string) error {
+	// machine.UpgradeRequest: string image = 1;
+	resp, err := c.invoke(ctx, "Upgrade", appendStringField(nil, 1, image))
+	if err != nil {
+		return err
+	}
+	_, err = responseMessages(resp)
+	return err
+}
+
+func (c *GRPCClient) Reset(ctx context.Context, graceful, reboot bool) error {
+	// machine.ResetRequest: bool graceful = 1; bool reboot = 2;
+	request := appendBoolField(nil, 1, graceful)
+	request = appendBoolField(request, 2, reboot)
+
+	resp, err := c.invoke(ctx, "Reset", request)
+	if err != nil {
+		return err
+	}
+	_, err = responseMessages(resp)
+	return err
+}
+
+func (c *GRPCClient) Kubeconfig(ctx context.Context) ([]byte, error) {
+	stream, err := c.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/machine.MachineService/Kubeconfig")
+	if err != nil {
+		return nil, fmt.Errorf("Kubeconfig failed: %w", err)
+	}
+	req := rawMessage(nil)
+	if err := stream.SendMsg(&req); err != nil {
+		return nil, fmt.Errorf("Kubeconfig failed: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, fmt.Errorf("Kubeconfig failed: %w", err)
+	}
+
+	// The kubeconfig is streamed as gzipped tar archive in common.Data: bytes bytes = 2;
+	var archive bytes.Buffer
+	for {
+		var resp rawMessage
+		err := stream.RecvMsg(&resp)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Kubeconfig failed: %w", err)
+		}
+		chunk, err := bytesField(resp, 2)
+		if err != nil {
+			return nil, err
+		}
+		archive.Write(chunk)
+	}
+	return extractFile(&archive, "kubeconfig")
+}
+
+// extractFile returns the content of a file from a gzipped tar archive
+func extractFile(archive io.Reader, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s not found in archive", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Name == name {
+			return io.ReadAll(reader)
+		}
+	}
+}
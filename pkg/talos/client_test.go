@@ -0,0 +1,265 @@
+package talos
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fakeMachineService is a local gRPC server answering Talos machine API calls with canned responses
+type fakeMachineService struct {
+	mu        sync.Mutex
+	responses map[string][]byte
+	errors    map[string]error
+	requests  map[string][][]byte
+}
+
+func (f *fakeMachineService) handle(srv any, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	var req rawMessage
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.requests[method] = append(f.requests[method], append([]byte(nil), req...))
+	resp, err := f.responses[method], f.errors[method]
+	f.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return status.Errorf(codes.Unimplemented, "method %s not implemented", method)
+	}
+	message := rawMessage(resp)
+	return stream.SendMsg(&message)
+}
+
+func (f *fakeMachineService) lastRequest(method string) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	requests := f.requests["/machine.MachineService/"+method]
+	if len(requests) == 0 {
+		return nil
+	}
+	return requests[len(requests)-1]
+}
+
+// startFakeMachineService starts a TLS gRPC server on localhost using a self-signed certificate
+func startFakeMachineService(t *testing.T) (*fakeMachineService, string) {
+	t.Helper()
+	fake := &fakeMachineService{
+		responses: map[string][]byte{},
+		errors:    map[string]error{},
+		requests:  map[string][][]byte{},
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{selfSignedCertificate(t)}})),
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(fake.handle),
+	)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return fake, listener.Addr().String()
+}
+
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "talos"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// versionResponse encodes a machine.VersionResponse with a single node
+func versionResponse(tag string) []byte {
+	info := appendStringField(nil, 1, tag)
+	version := appendBytesField(appendBytesField(nil, 1, nil), 2, info)
+	return appendBytesField(nil, 1, version)
+}
+
+// errorResponse encodes a response with an error in the metadata of the message
+func errorResponse(message string) []byte {
+	metadata := appendStringField(appendStringField(nil, 1, "node1"), 2, message)
+	return appendBytesField(nil, 1, appendBytesField(nil, 1, metadata))
+}
+
+func testClient(t *testing.T, endpoint string) Client {
+	t.Helper()
+	client, err := (&GRPCConnector{}).Insecure(endpoint)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestApplyConfiguration(t *testing.T) {
+	fake, endpoint := startFakeMachineService(t)
+	fake.responses["/machine.MachineService/ApplyConfiguration"] = appendBytesField(nil, 1, nil)
+	client := testClient(t, endpoint)
+
+	err := client.ApplyConfiguration(context.Background(), []byte("version: v1alpha1\n"), ApplyModeAuto)
+
+	require.NoError(t, err)
+	fields, err := decodeFields(fake.lastRequest("ApplyConfiguration"))
+	require.NoError(t, err)
+	assert.Equal(t, []field{
+		{Number: 1, Bytes: []byte("version: v1alpha1\n")},
+		{Number: 4, Varint: uint64(ApplyModeAuto)},
+	}, fields)
+}
+
+func TestApplyConfigurationErrors(t *testing.T) {
+	fake, endpoint := startFakeMachineService(t)
+	client := testClient(t, endpoint)
+
+	fake.responses["/machine.MachineService/ApplyConfiguration"] = errorResponse("config validation failed")
+	err := client.ApplyConfiguration(context.Background(), []byte("invalid"), ApplyModeAuto)
+	assert.ErrorContains(t, err, "config validation failed")
+
+	fake.errors["/machine.MachineService/ApplyConfiguration"] = status.Error(codes.Unavailable, "node is not in maintenance mode")
+	err = client.ApplyConfiguration(context.Background(), []byte("invalid"), ApplyModeAuto)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestVersion(t *testing.T) {
+	fake, endpoint := startFakeMachineService(t)
+	fake.responses["/machine.MachineService/Version"] = versionResponse("v1.9.2")
+	client := testClient(t, endpoint)
+
+	version, err := client.Version(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, "v1.9.2", version)
+}
+
+func TestBootstrap(t *testing.T) {
+	fake, endpoint := startFakeMachineService(t)
+	client := testClient(t, endpoint)
+
+	fake.responses["/machine.MachineService/Bootstrap"] = appendBytesField(nil, 1, nil)
+	assert.NoError(t, client.Bootstrap(context.Background()))
+
+	fake.errors["/machine.MachineService/Bootstrap"] = status.Error(codes.AlreadyExists, "etcd data directory is not empty")
+	err := client.Bootstrap(context.Background())
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestUpgrade(t *testing.T) {
+	fake, endpoint := startFakeMachineService(t)
+	fake.responses["/machine.MachineService/Upgrade"] = appendBytesField(nil, 1, nil)
+	client := testClient(t, endpoint)
+
+	err := client.Upgrade(context.Background(), "ghcr.io/siderolabs/installer:v1.9.3")
+
+	require.NoError(t, err)
+	fields, err := decodeFields(fake.lastRequest("Upgrade"))
+	require.NoError(t, err)
+	assert.Equal(t, []field{{Number: 1, Bytes: []byte("ghcr.io/siderolabs/installer:v1.9.3")}}, fields)
+}
+
+func TestReset(t *testing.T) {
+	fake, endpoint := startFakeMachineService(t)
+	fake.responses["/machine.MachineService/Reset"] = appendBytesField(nil, 1, nil)
+	client := testClient(t, endpoint)
+
+	err := client.Reset(context.Background(), true, true)
+
+	require.NoError(t, err)
+	fields, err := decodeFields(fake.lastRequest("Reset"))
+	require.NoError(t, err)
+	assert.Equal(t, []field{{Number: 1, Varint: 1}, {Number: 2, Varint: 1}}, fields)
+}
+
+// serviceInfo encodes a machine.ServiceInfo
+func serviceInfo(id, state string, healthy bool) []byte {
+	info := appendStringField(nil, 1, id)
+	info = appendStringField(info, 2, state)
+	return appendBytesField(info, 4, appendBoolField(nil, 2, healthy))
+}
+
+func TestServiceList(t *testing.T) {
+	fake, endpoint := startFakeMachineService(t)
+	list := appendBytesField(nil, 1, nil)
+	list = appendBytesField(list, 2, serviceInfo("etcd", "Running", true))
+	list = appendBytesField(list, 2, serviceInfo("kubelet", "Preparing", false))
+	fake.responses["/machine.MachineService/ServiceList"] = appendBytesField(nil, 1, list)
+	client := testClient(t, endpoint)
+
+	services, err := client.ServiceList(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, []Service{
+		{ID: "etcd", State: "Running", Healthy: true},
+		{ID: "kubelet", State: "Preparing"},
+	}, services)
+}
+
+func TestKubeconfig(t *testing.T) {
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	content := []byte("apiVersion: v1\nkind: Config\n")
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "kubeconfig", Mode: 0600, Size: int64(len(content))}))
+	_, err := tw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	fake, endpoint := startFakeMachineService(t)
+	fake.responses["/machine.MachineService/Kubeconfig"] = appendBytesField(appendBytesField(nil, 1, nil), 2, archive.Bytes())
+	client := testClient(t, endpoint)
+
+	kubeconfig, err := client.Kubeconfig(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, content, kubeconfig)
+}
+
+func TestSecureRequiresTalosconfig(t *testing.T) {
+	_, err := (&GRPCConnector{}).Secure("127.0.0.1")
+	assert.Error(t, err)
+}
+
+func TestDecodeFieldsSkipsFixedFields(t *testing.T) {
+	b := protowire.AppendTag(nil, 3, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, 42)
+	b = appendStringField(b, 1, "value")
+
+	fields, err := decodeFields(b)
+
+	require.NoError(t, err)
+	assert.Equal(t, []field{{Number: 3}, {Number: 1, Bytes: []byte("value")}}, fields)
+}
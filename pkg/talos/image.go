@@ -0,0 +1,47 @@
+// Package talos contains helpers for Sidero Labs Talos images and machines.
+package talos
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// factoryImage matches disk images from the Talos image factory, e.g.
+// https://factory.talos.dev/image/<schematic>/v1.9.2/metal-amd64.raw.zst
+var factoryImage = regexp.MustCompile(`^https://factory\.talos\.dev/image/([0-9a-f]{64})/(v[^/]+)/`)
+
+// releaseImage matches disk images of Talos releases on GitHub
+var releaseImage = regexp.MustCompile(`^https://github\.com/siderolabs/talos/releases/download/(v[^/]+)/`)
+
+// ImageURL returns the URL of the metal disk image of a Talos release
+func ImageURL(version string) string {
+	return fmt.Sprintf("https://github.com/siderolabs/talos/releases/download/%s/metal-amd64.raw.zst", version)
+}
+
+// InstallerImage returns the installer image matching a disk image.
+// Images from the image factory keep their schematic, other images use the default installer.
+// An empty string is returned if the version is unknown.
+func InstallerImage(version, imageURL string) string {
+	if match := factoryImage.FindStringSubmatch(imageURL); match != nil {
+		if version == "" {
+			version = match[2]
+		}
+		return fmt.Sprintf("factory.talos.dev/installer/%s:%s", match[1], version)
+	}
+	if version == "" {
+		return ""
+	}
+	return fmt.Sprintf("ghcr.io/siderolabs/installer:%s", version)
+}
+
+// ImageVersion returns the Talos version of a release or image factory disk image.
+// An empty string is returned for other images.
+func ImageVersion(imageURL string) string {
+	if match := factoryImage.FindStringSubmatch(imageURL); match != nil {
+		return match[2]
+	}
+	if match := releaseImage.FindStringSubmatch(imageURL); match != nil {
+		return match[1]
+	}
+	return ""
+}
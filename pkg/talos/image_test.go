@@ -0,0 +1,40 @@
+package talos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const schematic = "376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba"
+
+func TestImageURL(t *testing.T) {
+	assert.Equal(t, "https://github.com/siderolabs/talos/releases/download/v1.9.2/metal-amd64.raw.zst", ImageURL("v1.9.2"))
+}
+
+func TestInstallerImage(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		imageURL string
+		expected string
+	}{
+		{"release", "v1.9.2", "", "ghcr.io/siderolabs/installer:v1.9.2"},
+		{"custom image without version", "", "https://example.com/talos.raw.zst", ""},
+		{"custom image", "v1.9.2", "https://example.com/talos.raw.zst", "ghcr.io/siderolabs/installer:v1.9.2"},
+		{"image factory", "", "https://factory.talos.dev/image/" + schematic + "/v1.9.3/metal-amd64.raw.zst", "factory.talos.dev/installer/" + schematic + ":v1.9.3"},
+		{"image factory with version", "v1.9.4", "https://factory.talos.dev/image/" + schematic + "/v1.9.3/metal-amd64.raw.zst", "factory.talos.dev/installer/" + schematic + ":v1.9.4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, InstallerImage(tt.version, tt.imageURL))
+		})
+	}
+}
+
+func TestImageVersion(t *testing.T) {
+	assert.Equal(t, "v1.9.2", ImageVersion(ImageURL("v1.9.2")))
+	assert.Equal(t, "v1.9.3", ImageVersion("https://factory.talos.dev/image/"+schematic+"/v1.9.3/metal-amd64.raw.zst"))
+	assert.Equal(t, "", ImageVersion("https://example.com/talos.raw.zst"))
+}
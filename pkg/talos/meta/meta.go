@@ -0,0 +1,123 @@
+// Package meta encodes the content of the Talos META partition.
+//
+// The META partition contains two copies of a block with the following layout (big-endian):
+//
+//	0x0000   4 bytes  magic1
+//	0x0004   4 bytes  tag
+//	0x0008   4 bytes  size
+//	0x000c   size     value
+//	...      more tags, terminated by a zero tag
+//	-0x0024  32 bytes sha256 of the block with the checksum set to zero
+//	-0x0004  4 bytes  magic2
+package meta
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+const (
+	// Length is the length of a single copy of the META block
+	Length = 256 * 1024
+	// Magic1 marks the start of the META block
+	Magic1 uint32 = 0x5a4b3c2d
+	// Magic2 marks the end of the META block
+	Magic2 uint32 = 0xa5b4c3d2
+
+	checksumOffset = Length - 36
+	headerLength   = 8
+)
+
+// Well-known META keys
+const (
+	// MetalNetworkPlatformConfig stores the network configuration of the metal platform
+	MetalNetworkPlatformConfig uint8 = 0x0a
+	// DownloadURLCode stores the value of the {code} variable in the talos.config= URL
+	DownloadURLCode uint8 = 0x0b
+	// UserReserved1 is reserved for user-defined metadata
+	UserReserved1 uint8 = 0x0c
+	// UserReserved2 is reserved for user-defined metadata
+	UserReserved2 uint8 = 0x0d
+	// UserReserved3 is reserved for user-defined metadata
+	UserReserved3 uint8 = 0x0e
+)
+
+// Encode returns the content of the META partition with both copies of the block.
+func Encode(values map[uint8][]byte) ([]byte, error) {
+	block := make([]byte, Length)
+	binary.BigEndian.PutUint32(block[0:4], Magic1)
+
+	keys := make([]int, 0, len(values))
+	for key := range values {
+		if key == 0 {
+			return nil, fmt.Errorf("META key 0 is reserved")
+		}
+		keys = append(keys, int(key))
+	}
+	sort.Ints(keys)
+
+	offset := 4
+	for _, key := range keys {
+		value := values[uint8(key)]
+		// Keep room for the terminating zero tag
+		if offset+headerLength+len(value)+headerLength > checksumOffset {
+			return nil, fmt.Errorf("META values exceed %d bytes", checksumOffset)
+		}
+		binary.BigEndian.PutUint32(block[offset:], uint32(key))
+		binary.BigEndian.PutUint32(block[offset+4:], uint32(len(value)))
+		copy(block[offset+headerLength:], value)
+		offset += headerLength + len(value)
+	}
+
+	binary.BigEndian.PutUint32(block[Length-4:], Magic2)
+	checksum := sha256.Sum256(block)
+	copy(block[checksumOffset:], checksum[:])
+
+	return append(block, block...), nil
+}
+
+// Decode returns the values of the first valid copy of the META block.
+func Decode(data []byte) (map[uint8][]byte, error) {
+	var err error
+	for copyOffset := 0; copyOffset+Length <= len(data); copyOffset += Length {
+		var values map[uint8][]byte
+		if values, err = decodeBlock(data[copyOffset : copyOffset+Length]); err == nil {
+			return values, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("META data too short: %d bytes", len(data))
+	}
+	return nil, err
+}
+
+func decodeBlock(block []byte) (map[uint8][]byte, error) {
+	if binary.BigEndian.Uint32(block[0:4]) != Magic1 || binary.BigEndian.Uint32(block[Length-4:]) != Magic2 {
+		return nil, fmt.Errorf("META magic mismatch")
+	}
+
+	verify := bytes.Clone(block)
+	copy(verify[checksumOffset:Length-4], make([]byte, sha256.Size))
+	checksum := sha256.Sum256(verify)
+	if !bytes.Equal(checksum[:], block[checksumOffset:Length-4]) {
+		return nil, fmt.Errorf("META checksum mismatch")
+	}
+
+	values := map[uint8][]byte{}
+	for offset := 4; offset+headerLength <= checksumOffset; {
+		key := binary.BigEndian.Uint32(block[offset:])
+		if key == 0 {
+			break
+		}
+		size := int(binary.BigEndian.Uint32(block[offset+4:]))
+		if key > 0xff || offset+headerLength+size > checksumOffset {
+			return nil, fmt.Errorf("invalid META tag %d at offset %d", key, offset)
+		}
+		values[uint8(key)] = block[offset+headerLength : offset+headerLength+size]
+		offset += headerLength + size
+	}
+	return values, nil
+}
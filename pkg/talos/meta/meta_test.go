@@ -0,0 +1,59 @@
+package meta
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncode(t *testing.T) {
+	data, err := Encode(map[uint8][]byte{
+		UserReserved1:              []byte("rack-7"),
+		MetalNetworkPlatformConfig: []byte("addresses: []\n"),
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, data, 2*Length)
+	assert.Equal(t, data[:Length], data[Length:])
+	assert.Equal(t, Magic1, binary.BigEndian.Uint32(data[0:4]))
+	assert.Equal(t, Magic2, binary.BigEndian.Uint32(data[Length-4:Length]))
+	// Keys are written in ascending order
+	assert.Equal(t, uint32(MetalNetworkPlatformConfig), binary.BigEndian.Uint32(data[4:8]))
+	assert.Equal(t, uint32(14), binary.BigEndian.Uint32(data[8:12]))
+}
+
+func TestDecode(t *testing.T) {
+	values := map[uint8][]byte{
+		MetalNetworkPlatformConfig: []byte("addresses: []\n"),
+		UserReserved2:              []byte("value"),
+	}
+	data, err := Encode(values)
+	assert.NoError(t, err)
+
+	decoded, err := Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, values, decoded)
+}
+
+func TestDecodeUsesSecondCopy(t *testing.T) {
+	data, err := Encode(map[uint8][]byte{UserReserved1: []byte("value")})
+	assert.NoError(t, err)
+	data[20] ^= 0xff
+
+	decoded, err := Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), decoded[UserReserved1])
+
+	data[Length+20] ^= 0xff
+	_, err = Decode(data)
+	assert.ErrorContains(t, err, "checksum")
+}
+
+func TestEncodeErrors(t *testing.T) {
+	_, err := Encode(map[uint8][]byte{0: []byte("value")})
+	assert.Error(t, err)
+
+	_, err = Encode(map[uint8][]byte{UserReserved1: make([]byte, Length)})
+	assert.Error(t, err)
+}
@@ -0,0 +1,145 @@
+package talos
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The Talos machine API is called with protobuf messages encoded by hand using protowire.
+// This avoids depending on the Talos machinery module for a handful of small messages.
+
+// rawMessage is an encoded protobuf message
+type rawMessage []byte
+
+// rawCodec passes encoded protobuf messages to and from grpc without reflection
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	message, ok := v.(*rawMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return *message, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	message, ok := v.(*rawMessage)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	*message = append((*message)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+func appendBytesField(b []byte, number protowire.Number, value []byte) []byte {
+	b = protowire.AppendTag(b, number, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+func appendStringField(b []byte, number protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, number, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func appendVarintField(b []byte, number protowire.Number, value uint64) []byte {
+	if value == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, number, protowire.VarintType)
+	return protowire.AppendVarint(b, value)
+}
+
+func appendBoolField(b []byte, number protowire.Number, value bool) []byte {
+	if !value {
+		return b
+	}
+	return appendVarintField(b, number, 1)
+}
+
+// field is a decoded protobuf field. Bytes is set for length delimited fields, Varint for varint fields.
+type field struct {
+	Number protowire.Number
+	Bytes  []byte
+	Varint uint64
+}
+
+// decodeFields decodes the top level fields of a message. Fixed size fields are skipped.
+func decodeFields(b []byte) ([]field, error) {
+	var fields []field
+	for len(b) > 0 {
+		number, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := field{Number: number}
+		switch typ {
+		case protowire.VarintType:
+			f.Varint, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			f.Bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(number, typ, b)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// repeatedBytes returns all length delimited values of a field
+func repeatedBytes(b []byte, number protowire.Number) ([][]byte, error) {
+	fields, err := decodeFields(b)
+	if err != nil {
+		return nil, err
+	}
+	var values [][]byte
+	for _, f := range fields {
+		if f.Number == number && f.Bytes != nil {
+			values = append(values, f.Bytes)
+		}
+	}
+	return values, nil
+}
+
+// bytesField returns the last length delimited value of a field
+func bytesField(b []byte, number protowire.Number) ([]byte, error) {
+	values, err := repeatedBytes(b, number)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	return values[len(values)-1], nil
+}
+
+// responseMessages returns the messages of a Talos response. All Talos responses contain
+// `repeated <Message> messages = 1` where each message starts with `common.Metadata metadata = 1`.
+// An error reported in the metadata of a message is returned as error.
+func responseMessages(b []byte) ([][]byte, error) {
+	messages, err := repeatedBytes(b, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	for _, message := range messages {
+		metadata, err := bytesField(message, 1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response metadata: %w", err)
+		}
+		// common.Metadata: string hostname = 1; string error = 2;
+		if errorMessage, _ := bytesField(metadata, 2); len(errorMessage) > 0 {
+			return nil, fmt.Errorf("%s", errorMessage)
+		}
+	}
+	return messages, nil
+}
@@ -0,0 +1,79 @@
+package talos
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	yaml "github.com/goccy/go-yaml"
+)
+
+// Talosconfig is the client configuration generated by talosctl
+type Talosconfig struct {
+	Context  string                         `json:"context"`
+	Contexts map[string]*TalosconfigContext `json:"contexts"`
+}
+
+// TalosconfigContext contains the endpoints and the credentials of a cluster
+type TalosconfigContext struct {
+	Endpoints []string `json:"endpoints"`
+	Nodes     []string `json:"nodes,omitempty"`
+	CA        string   `json:"ca"`
+	Crt       string   `json:"crt"`
+	Key       string   `json:"key"`
+}
+
+// ReadTalosconfig reads a talosconfig file
+func ReadTalosconfig(filename string) (*Talosconfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading talosconfig: %v", err)
+	}
+	var config Talosconfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing talosconfig: %v", err)
+	}
+	return &config, nil
+}
+
+// CurrentContext returns the selected context of the talosconfig
+func (c *Talosconfig) CurrentContext() (*TalosconfigContext, error) {
+	context, ok := c.Contexts[c.Context]
+	if !ok || context == nil {
+		return nil, fmt.Errorf("context '%s' not found in talosconfig", c.Context)
+	}
+	return context, nil
+}
+
+// TLSConfig returns the TLS configuration using the client certificate and CA of the context
+func (c *TalosconfigContext) TLSConfig() (*tls.Config, error) {
+	ca, err := base64.StdEncoding.DecodeString(c.CA)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding talosconfig CA: %v", err)
+	}
+	crt, err := base64.StdEncoding.DecodeString(c.Crt)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding talosconfig certificate: %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding talosconfig key: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no CA certificate found in talosconfig")
+	}
+	certificate, err := tls.X509KeyPair(crt, key)
+	if err != nil {
+		return nil, fmt.Errorf("error loading talosconfig client certificate: %v", err)
+	}
+
+	return &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
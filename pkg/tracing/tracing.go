@@ -0,0 +1,72 @@
+// Package tracing sets up the OpenTelemetry tracer provider used by the controller, Robot and SSH spans.
+// Spans are only recorded after Setup, the default global tracer provider drops them.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ServiceName is the service name of the exported spans
+const ServiceName = "thdctl"
+
+// Options select the exporters of the spans, tracing is disabled when none is set
+type Options struct {
+	// OTLPEndpoint is the URL of an OTLP/HTTP collector, e.g. http://localhost:4318.
+	// The OTEL_EXPORTER_OTLP_* environment variables configure headers and TLS.
+	OTLPEndpoint string
+	// File receives the spans as JSON, one span per line
+	File string
+}
+
+// Setup installs the global tracer provider. The returned function flushes the spans and must be called before
+// the process exits.
+func Setup(ctx context.Context, options Options) (func(context.Context) error, error) {
+	if options.OTLPEndpoint == "" && options.File == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var closers []func() error
+	providerOptions := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	}
+	if options.OTLPEndpoint != "" {
+		exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(options.OTLPEndpoint))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %v", err)
+		}
+		providerOptions = append(providerOptions, sdktrace.WithBatcher(exporter))
+	}
+	if options.File != "" {
+		file, err := os.OpenFile(options.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %v", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		providerOptions = append(providerOptions, sdktrace.WithBatcher(exporter))
+		closers = append(closers, file.Close)
+	}
+
+	provider := sdktrace.NewTracerProvider(providerOptions...)
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		for _, close := range closers {
+			err = errors.Join(err, close())
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetupWritesSpansToFile(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	filename := filepath.Join(t.TempDir(), "trace.json")
+
+	shutdown, err := Setup(context.Background(), Options{File: filename})
+	require.NoError(t, err)
+	_, span := otel.Tracer("test").Start(context.Background(), "StateMachine.Run")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Name":"StateMachine.Run"`)
+	assert.Contains(t, string(data), `"Value":"thdctl"`)
+}
+
+func TestSetupWithoutExporter(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	shutdown, err := Setup(context.Background(), Options{})
+	require.NoError(t, err)
+	assert.Same(t, previous, otel.GetTracerProvider())
+	assert.NoError(t, shutdown(context.Background()))
+}
@@ -0,0 +1,65 @@
+package validation
+
+import (
+	"net"
+
+	baremetalassetv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/baremetalasset/v1alpha"
+	clusterv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/cluster/v1alpha"
+)
+
+// ValidateBareMetalAsset validates an asset. The image is only validated when it is set,
+// an asset without image is not provisioned.
+func ValidateBareMetalAsset(asset *baremetalassetv1alpha1.BareMetalAsset) ErrorList {
+	path := "spec"
+	spec := asset.Spec
+	var errs ErrorList
+
+	bmcPath := child(path, "bmc")
+	if serverNumber, err := spec.BMC.ServerNumber(); err != nil {
+		errs = append(errs, invalid(child(bmcPath, "address"), spec.BMC.Address, "%v", err))
+	} else {
+		errs = append(errs, ValidateServerNumber(serverNumber, child(bmcPath, "address"))...)
+	}
+	if spec.BMC.CredentialsName == "" {
+		errs = append(errs, required(child(bmcPath, "credentialsName"), "the Secret with the Robot webservice credentials"))
+	}
+
+	if spec.BootMACAddress != "" {
+		if _, err := net.ParseMAC(spec.BootMACAddress); err != nil {
+			errs = append(errs, invalid(child(path, "bootMACAddress"), spec.BootMACAddress, "must be a MAC address"))
+		}
+	}
+	if spec.RootDeviceHints == nil || spec.RootDeviceHints.DeviceName == "" {
+		errs = append(errs, required(child(child(path, "rootDeviceHints"), "deviceName"), "the disk Talos is installed on, e.g. sda"))
+	} else {
+		errs = append(errs, ValidateDisk(spec.RootDeviceHints.DeviceName, child(child(path, "rootDeviceHints"), "deviceName"))...)
+	}
+
+	switch spec.Role {
+	case clusterv1alpha1.ControlPlane, clusterv1alpha1.Worker:
+	case "":
+		if len(spec.TalosConfig) > 0 {
+			errs = append(errs, required(child(path, "role"), "selects the machine config of talosConfig"))
+		}
+	default:
+		errs = append(errs, invalid(child(path, "role"), spec.Role, "must be %s or %s", clusterv1alpha1.ControlPlane, clusterv1alpha1.Worker))
+	}
+
+	if spec.Image != "" {
+		errs = append(errs, ValidateImageURL(spec.Image, child(path, "image"))...)
+	}
+	if len(spec.TalosNetwork) > 1 {
+		errs = append(errs, invalid(child(path, "talosNetwork"), len(spec.TalosNetwork), "at most one network configuration is supported"))
+	}
+	for i, network := range spec.TalosNetwork {
+		if network.ConfigRef == "" {
+			errs = append(errs, required(child(index(child(path, "talosNetwork"), i), "configRef"), "the Secret with the network configuration"))
+		}
+	}
+	for i, config := range spec.TalosConfig {
+		if config.SecretRef == "" {
+			errs = append(errs, required(child(index(child(path, "talosConfig"), i), "secretRef"), "the Secret with the machine configs"))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,59 @@
+package validation
+
+import (
+	"testing"
+
+	baremetalassetv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/baremetalasset/v1alpha"
+	clusterv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/cluster/v1alpha"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBareMetalAsset(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(spec *baremetalassetv1alpha1.BareMetalAssetSpec)
+		errors []string
+	}{
+		{"valid", func(spec *baremetalassetv1alpha1.BareMetalAssetSpec) {}, nil},
+		{"without image", func(spec *baremetalassetv1alpha1.BareMetalAssetSpec) { spec.Image = "" }, nil},
+		{"ipmi address", func(spec *baremetalassetv1alpha1.BareMetalAssetSpec) { spec.BMC.Address = "ipmi://10.0.0.1:623" }, []string{
+			`spec.bmc.address: invalid value "ipmi://10.0.0.1:623": scheme must be hetzner, ipmi is not supported`,
+		}},
+		{"missing credentials", func(spec *baremetalassetv1alpha1.BareMetalAssetSpec) { spec.BMC.CredentialsName = "" }, []string{
+			"spec.bmc.credentialsName: required, the Secret with the Robot webservice credentials",
+		}},
+		{"invalid MAC address", func(spec *baremetalassetv1alpha1.BareMetalAssetSpec) { spec.BootMACAddress = "00:1B" }, []string{
+			`spec.bootMACAddress: invalid value "00:1B": must be a MAC address`,
+		}},
+		{"missing root device", func(spec *baremetalassetv1alpha1.BareMetalAssetSpec) { spec.RootDeviceHints = nil }, []string{
+			"spec.rootDeviceHints.deviceName: required, the disk Talos is installed on, e.g. sda",
+		}},
+		{"missing role", func(spec *baremetalassetv1alpha1.BareMetalAssetSpec) { spec.Role = "" }, []string{
+			"spec.role: required, selects the machine config of talosConfig",
+		}},
+		{"image not allowed", func(spec *baremetalassetv1alpha1.BareMetalAssetSpec) {
+			spec.Image = "https://example.com/metal-amd64.iso"
+		}, []string{
+			`spec.image: invalid value "https://example.com/metal-amd64.iso": host example.com is not allowed, allowed hosts are factory.talos.dev, github.com`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asset := &baremetalassetv1alpha1.BareMetalAsset{Spec: baremetalassetv1alpha1.BareMetalAssetSpec{
+				BMC:             baremetalassetv1alpha1.BMCDetails{Address: "hetzner://123456", CredentialsName: "robot"},
+				BootMACAddress:  "00:1B:44:11:3A:B7",
+				RootDeviceHints: &baremetalassetv1alpha1.RootDeviceHints{DeviceName: "sda"},
+				Role:            clusterv1alpha1.Worker,
+				Image:           "https://factory.talos.dev/image/376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba/v1.9.2/metal-amd64.raw.zst",
+				TalosConfig:     []baremetalassetv1alpha1.SecretReference{{SecretRef: "configs"}},
+			}}
+			tt.modify(&asset.Spec)
+
+			var errors []string
+			for _, err := range ValidateBareMetalAsset(asset) {
+				errors = append(errors, err.Error())
+			}
+			assert.Equal(t, tt.errors, errors)
+		})
+	}
+}
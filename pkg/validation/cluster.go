@@ -0,0 +1,65 @@
+package validation
+
+import (
+	"net/url"
+	"regexp"
+
+	clusterv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/cluster/v1alpha"
+)
+
+var validKubernetesVersion = regexp.MustCompile(`^v?\d+\.\d+\.\d+$`)
+
+// ValidateCluster validates the definition of a cluster
+func ValidateCluster(cluster *clusterv1alpha1.Cluster) ErrorList {
+	return ValidateClusterParameters(&cluster.Spec.ForProvider, "spec.forProvider")
+}
+
+// ValidateClusterParameters validates the parameters of a cluster, path is the path of the parameters in the document
+func ValidateClusterParameters(p *clusterv1alpha1.ClusterParameters, path string) ErrorList {
+	var errs ErrorList
+	if p.ClusterName == "" {
+		errs = append(errs, required(child(path, "clusterName"), "the name of the cluster"))
+	}
+	if p.Endpoint == "" {
+		errs = append(errs, required(child(path, "endpoint"), "the URL of the Kubernetes API"))
+	} else if u, err := url.Parse(p.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+		errs = append(errs, invalid(child(path, "endpoint"), p.Endpoint, "must be a https URL like https://192.0.2.10:6443"))
+	}
+	if p.KubernetesVersion != "" && !validKubernetesVersion.MatchString(p.KubernetesVersion) {
+		errs = append(errs, invalid(child(path, "kubernetesVersion"), p.KubernetesVersion, "must be a Kubernetes version like 1.32.3"))
+	}
+	if p.TalosVersion != "" {
+		errs = append(errs, ValidateTalosVersion(p.TalosVersion, child(path, "talosVersion"))...)
+	}
+
+	nodesPath := child(path, "nodes")
+	if len(p.Nodes) == 0 {
+		errs = append(errs, required(nodesPath, "a cluster needs at least one node"))
+	}
+	names := map[string]bool{}
+	controlPlanes := 0
+	for i, node := range p.Nodes {
+		nodePath := index(nodesPath, i)
+		switch {
+		case node.Name == "":
+			errs = append(errs, required(child(nodePath, "name"), "the hostname of the node"))
+		case names[node.Name]:
+			errs = append(errs, invalid(child(nodePath, "name"), node.Name, "duplicate node name"))
+		}
+		names[node.Name] = true
+		switch node.Role {
+		case clusterv1alpha1.ControlPlane:
+			controlPlanes++
+		case clusterv1alpha1.Worker:
+		default:
+			errs = append(errs, invalid(child(nodePath, "role"), node.Role, "must be %s or %s", clusterv1alpha1.ControlPlane, clusterv1alpha1.Worker))
+		}
+		if node.ServerSpec == "" {
+			errs = append(errs, required(child(nodePath, "serverSpec"), "the server specification of the node"))
+		}
+	}
+	if len(p.Nodes) > 0 && controlPlanes == 0 {
+		errs = append(errs, required(nodesPath, "a cluster needs at least one %s node", clusterv1alpha1.ControlPlane))
+	}
+	return errs
+}
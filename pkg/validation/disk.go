@@ -1,20 +1,17 @@
 package validation
 
-import (
-	"fmt"
-	"regexp"
-)
+import "regexp"
 
-var (
-	// validDiskName matches common Linux disk device names like:
-	// sda, sdb1, nvme0n1, nvme0n1p1, mmcblk0, mmcblk0p1
-	validDiskName = regexp.MustCompile(`^(sd[a-z][1-9]?|nvme\d+n\d+p?\d*|mmcblk\d+p?\d*)$`)
-)
+// DiskNamePattern matches the Linux device names of whole disks like sda, nvme0n1 or mmcblk0.
+// Partitions like sda1 or nvme0n1p1 are rejected, the image is written to the whole disk.
+const DiskNamePattern = `^(sd[a-z]+|nvme\d+n\d+|mmcblk\d+)$`
 
-// ValidateDiskName checks if the provided disk name is valid
-func ValidateDiskName(disk string) error {
+var validDiskName = regexp.MustCompile(DiskNamePattern)
+
+// ValidateDisk validates the disk name of a field
+func ValidateDisk(disk, path string) ErrorList {
 	if !validDiskName.MatchString(disk) {
-		return fmt.Errorf("invalid disk name '%s'. Must be a valid Linux device name (e.g., sda, nvme0n1)", disk)
+		return ErrorList{invalid(path, disk, "must be a Linux device name like sda or nvme0n1")}
 	}
 	return nil
 }
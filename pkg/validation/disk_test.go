@@ -6,18 +6,19 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestValidateDiskName(t *testing.T) {
+func TestValidateDisk(t *testing.T) {
 	tests := []struct {
 		name    string
 		disk    string
 		wantErr bool
 	}{
 		{"valid sda", "sda", false},
-		{"valid sdb1", "sdb1", false},
+		{"valid sdaa", "sdaa", false},
 		{"valid nvme0n1", "nvme0n1", false},
-		{"valid nvme0n1p1", "nvme0n1p1", false},
 		{"valid mmcblk0", "mmcblk0", false},
-		{"valid mmcblk0p1", "mmcblk0p1", false},
+		{"invalid partition sdb1", "sdb1", true},
+		{"invalid partition nvme0n1p1", "nvme0n1p1", true},
+		{"invalid partition mmcblk0p1", "mmcblk0p1", true},
 		{"invalid path", "/dev/sda", true},
 		{"invalid special chars", "sda;rm", true},
 		{"invalid empty", "", true},
@@ -28,11 +29,11 @@ func TestValidateDiskName(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := ValidateDiskName(tt.disk)
+			errs := ValidateDisk(tt.disk, "disk")
 			if tt.wantErr {
-				assert.Error(t, err)
+				assert.NotEmpty(t, errs)
 			} else {
-				assert.NoError(t, err)
+				assert.Empty(t, errs)
 			}
 		})
 	}
@@ -0,0 +1,73 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError is a validation error of a single field.
+// Path is the path of the field in the document, e.g. spec.forProvider.disk
+type FieldError struct {
+	// Document is the number of the document in a manifest, 0 if unknown
+	Document int
+	Path     string
+	Value    any
+	Detail   string
+}
+
+func (e *FieldError) Error() string {
+	var b strings.Builder
+	if e.Document > 0 {
+		fmt.Fprintf(&b, "document %d: ", e.Document)
+	}
+	if e.Path != "" {
+		fmt.Fprintf(&b, "%s: ", e.Path)
+	}
+	if e.Value != nil {
+		fmt.Fprintf(&b, "invalid value %q: ", fmt.Sprint(e.Value))
+	}
+	b.WriteString(e.Detail)
+	return b.String()
+}
+
+// ErrorList contains all validation errors of an object
+type ErrorList []*FieldError
+
+func (l ErrorList) Error() string {
+	messages := make([]string, len(l))
+	for i, err := range l {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// ToAggregate returns the list as error, nil if the list is empty
+func (l ErrorList) ToAggregate() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// invalid returns an error of a field with an invalid value
+func invalid(path string, value any, format string, args ...any) *FieldError {
+	return &FieldError{Path: path, Value: value, Detail: fmt.Sprintf(format, args...)}
+}
+
+// required returns an error of a missing field
+func required(path string, format string, args ...any) *FieldError {
+	return &FieldError{Path: path, Detail: "required, " + fmt.Sprintf(format, args...)}
+}
+
+// child returns the path of a field of the object at path
+func child(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// index returns the path of an item of the list at path
+func index(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"net"
+	"slices"
+
+	firewallv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/firewall/v1alpha"
+)
+
+var (
+	firewallActions   = []string{"accept", "discard"}
+	firewallProtocols = []string{"tcp", "udp", "gre", "icmp", "ipip", "ah", "esp"}
+)
+
+// ValidateFirewall validates the firewall of a server
+func ValidateFirewall(firewall *firewallv1alpha1.Firewall) ErrorList {
+	path := "spec.forProvider"
+	p := firewall.Spec.ForProvider
+	errs := ValidateServerNumber(p.ServerNumber, child(path, "serverNumber"))
+	for i, rule := range p.Rules {
+		rulePath := index(child(path, "rules"), i)
+		if !slices.Contains(firewallActions, rule.Action) {
+			errs = append(errs, invalid(child(rulePath, "action"), rule.Action, "must be accept or discard"))
+		}
+		if rule.Protocol != "" && !slices.Contains(firewallProtocols, rule.Protocol) {
+			errs = append(errs, invalid(child(rulePath, "protocol"), rule.Protocol, "must be one of %v", firewallProtocols))
+		}
+		if rule.SrcIP != "" && !validIPOrNetwork(rule.SrcIP) {
+			errs = append(errs, invalid(child(rulePath, "srcIP"), rule.SrcIP, "must be an IP address or network"))
+		}
+		if rule.DstIP != "" && !validIPOrNetwork(rule.DstIP) {
+			errs = append(errs, invalid(child(rulePath, "dstIP"), rule.DstIP, "must be an IP address or network"))
+		}
+	}
+	return errs
+}
+
+func validIPOrNetwork(value string) bool {
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		return true
+	}
+	return net.ParseIP(value) != nil
+}
@@ -0,0 +1,49 @@
+package validation
+
+import (
+	"fmt"
+
+	baremetalassetv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/baremetalasset/v1alpha"
+	clusterv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/cluster/v1alpha"
+	firewallv1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/firewall/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/api/manifest"
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+)
+
+// ValidateObject validates an object decoded from a manifest
+func ValidateObject(obj any) ErrorList {
+	switch obj := obj.(type) {
+	case *v1alpha1.Server:
+		return ValidateServer(obj)
+	case *v1alpha1.ServerParameters:
+		return ValidateServerParameters(obj, "")
+	case *v1alpha1.ServerList:
+		var errs ErrorList
+		for i := range obj.Items {
+			errs = append(errs, ValidateServerParameters(&obj.Items[i].Spec.ForProvider, index("items", i)+".spec.forProvider")...)
+		}
+		return errs
+	case *clusterv1alpha1.Cluster:
+		return ValidateCluster(obj)
+	case *clusterv1alpha1.ClusterParameters:
+		return ValidateClusterParameters(obj, "")
+	case *firewallv1alpha1.Firewall:
+		return ValidateFirewall(obj)
+	case *baremetalassetv1alpha1.BareMetalAsset:
+		return ValidateBareMetalAsset(obj)
+	default:
+		return ErrorList{{Detail: fmt.Sprintf("validation of %T is not supported", obj)}}
+	}
+}
+
+// ValidateDocuments validates all documents of a manifest. The errors contain the number of the document.
+func ValidateDocuments(documents []manifest.Document) ErrorList {
+	var errs ErrorList
+	for _, document := range documents {
+		for _, err := range ValidateObject(document.Object) {
+			err.Document = document.Index + 1
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
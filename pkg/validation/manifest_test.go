@@ -0,0 +1,73 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/eriklundjensen/thdctl/pkg/api/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const invalidManifest = `apiVersion: lund.ai/v1alpha1
+kind: Server
+spec:
+  forProvider:
+    serverNumber: 1
+    disk: sda
+    talosVersion: v1.9.2
+---
+apiVersion: lund.ai/v1alpha1
+kind: ServerList
+items:
+- spec:
+    forProvider:
+      serverNumber: 2
+      disk: sda
+---
+apiVersion: lund.ai/v1alpha1
+kind: Cluster
+spec:
+  forProvider:
+    clusterName: demo-1
+    endpoint: http://192.0.2.10:6443
+    kubernetesVersion: "1.32.3"
+    nodes:
+    - name: node1
+      role: worker
+      serverSpec: server.yaml
+    - name: node1
+      role: master
+---
+apiVersion: lund.ai/v1alpha1
+kind: Firewall
+spec:
+  forProvider:
+    serverNumber: 1
+    rules:
+    - srcIP: 192.0.2.0/24
+      dstIP: 192.0.2.256
+      protocol: sctp
+      action: drop
+`
+
+func TestValidateDocuments(t *testing.T) {
+	documents, err := manifest.DefaultScheme.Decode([]byte(invalidManifest), nil)
+	require.NoError(t, err)
+
+	var messages []string
+	for _, err := range ValidateDocuments(documents) {
+		messages = append(messages, err.Error())
+	}
+
+	assert.Equal(t, []string{
+		"document 2: items[0].spec.forProvider: required, talosVersion or talosImage must be set",
+		`document 3: spec.forProvider.endpoint: invalid value "http://192.0.2.10:6443": must be a https URL like https://192.0.2.10:6443`,
+		`document 3: spec.forProvider.nodes[1].name: invalid value "node1": duplicate node name`,
+		`document 3: spec.forProvider.nodes[1].role: invalid value "master": must be controlplane or worker`,
+		"document 3: spec.forProvider.nodes[1].serverSpec: required, the server specification of the node",
+		"document 3: spec.forProvider.nodes: required, a cluster needs at least one controlplane node",
+		`document 4: spec.forProvider.rules[0].action: invalid value "drop": must be accept or discard`,
+		`document 4: spec.forProvider.rules[0].protocol: invalid value "sctp": must be one of [tcp udp gre icmp ipip ah esp]`,
+		`document 4: spec.forProvider.rules[0].dstIP: invalid value "192.0.2.256": must be an IP address or network`,
+	}, messages)
+}
@@ -0,0 +1,162 @@
+package validation
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/eriklundjensen/thdctl/pkg/talos"
+	"github.com/eriklundjensen/thdctl/pkg/talos/meta"
+)
+
+// TalosVersionPattern matches semantic Talos versions like v1.9.2 or v1.10.0-beta.1
+const TalosVersionPattern = `^v\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?$`
+
+var validTalosVersion = regexp.MustCompile(TalosVersionPattern)
+
+// imageURLCharacters are the characters allowed in image URLs. The URL is passed to a shell in the rescue system,
+// shell metacharacters like ;|&$` and quotes are rejected even though the download quotes the URL.
+var imageURLCharacters = regexp.MustCompile(`^[A-Za-z0-9._~:/?#\[\]@+,=%-]+$`)
+
+// AllowedImageHosts are the hosts Talos images may be downloaded from, set by the --allowed-image-hosts flag.
+// A host starting with *. allows all subdomains of the domain.
+var AllowedImageHosts = []string{"factory.talos.dev", "github.com"}
+
+// ValidateServer validates the specification of a server
+func ValidateServer(server *v1alpha1.Server) ErrorList {
+	return ValidateServerParameters(&server.Spec.ForProvider, "spec.forProvider")
+}
+
+// ValidateServerParameters validates the parameters of a server, path is the path of the parameters in the document
+func ValidateServerParameters(p *v1alpha1.ServerParameters, path string) ErrorList {
+	var errs ErrorList
+	errs = append(errs, ValidateServerNumber(p.ServerNumber, child(path, "serverNumber"))...)
+
+	if p.Disk == "" {
+		errs = append(errs, required(child(path, "disk"), "the disk Talos is installed on, e.g. sda"))
+	} else {
+		errs = append(errs, ValidateDisk(p.Disk, child(path, "disk"))...)
+	}
+
+	switch {
+	case p.TalosVersion == "" && p.TalosImage == "":
+		errs = append(errs, required(path, "talosVersion or talosImage must be set"))
+	case p.TalosVersion != "" && p.TalosImage != "":
+		// the version is only needed for images without the version in the URL
+		if version := talos.ImageVersion(p.TalosImage); version != "" && version != p.TalosVersion {
+			errs = append(errs, invalid(child(path, "talosVersion"), p.TalosVersion,
+				"talosVersion and talosImage are mutually exclusive, talosImage is an image of %s", version))
+		}
+	}
+	if p.TalosVersion != "" {
+		errs = append(errs, ValidateTalosVersion(p.TalosVersion, child(path, "talosVersion"))...)
+	}
+	if p.TalosImage != "" {
+		errs = append(errs, ValidateImageURL(p.TalosImage, child(path, "talosImage"))...)
+	}
+
+	if p.DiskHealth != nil {
+		errs = append(errs, validateDiskHealth(p.DiskHealth, child(path, "diskHealth"))...)
+	}
+	if p.FirstBoot != nil {
+		errs = append(errs, validateFirstBoot(p.FirstBoot, child(path, "firstBoot"))...)
+		if p.FirstBoot.MachineConfigFile != "" && p.MachineConfig != "" {
+			errs = append(errs, invalid(child(path, "machineConfig"), p.MachineConfig,
+				"machineConfig and firstBoot.machineConfigFile are mutually exclusive"))
+		}
+	}
+
+	if p.Bootstrap && p.Talosconfig == "" {
+		errs = append(errs, required(child(path, "talosconfig"), "the talosconfig is needed to bootstrap the node"))
+	}
+	if p.Kubeconfig != "" && !p.Bootstrap {
+		errs = append(errs, invalid(child(path, "kubeconfig"), p.Kubeconfig, "the kubeconfig is only written by the node with bootstrap: true"))
+	}
+	return errs
+}
+
+// ValidateServerNumber validates the number of a server in the Hetzner Robot
+func ValidateServerNumber(serverNumber int, path string) ErrorList {
+	if serverNumber < 1 {
+		return ErrorList{invalid(path, serverNumber, "must be a positive server number")}
+	}
+	return nil
+}
+
+// ValidateTalosVersion validates a semantic Talos version like v1.9.2
+func ValidateTalosVersion(version, path string) ErrorList {
+	if !validTalosVersion.MatchString(version) {
+		return ErrorList{invalid(path, version, "must be a Talos version like v1.9.2")}
+	}
+	return nil
+}
+
+// ValidateImageURL validates that the image is downloaded using https from an allowed host
+func ValidateImageURL(image, path string) ErrorList {
+	if !imageURLCharacters.MatchString(image) {
+		return ErrorList{invalid(path, image, "must be a URL without whitespace, quotes or shell characters like ;|&$`")}
+	}
+	u, err := url.Parse(image)
+	if err != nil {
+		return ErrorList{invalid(path, image, "must be a URL: %v", err)}
+	}
+	if u.Scheme != "https" {
+		return ErrorList{invalid(path, image, "must be a https URL")}
+	}
+	if !imageHostAllowed(u.Hostname()) {
+		return ErrorList{invalid(path, image, "host %s is not allowed, allowed hosts are %s", u.Hostname(), strings.Join(AllowedImageHosts, ", "))}
+	}
+	return nil
+}
+
+func imageHostAllowed(host string) bool {
+	for _, allowed := range AllowedImageHosts {
+		if domain, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func validateDiskHealth(policy *v1alpha1.DiskHealthPolicy, path string) ErrorList {
+	var errs ErrorList
+	if policy.Action != "" && !slices.Contains([]v1alpha1.DiskHealthAction{v1alpha1.DiskHealthEnforce, v1alpha1.DiskHealthWarn}, policy.Action) {
+		errs = append(errs, invalid(child(path, "action"), policy.Action, "must be %s or %s", v1alpha1.DiskHealthEnforce, v1alpha1.DiskHealthWarn))
+	}
+	thresholds := []struct {
+		name  string
+		value *int64
+	}{
+		{"maxReallocatedSectors", policy.MaxReallocatedSectors},
+		{"maxMediaErrors", policy.MaxMediaErrors},
+		{"maxPercentageUsed", policy.MaxPercentageUsed},
+	}
+	for _, threshold := range thresholds {
+		if threshold.value != nil && *threshold.value < 0 {
+			errs = append(errs, invalid(child(path, threshold.name), *threshold.value, "must not be negative"))
+		}
+	}
+	return errs
+}
+
+func validateFirstBoot(cfg *v1alpha1.FirstBootConfig, path string) ErrorList {
+	var errs ErrorList
+	keys := map[uint8]bool{}
+	for i, value := range cfg.Meta {
+		if keys[value.Key] {
+			errs = append(errs, invalid(child(index(child(path, "meta"), i), "key"), value.Key, "duplicate META key"))
+		}
+		keys[value.Key] = true
+		if value.Key == meta.MetalNetworkPlatformConfig && cfg.NetworkConfigFile != "" {
+			errs = append(errs, invalid(child(index(child(path, "meta"), i), "key"), value.Key,
+				"META key 0x0a and networkConfigFile are mutually exclusive"))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,156 @@
+package validation
+
+import (
+	"testing"
+
+	v1alpha1 "github.com/eriklundjensen/thdctl/pkg/api/server/v1alpha"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validServer() *v1alpha1.Server {
+	return &v1alpha1.Server{Spec: v1alpha1.ServerSpec{ForProvider: v1alpha1.ServerParameters{
+		ServerNumber: 123456,
+		Disk:         "sda",
+		TalosVersion: "v1.9.2",
+	}}}
+}
+
+func TestValidateServer(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *v1alpha1.ServerParameters)
+		errors []string
+	}{
+		{"valid", func(p *v1alpha1.ServerParameters) {}, nil},
+		{"valid image", func(p *v1alpha1.ServerParameters) {
+			p.TalosVersion = ""
+			p.TalosImage = "https://factory.talos.dev/image/376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba/v1.9.2/metal-amd64.raw.zst"
+		}, nil},
+		{"custom image with version", func(p *v1alpha1.ServerParameters) {
+			p.TalosImage = "https://github.com/example/talos/releases/download/custom/metal-amd64.raw.zst"
+		}, nil},
+		{"missing server number", func(p *v1alpha1.ServerParameters) { p.ServerNumber = 0 }, []string{
+			`spec.forProvider.serverNumber: invalid value "0": must be a positive server number`,
+		}},
+		{"missing disk", func(p *v1alpha1.ServerParameters) { p.Disk = "" }, []string{
+			"spec.forProvider.disk: required, the disk Talos is installed on, e.g. sda",
+		}},
+		{"command injection in disk", func(p *v1alpha1.ServerParameters) { p.Disk = "sda; reboot" }, []string{
+			`spec.forProvider.disk: invalid value "sda; reboot": must be a Linux device name like sda or nvme0n1`,
+		}},
+		{"missing version and image", func(p *v1alpha1.ServerParameters) { p.TalosVersion = "" }, []string{
+			"spec.forProvider: required, talosVersion or talosImage must be set",
+		}},
+		{"invalid version", func(p *v1alpha1.ServerParameters) { p.TalosVersion = "1.9" }, []string{
+			`spec.forProvider.talosVersion: invalid value "1.9": must be a Talos version like v1.9.2`,
+		}},
+		{"version and image of another version", func(p *v1alpha1.ServerParameters) {
+			p.TalosImage = "https://github.com/siderolabs/talos/releases/download/v1.9.3/metal-amd64.raw.zst"
+		}, []string{
+			`spec.forProvider.talosVersion: invalid value "v1.9.2": talosVersion and talosImage are mutually exclusive, talosImage is an image of v1.9.3`,
+		}},
+		{"http image", func(p *v1alpha1.ServerParameters) {
+			p.TalosVersion = ""
+			p.TalosImage = "http://factory.talos.dev/image/metal-amd64.raw.zst"
+		}, []string{
+			`spec.forProvider.talosImage: invalid value "http://factory.talos.dev/image/metal-amd64.raw.zst": must be a https URL`,
+		}},
+		{"image host not allowed", func(p *v1alpha1.ServerParameters) {
+			p.TalosVersion = ""
+			p.TalosImage = "https://example.com/metal-amd64.raw.zst"
+		}, []string{
+			`spec.forProvider.talosImage: invalid value "https://example.com/metal-amd64.raw.zst": host example.com is not allowed, allowed hosts are factory.talos.dev, github.com`,
+		}},
+		{"machine config twice", func(p *v1alpha1.ServerParameters) {
+			p.MachineConfig = "node1.yaml"
+			p.FirstBoot = &v1alpha1.FirstBootConfig{MachineConfigFile: "node1.yaml"}
+		}, []string{
+			`spec.forProvider.machineConfig: invalid value "node1.yaml": machineConfig and firstBoot.machineConfigFile are mutually exclusive`,
+		}},
+		{"network config twice", func(p *v1alpha1.ServerParameters) {
+			p.FirstBoot = &v1alpha1.FirstBootConfig{
+				NetworkConfigFile: "network.yaml",
+				Meta:              []v1alpha1.MetaValue{{Key: 0x0a, Value: "{}"}, {Key: 0x0a, Value: "{}"}},
+			}
+		}, []string{
+			`spec.forProvider.firstBoot.meta[0].key: invalid value "10": META key 0x0a and networkConfigFile are mutually exclusive`,
+			`spec.forProvider.firstBoot.meta[1].key: invalid value "10": duplicate META key`,
+			`spec.forProvider.firstBoot.meta[1].key: invalid value "10": META key 0x0a and networkConfigFile are mutually exclusive`,
+		}},
+		{"disk health", func(p *v1alpha1.ServerParameters) {
+			negative := int64(-1)
+			p.DiskHealth = &v1alpha1.DiskHealthPolicy{Action: "Ignore", MaxMediaErrors: &negative}
+		}, []string{
+			`spec.forProvider.diskHealth.action: invalid value "Ignore": must be Enforce or Warn`,
+			`spec.forProvider.diskHealth.maxMediaErrors: invalid value "-1": must not be negative`,
+		}},
+		{"kubeconfig without bootstrap", func(p *v1alpha1.ServerParameters) {
+			p.Kubeconfig = "kubeconfig"
+		}, []string{
+			`spec.forProvider.kubeconfig: invalid value "kubeconfig": the kubeconfig is only written by the node with bootstrap: true`,
+		}},
+		{"all errors at once", func(p *v1alpha1.ServerParameters) {
+			p.ServerNumber = -1
+			p.Disk = "/dev/sda"
+			p.Bootstrap = true
+		}, []string{
+			`spec.forProvider.serverNumber: invalid value "-1": must be a positive server number`,
+			`spec.forProvider.disk: invalid value "/dev/sda": must be a Linux device name like sda or nvme0n1`,
+			"spec.forProvider.talosconfig: required, the talosconfig is needed to bootstrap the node",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := validServer()
+			tt.modify(&server.Spec.ForProvider)
+
+			errs := ValidateServer(server)
+
+			var messages []string
+			for _, err := range errs {
+				messages = append(messages, err.Error())
+			}
+			assert.Equal(t, tt.errors, messages)
+		})
+	}
+}
+
+func TestAllowedImageHosts(t *testing.T) {
+	defer func(hosts []string) { AllowedImageHosts = hosts }(AllowedImageHosts)
+	AllowedImageHosts = []string{"*.example.com"}
+
+	assert.Empty(t, ValidateImageURL("https://images.example.com/metal-amd64.raw.zst", "image"))
+	assert.Len(t, ValidateImageURL("https://example.com/metal-amd64.raw.zst", "image"), 1)
+}
+
+func TestValidateImageURLRejectsShellCharacters(t *testing.T) {
+	for _, image := range []string{
+		"https://github.com/a;reboot",
+		"https://github.com/$(reboot)",
+		"https://github.com/a|sh",
+		"https://github.com/a`id`",
+		"https://github.com/a&&id",
+		"https://github.com/a'b",
+		`https://github.com/a"b`,
+		`https://github.com/a\b`,
+		"https://github.com/a b",
+		"https://github.com/a\nreboot",
+		"https://github.com/a>b",
+	} {
+		t.Run(image, func(t *testing.T) {
+			errs := ValidateImageURL(image, "image")
+			require.Len(t, errs, 1)
+			assert.Contains(t, errs[0].Error(), "must be a URL without whitespace, quotes or shell characters")
+		})
+	}
+	assert.Empty(t, ValidateImageURL("https://factory.talos.dev/image/376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba/v1.9.2/metal-amd64.raw.zst", "image"))
+}
+
+func TestErrorListToAggregate(t *testing.T) {
+	assert.NoError(t, ErrorList(nil).ToAggregate())
+
+	err := ErrorList{required("disk", "the disk"), {Document: 2, Path: "spec", Detail: "invalid"}}.ToAggregate()
+	assert.EqualError(t, err, "disk: required, the disk\ndocument 2: spec: invalid")
+}